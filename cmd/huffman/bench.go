@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/letsmakecakes/huffman/pkg/huffman"
+)
+
+// benchResult holds the throughput measured by bench
+type benchResult struct {
+	OriginalSize   int
+	CompressedSize int
+	Compress       float64 // MB/s of input
+	Decompress     float64 // MB/s of output
+}
+
+// Ratio returns the compressed size as a fraction of the original
+func (r benchResult) Ratio() float64 {
+	return float64(r.CompressedSize) / float64(r.OriginalSize)
+}
+
+// bench compresses and decompresses data in memory n times with opts and
+// reports the speed of each direction. Every decompressed copy is checked
+// against data, so a round trip that loses anything fails the benchmark.
+func bench(data []byte, opts huffman.Options, n int) (benchResult, error) {
+	if n <= 0 {
+		return benchResult{}, fmt.Errorf("invalid iteration count %d", n)
+	}
+
+	var compressed bytes.Buffer
+	var compressTime time.Duration
+	for i := 0; i < n; i++ {
+		compressed.Reset()
+		start := time.Now()
+		if err := huffman.Compress(bytes.NewReader(data), &compressed, opts); err != nil {
+			return benchResult{}, fmt.Errorf("failed to compress: %w", err)
+		}
+		compressTime += time.Since(start)
+	}
+
+	var decompressed bytes.Buffer
+	var decompressTime time.Duration
+	for i := 0; i < n; i++ {
+		decompressed.Reset()
+		start := time.Now()
+		if err := huffman.Decompress(bytes.NewReader(compressed.Bytes()), &decompressed); err != nil {
+			return benchResult{}, fmt.Errorf("failed to decompress: %w", err)
+		}
+		decompressTime += time.Since(start)
+		if !bytes.Equal(data, decompressed.Bytes()) {
+			return benchResult{}, fmt.Errorf("decompressed data doesn't match the input")
+		}
+	}
+
+	total := float64(len(data)) * float64(n) / 1e6
+	return benchResult{
+		OriginalSize:   len(data),
+		CompressedSize: compressed.Len(),
+		Compress:       total / max(compressTime.Seconds(), 1e-9),
+		Decompress:     total / max(decompressTime.Seconds(), 1e-9),
+	}, nil
+}
+
+// printBench writes result in the same style as the compression summary
+func printBench(w io.Writer, result benchResult, n int) {
+	fmt.Fprintf(w, "Benchmark over %d iterations:\n", n)
+	fmt.Fprintf(w, "Original size: %d bytes\n", result.OriginalSize)
+	fmt.Fprintf(w, "Compressed size: %d bytes\n", result.CompressedSize)
+	fmt.Fprintf(w, "Compression ratio: %.2f%%\n", result.Ratio()*100)
+	fmt.Fprintf(w, "Compression speed: %.2f MB/s\n", result.Compress)
+	fmt.Fprintf(w, "Decompression speed: %.2f MB/s\n", result.Decompress)
+}
@@ -1,25 +1,78 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/letsmakecakes/huffman/pkg/huffman"
 )
 
+// formats maps the -format values to the options that produce them. v1
+// picks the smallest table for the input; portable always stores the plain
+// symbol counts, which every v1 reader parses and another Huffman
+// implementation can rebuild its tree from.
+var formats = map[string]huffman.Options{
+	"legacy":   {Legacy: true},
+	"v1":       {},
+	"portable": {Table: huffman.TableFrequencies},
+}
+
+// formatNames lists the -format values in the order they are documented
+var formatNames = []string{"legacy", "v1", "portable"}
+
 func main() {
-	compress := flag.Bool("c", false, "Compress the input file")
-	decompress := flag.Bool("d", false, "Decompress the input file")
-	input := flag.String("i", "", "Input file path")
-	output := flag.String("o", "", "Output file path")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run parses args and carries out the command, returning the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("huffman", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	compress := flags.Bool("c", false, "Compress the input file")
+	decompress := flags.Bool("d", false, "Decompress the input file")
+	input := flags.String("i", "", "Input file path")
+	output := flags.String("o", "", "Output file path")
+	force := flags.Bool("f", false, "Compress even if the input looks already compressed")
+	format := flags.String("format", "v1", "Output format: "+strings.Join(formatNames, ", "))
+	manifest := flags.String("manifest", "", "Write a JSON manifest describing the compression to this path")
+	verify := flags.Bool("verify", false, "Decompress the output after compressing and check it matches the input")
+	benchmark := flags.Bool("bench", false, "Compress and decompress the input in memory and report throughput, writing no files")
+	iterations := flags.Int("n", 10, "Number of iterations for -bench")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
 
 	if *input == "" {
-		fmt.Println("Error: Input file is required")
-		flag.Usage()
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error: Input file is required")
+		flags.Usage()
+		return 1
+	}
+
+	opts, ok := formats[*format]
+	if !ok {
+		fmt.Fprintf(stderr, "Error: unknown format %q, valid formats are %s\n", *format, strings.Join(formatNames, ", "))
+		return 1
+	}
+
+	if *benchmark {
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			fmt.Fprintf(stderr, "Benchmark failed: %v\n", err)
+			return 1
+		}
+		result, err := bench(data, opts, *iterations)
+		if err != nil {
+			fmt.Fprintf(stderr, "Benchmark failed: %v\n", err)
+			return 1
+		}
+		printBench(stdout, result, *iterations)
+		return 0
 	}
 
 	if *output == "" {
@@ -31,36 +84,118 @@ func main() {
 	}
 
 	if *compress && *decompress {
-		fmt.Println("Error: Cannot specify both compress and decompress")
-		flag.Usage()
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error: Cannot specify both compress and decompress")
+		flags.Usage()
+		return 1
 	}
 
 	if *compress {
-		if err := huffman.CompressFile(*input, *output); err != nil {
-			_, err := fmt.Fprintf(os.Stderr, "Compression failed: %v\n", err)
-			if err != nil {
-				log.Printf("failed to format according to format specifier and write to stderr: %v", err)
-			}
-			os.Exit(1)
+		if !*force && !confirmCompress(*input, stdin, stderr) {
+			fmt.Fprintln(stdout, "Compression cancelled")
+			return 1
 		}
 
-		inputInfo, _ := os.Stat(*input)
-		outputInfo, _ := os.Stat(*output)
-		ratio := float64(outputInfo.Size()) / float64(inputInfo.Size()) * 100
+		opts.VerifyAfterCompress = *verify
+		opts.Diagnostics = &huffman.Diagnostics{}
+		result, err := huffman.CompressFileResultWithOptions(*input, *output, opts)
+		defer printDiagnostics(stderr, opts.Diagnostics)
+		if err != nil {
+			printFailure(stderr, "Compression", err)
+			return 1
+		}
 
-		fmt.Printf("Compression successful!\n")
-		fmt.Printf("Original size: %d bytes\n", inputInfo.Size())
-		fmt.Printf("Compressed size: %d bytes\n", outputInfo.Size())
-		fmt.Printf("Compression ratio: %.2f%%\n", ratio)
-	} else if *decompress {
-		if err := huffman.DecompressFile(*input, *output); err != nil {
-			_, err := fmt.Fprintf(os.Stderr, "Decompression failed: %v\n", err)
-			if err != nil {
-				log.Printf("failed to format according to format specifier and write to stderr: %v", err)
+		fmt.Fprintf(stdout, "Compression successful!\n")
+		fmt.Fprintf(stdout, "Original size: %d bytes\n", result.OriginalSize)
+		fmt.Fprintf(stdout, "Compressed size: %d bytes\n", result.CompressedSize)
+		fmt.Fprintf(stdout, "Compression ratio: %.2f%%\n", result.Ratio*100)
+		fmt.Fprintf(stdout, "Entropy floor: %.0f bytes, excluding the header\n", result.TheoreticalMinBytes)
+
+		if *manifest != "" {
+			if err := writeManifest(*manifest, result); err != nil {
+				fmt.Fprintf(stderr, "Failed to write manifest: %v\n", err)
+				return 1
 			}
-			os.Exit(1)
 		}
-		fmt.Printf("Decompression successful! Output written to: %s\n", *output)
+	} else if *decompress {
+		diag := &huffman.Diagnostics{}
+		err := huffman.DecompressFileWithOptions(*input, *output, huffman.DecompressOptions{Diagnostics: diag})
+		defer printDiagnostics(stderr, diag)
+		if err != nil {
+			printFailure(stderr, "Decompression", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Decompression successful! Output written to: %s\n", *output)
 	}
+
+	return 0
+}
+
+// printFailure reports that an operation failed, with a suggested fix for
+// errors the user can act on
+func printFailure(w io.Writer, operation string, err error) {
+	if _, writeErr := fmt.Fprintf(w, "%s failed: %v\n", operation, err); writeErr != nil {
+		log.Printf("failed to format according to format specifier and write to stderr: %v", writeErr)
+		return
+	}
+	if errors.Is(err, huffman.ErrPermissionDenied) {
+		fmt.Fprintln(w, "Check that the output directory is writable, or choose another output path with -o.")
+	}
+}
+
+// printDiagnostics writes the issues collected during an operation, one per
+// line
+func printDiagnostics(w io.Writer, diag *huffman.Diagnostics) {
+	for _, d := range diag.All() {
+		fmt.Fprintf(w, "Warning: %s\n", d)
+	}
+}
+
+// writeManifest writes the manifest for result to path
+func writeManifest(path string, result huffman.Result) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close manifest file: %v", err)
+		}
+	}(file)
+
+	return huffman.WriteManifest(file, result)
+}
+
+// confirmCompress warns when the input already looks compressed and asks the
+// user whether to continue. It returns true when there is nothing to warn about.
+func confirmCompress(path string, stdin io.Reader, stderr io.Writer) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		// Let CompressFile report the error
+		return true
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(file)
+
+	prefix := make([]byte, 16)
+	n, err := io.ReadFull(file, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return true
+	}
+
+	format := huffman.DetectFormat(prefix[:n])
+	if format == "" {
+		return true
+	}
+
+	fmt.Fprintf(stderr, "Warning: %s looks like it is already %s compressed; compressing it again will not make it smaller.\n", path, format)
+	fmt.Fprint(stderr, "Compress anyway? [y/N] (use -f to skip this check): ")
+
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
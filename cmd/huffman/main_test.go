@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/letsmakecakes/huffman/pkg/huffman"
+)
+
+func TestRunFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	tests := []struct {
+		format  string
+		version int
+		table   huffman.TableFormat
+	}{
+		{"legacy", 0, huffman.TableFrequencies},
+		{"v1", 1, huffman.TableCoded},
+		{"portable", 1, huffman.TableFrequencies},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.format+".huf")
+			decompressedPath := filepath.Join(tmpDir, tt.format+".txt")
+
+			var stdout, stderr bytes.Buffer
+			args := []string{"-c", "-f", "-format", tt.format, "-i", inputPath, "-o", compressedPath}
+			if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+				t.Fatalf("Compress exited with %d: %s", code, stderr.String())
+			}
+
+			compressed, err := os.Open(compressedPath)
+			if err != nil {
+				t.Fatalf("Failed to open compressed file: %v", err)
+			}
+			header, err := huffman.ParseHeader(compressed)
+			compressed.Close()
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if header.Version != tt.version {
+				t.Errorf("Expected version %d, got %d", tt.version, header.Version)
+			}
+			if header.Table != tt.table {
+				t.Errorf("Expected a %v table, got %v", tt.table, header.Table)
+			}
+
+			args = []string{"-d", "-i", compressedPath, "-o", decompressedPath}
+			if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+				t.Fatalf("Decompress exited with %d: %s", code, stderr.String())
+			}
+
+			decompressed, err := os.ReadFile(decompressedPath)
+			if err != nil {
+				t.Fatalf("Failed to read decompressed file: %v", err)
+			}
+			if !bytes.Equal(data, decompressed) {
+				t.Errorf("Decompressed data doesn't match original.\nOriginal: %q\nDecompressed: %q", data, decompressed)
+			}
+		})
+	}
+}
+
+func TestRunUnknownFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-c", "-format", "zstd", "-i", "input.txt"}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Fatal("Expected a non-zero exit code for an unknown format")
+	}
+	if !strings.Contains(stderr.String(), "legacy, v1, portable") {
+		t.Errorf("Expected the valid formats to be listed, got %q", stderr.String())
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	outputPath := filepath.Join(tmpDir, "input.huf")
+	if err := os.WriteFile(inputPath, []byte("checked after compressing"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-c", "-f", "-verify", "-i", inputPath, "-o", outputPath}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Compress exited with %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		t.Errorf("Expected the verified output to exist: %v", err)
+	}
+}
+
+func TestBench(t *testing.T) {
+	data := bytes.Repeat([]byte("benchmarked in memory, "), 200)
+	for _, name := range formatNames {
+		t.Run(name, func(t *testing.T) {
+			result, err := bench(data, formats[name], 3)
+			if err != nil {
+				t.Fatalf("bench error: %v", err)
+			}
+			if result.Compress <= 0 || result.Decompress <= 0 {
+				t.Errorf("Expected positive throughput, got %.2f and %.2f MB/s", result.Compress, result.Decompress)
+			}
+			if result.OriginalSize != len(data) || result.CompressedSize <= 0 || result.CompressedSize >= len(data) {
+				t.Errorf("Unexpected sizes %d -> %d", result.OriginalSize, result.CompressedSize)
+			}
+		})
+	}
+
+	if _, err := bench(data, huffman.Options{}, 0); err == nil {
+		t.Error("Expected an error for zero iterations")
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte("measured but never written out"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-bench", "-n", "2", "-i", inputPath}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Benchmark exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Compression speed:") || !strings.Contains(stdout.String(), "Decompression speed:") {
+		t.Errorf("Expected throughput in the output, got %q", stdout.String())
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected no output files, found %d entries", len(entries))
+	}
+}
+
+func TestRunPrintsEntropyFloor(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte("aaaaaaaabbbbbbbb"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-c", "-f", "-i", inputPath, "-o", filepath.Join(tmpDir, "input.huf")}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Compress exited with %d: %s", code, stderr.String())
+	}
+	// 16 bytes of two equally likely symbols take 16 bits at least
+	if !strings.Contains(stdout.String(), "Entropy floor: 2 bytes") {
+		t.Errorf("Expected the entropy floor in the output, got %q", stdout.String())
+	}
+}
+
+func TestPrintFailurePermissionDenied(t *testing.T) {
+	var stderr bytes.Buffer
+	printFailure(&stderr, "Compression", fmt.Errorf("out.huf: %w", huffman.ErrPermissionDenied))
+	if !strings.Contains(stderr.String(), "Compression failed:") || !strings.Contains(stderr.String(), "choose another output path with -o") {
+		t.Errorf("Expected a failure with a suggested fix, got %q", stderr.String())
+	}
+
+	stderr.Reset()
+	printFailure(&stderr, "Decompression", errors.New("corrupt input"))
+	if strings.Contains(stderr.String(), "-o") {
+		t.Errorf("Expected no suggestion for other errors, got %q", stderr.String())
+	}
+}
+
+func TestRunPrintsDiagnostics(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.bin")
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-c", "-f", "-i", inputPath, "-o", filepath.Join(tmpDir, "input.huf")}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Compress exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Warning: output larger than input") {
+		t.Errorf("Expected an output-larger warning, got %q", stderr.String())
+	}
+}
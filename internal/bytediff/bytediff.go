@@ -0,0 +1,43 @@
+// Package bytediff describes where two byte slices differ, for the failure
+// messages of round-trip tests
+package bytediff
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// First returns the offset of the first byte where a and b differ, or false
+// when they are equal. When one is a prefix of the other they differ at the
+// end of the shorter one.
+func First(a, b []byte) (index int, ok bool) {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i, true
+		}
+	}
+	if len(a) != len(b) {
+		return n, true
+	}
+	return 0, false
+}
+
+// Describe reports where got first differs from want, with a few bytes of
+// context either side
+func Describe(want, got []byte) string {
+	i, ok := First(want, got)
+	if !ok {
+		return "no difference"
+	}
+
+	where := fmt.Sprintf("first difference at offset %d", i)
+	if i < len(want) && i < len(got) {
+		where += fmt.Sprintf(", bit %d", bits.LeadingZeros8(want[i]^got[i]))
+	}
+
+	const context = 8
+	lo := max(i-context, 0)
+	return fmt.Sprintf("%s (lengths %d and %d)\nwant: % x\ngot:  % x",
+		where, len(want), len(got), want[lo:min(i+context, len(want))], got[lo:min(i+context, len(got))])
+}
@@ -0,0 +1,35 @@
+package bytediff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFirst(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []byte
+		index int
+		ok    bool
+	}{
+		{"equal", []byte("abc"), []byte("abc"), 0, false},
+		{"both empty", nil, []byte{}, 0, false},
+		{"prefix", []byte("ab"), []byte("abc"), 2, true},
+		{"longer first", []byte("abcd"), []byte("ab"), 2, true},
+		{"differing", []byte("abcd"), []byte("abxd"), 2, true},
+		{"first byte", []byte{0x00}, []byte{0x80}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, ok := First(tt.a, tt.b)
+			if index != tt.index || ok != tt.ok {
+				t.Errorf("Expected (%d, %v), got (%d, %v)", tt.index, tt.ok, index, ok)
+			}
+		})
+	}
+
+	if msg := Describe([]byte{0x00}, []byte{0x20}); !strings.Contains(msg, "offset 0, bit 2") {
+		t.Errorf("Expected the differing bit in %q", msg)
+	}
+}
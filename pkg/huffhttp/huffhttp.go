@@ -0,0 +1,32 @@
+// Package huffhttp connects the huffman package to net/http, keeping the http
+// dependency out of the core package.
+package huffhttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/letsmakecakes/huffman/pkg/huffman"
+)
+
+// ContentEncoding is the Content-Encoding value for a Huffman compressed body
+const ContentEncoding = "huffman"
+
+// DecompressHTTP writes the body of resp to w, decompressing it if the
+// response has a Content-Encoding of huffman. Any other body is copied
+// unchanged. The caller remains responsible for closing resp.Body.
+func DecompressHTTP(resp *http.Response, w io.Writer) error {
+	if !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), ContentEncoding) {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			return fmt.Errorf("failed to copy response body: %w", err)
+		}
+		return nil
+	}
+
+	if err := huffman.Decompress(resp.Body, w); err != nil {
+		return fmt.Errorf("failed to decompress response body: %w", err)
+	}
+	return nil
+}
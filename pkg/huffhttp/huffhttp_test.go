@@ -0,0 +1,102 @@
+package huffhttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/letsmakecakes/huffman/pkg/huffman"
+)
+
+func TestDecompressHTTP(t *testing.T) {
+	data := bytes.Repeat([]byte("served over http with a huffman content encoding "), 100)
+	var compressed bytes.Buffer
+	if err := huffman.Compress(bytes.NewReader(data), &compressed, huffman.Options{}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" {
+			w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Encoding", ContentEncoding)
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/compressed", "/plain"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+
+		var got bytes.Buffer
+		err = DecompressHTTP(resp, &got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("DecompressHTTP %s: %v", path, err)
+		}
+		if !bytes.Equal(data, got.Bytes()) {
+			t.Errorf("Body of %s doesn't match the original: got %d bytes, want %d", path, got.Len(), len(data))
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	large := bytes.Repeat([]byte("middleware compresses large responses "), 100)
+	small := []byte("too small to compress")
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/small" {
+			w.Write(small)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(large[:100])
+		w.Write(large[100:])
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		want       []byte
+		compressed bool
+	}{
+		{"large", "/large", "gzip, huffman", large, true},
+		{"small", "/small", "huffman", small, false},
+		{"not accepted", "/large", "gzip", large, false},
+		{"refused", "/large", "huffman;q=0", large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			resp := rec.Result()
+			if tt.path == "/large" && resp.StatusCode != http.StatusAccepted {
+				t.Errorf("Expected status %d, got %d", http.StatusAccepted, resp.StatusCode)
+			}
+
+			if got := resp.Header.Get("Content-Encoding") == ContentEncoding; got != tt.compressed {
+				t.Fatalf("Expected compressed %v, got Content-Encoding %q", tt.compressed, resp.Header.Get("Content-Encoding"))
+			}
+			if tt.compressed && rec.Body.Len() >= len(tt.want) {
+				t.Errorf("Compressed body is %d bytes, original %d", rec.Body.Len(), len(tt.want))
+			}
+
+			var got bytes.Buffer
+			if err := DecompressHTTP(resp, &got); err != nil {
+				t.Fatalf("DecompressHTTP error: %v", err)
+			}
+			if !bytes.Equal(tt.want, got.Bytes()) {
+				t.Errorf("Body doesn't match the handler's output: got %d bytes, want %d", got.Len(), len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package huffhttp
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/letsmakecakes/huffman/pkg/huffman"
+)
+
+// MinSize is the smallest response body Middleware compresses. Smaller bodies
+// would not cover the cost of the Huffman header.
+const MinSize = 1024
+
+// Middleware compresses the responses of next for clients that send
+// Accept-Encoding: huffman. Huffman coding needs the whole body before it can
+// write anything, so the response is buffered until next returns. Bodies under
+// MinSize and responses that already set a Content-Encoding are sent as they
+// are.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsHuffman(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+		bw.finish()
+	})
+}
+
+// acceptsHuffman reports whether an Accept-Encoding value allows huffman
+func acceptsHuffman(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), ContentEncoding) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// bufferedWriter holds a response until the handler is done with it
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code to send with the buffered body
+func (bw *bufferedWriter) WriteHeader(status int) {
+	bw.status = status
+}
+
+// Write buffers p
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	return bw.body.Write(p)
+}
+
+// finish sends the buffered response, compressed if it is worth it
+func (bw *bufferedWriter) finish() {
+	header := bw.ResponseWriter.Header()
+	body := bw.body.Bytes()
+
+	if bw.body.Len() >= MinSize && header.Get("Content-Encoding") == "" {
+		var compressed bytes.Buffer
+		if err := huffman.Compress(bytes.NewReader(body), &compressed, huffman.Options{}); err != nil {
+			log.Printf("failed to compress response: %v", err)
+		} else {
+			header.Set("Content-Encoding", ContentEncoding)
+			body = compressed.Bytes()
+		}
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	bw.ResponseWriter.WriteHeader(bw.status)
+	if _, err := bw.ResponseWriter.Write(body); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
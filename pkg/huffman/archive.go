@@ -0,0 +1,99 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// archiveHeaderBuffer is the size of the reads OpenArchive makes of the
+// header and index, so they take a few ReadAt calls rather than one per byte
+const archiveHeaderBuffer = 4096
+
+// Archive reads the blocks of a block archive on demand through an
+// io.ReaderAt, such as a file or a reader over ranged HTTP requests. Only the
+// header and index are read when it is opened; each block is fetched with a
+// single ReadAt of its own bytes when it is decoded. It is safe for
+// concurrent use if the underlying ReaderAt is.
+type Archive struct {
+	r       io.ReaderAt
+	header  *Header
+	offsets []int64 // offset of each block in r
+}
+
+// OpenArchive reads the header and block index of the size-byte block archive
+// in r. The blocks aren't read until Entry asks for them, though the read of
+// the end of the index may take in the start of the first block.
+func OpenArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	br := archiveHeaderReader{Reader: bufio.NewReaderSize(sr, archiveHeaderBuffer), size: size}
+	header, err := ParseHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Encrypted {
+		return nil, ErrEncrypted
+	}
+	if header.Blocks == nil {
+		return nil, fmt.Errorf("file is not a block archive")
+	}
+	if header.RecordSize > 0 {
+		return nil, fmt.Errorf("record archive's blocks are columns; use DecompressFixedRecords")
+	}
+	offset, err := sr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	offset -= int64(br.Buffered())
+
+	a := &Archive{r: r, header: header, offsets: make([]int64, len(header.Blocks))}
+	for i, block := range header.Blocks {
+		a.offsets[i] = offset
+		offset += block.CompressedSize
+	}
+	if offset > size {
+		return nil, fmt.Errorf("block index records %d bytes of blocks, archive has %d", offset-a.offsets[0], size-a.offsets[0])
+	}
+	return a, nil
+}
+
+// Len returns the number of blocks in the archive
+func (a *Archive) Len() int {
+	return len(a.header.Blocks)
+}
+
+// Info returns the index entry of block i
+func (a *Archive) Info(i int) BlockInfo {
+	return a.header.Blocks[i]
+}
+
+// Entry reads and decodes block i, counting from 0
+func (a *Archive) Entry(i int) ([]byte, error) {
+	if i < 0 || i >= len(a.header.Blocks) {
+		return nil, fmt.Errorf("block %d out of range [0, %d)", i, len(a.header.Blocks))
+	}
+	block := a.header.Blocks[i]
+	compressed := make([]byte, block.CompressedSize)
+	if n, err := a.r.ReadAt(compressed, a.offsets[i]); n < len(compressed) {
+		return nil, fmt.Errorf("failed to read block %d: %w", i, err)
+	}
+	decoded, err := readBlock(bytes.NewReader(compressed), block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode block %d: %w", i, err)
+	}
+	return decoded, nil
+}
+
+// archiveHeaderReader buffers the header reads of OpenArchive, and gives
+// ParseHeader the archive's size to check the header's counts against
+type archiveHeaderReader struct {
+	*bufio.Reader
+	size int64
+}
+
+// Len returns the size of the archive, which is the number of unread bytes
+// when ParseHeader asks for it
+func (r archiveHeaderReader) Len() int {
+	return int(r.size)
+}
@@ -0,0 +1,73 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// rangeRecorder is an io.ReaderAt that records the ranges read from it
+type rangeRecorder struct {
+	r      io.ReaderAt
+	ranges [][2]int64
+}
+
+func (rr *rangeRecorder) ReadAt(p []byte, off int64) (int, error) {
+	n, err := rr.r.ReadAt(p, off)
+	rr.ranges = append(rr.ranges, [2]int64{off, off + int64(n)})
+	return n, err
+}
+
+func TestOpenArchive(t *testing.T) {
+	data := blockTestData()
+	blockSize := 1024
+	archive, err := os.ReadFile(writeBlockArchive(t, data, ParallelOptions{BlockSize: blockSize}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := &rangeRecorder{r: bytes.NewReader(archive)}
+	a, err := OpenArchive(rr, int64(len(archive)))
+	if err != nil {
+		t.Fatalf("OpenArchive error: %v", err)
+	}
+	if want := (len(data) + blockSize - 1) / blockSize; a.Len() != want {
+		t.Fatalf("Expected %d blocks, got %d", want, a.Len())
+	}
+
+	// Opening reads the index in a buffered read or two, reaching no further
+	// than one buffer past its end
+	var indexEnd int64
+	for _, r := range rr.ranges {
+		indexEnd = max(indexEnd, r[1])
+	}
+	if len(rr.ranges) > 2 || indexEnd > a.offsets[0]+archiveHeaderBuffer {
+		t.Errorf("Expected opening to read the %d-byte index, read %v", a.offsets[0], rr.ranges)
+	}
+
+	for _, i := range []int{1, 6} {
+		rr.ranges = nil
+		got, err := a.Entry(i)
+		if err != nil {
+			t.Fatalf("Entry(%d) error: %v", i, err)
+		}
+		want := data[i*blockSize : min((i+1)*blockSize, len(data))]
+		if !bytes.Equal(got, want) {
+			t.Errorf("Entry(%d) mismatch: %s", i, describeDiff(want, got))
+		}
+
+		// Only the block's own bytes are fetched
+		wantRange := [2]int64{a.offsets[i], a.offsets[i] + a.Info(i).CompressedSize}
+		if len(rr.ranges) != 1 || rr.ranges[0] != wantRange {
+			t.Errorf("Entry(%d) read %v, want only %v", i, rr.ranges, wantRange)
+		}
+	}
+
+	if _, err := a.Entry(a.Len()); err == nil {
+		t.Error("Expected an error for an out-of-range block")
+	}
+	if _, err := OpenArchive(bytes.NewReader(archive), int64(len(archive))-1); err == nil {
+		t.Error("Expected an error for a truncated archive")
+	}
+}
@@ -0,0 +1,690 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// DefaultBlockSize is the largest block size OptimalBlockSize recommends, and
+// the one it recommends for data whose statistics don't change
+const DefaultBlockSize = 1 << 20
+
+// minOptimalBlockSize is the smallest block size OptimalBlockSize recommends
+const minOptimalBlockSize = 4 << 10
+
+// blockSizeSample is the number of bytes at the start of a file
+// CompressParallel passes to OptimalBlockSize
+const blockSizeSample = 4 << 20
+
+// BlockInfo locates one block of a block archive.
+type BlockInfo struct {
+	// OriginalSize is the number of bytes the block decodes to
+	OriginalSize int64
+	// CompressedSize is the length of the block's stream in the archive
+	CompressedSize int64
+}
+
+// ParallelOptions configures CompressParallel.
+type ParallelOptions struct {
+	// BlockSize is the number of input bytes per block. When it is 0 the
+	// OptimalBlockSize of the start of the file is used.
+	BlockSize int
+	// Workers is the number of blocks compressed at once. It defaults to
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// MinBlocks and MaxBlocks bound the number of blocks, trading
+	// parallelism against index and per-block header overhead. When
+	// BlockSize would give a count outside them the block size is derived
+	// from the file size instead. Zero leaves that end unbounded.
+	MinBlocks int
+	MaxBlocks int
+	// BlockStats records the number of distinct symbols and the entropy of
+	// each block in the index, for BlockStats to read back. It adds up
+	// to four bytes per block.
+	BlockStats bool
+}
+
+// BlockStat describes one block of a block archive
+type BlockStat struct {
+	OriginalSize   int64
+	CompressedSize int64
+	// Symbols is the number of distinct byte values in the block
+	Symbols int
+	// Entropy is the Shannon entropy of the block's bytes in bits per byte,
+	// to three decimal places
+	Entropy float64
+}
+
+// CompressParallel splits a file into fixed-size blocks and compresses them
+// concurrently, each with its own model. The result is a block archive:
+//
+//	[Magic:1][Version:1][Flags:uvarint][BlockCount:uvarint][Index:BlockCount×(OriginalSize:uvarint, CompressedSize:uvarint)][Block streams]
+//
+// Every block is a complete stream, so blocks can be decoded independently
+// and a Reader can seek without decoding what comes before.
+func CompressParallel(inputPath, outputPath string, opts ParallelOptions) error {
+	if opts.BlockSize < 0 || opts.Workers < 0 || opts.MinBlocks < 0 || opts.MaxBlocks < 0 {
+		return fmt.Errorf("invalid parallel options %+v", opts)
+	}
+	if opts.MaxBlocks > 0 && opts.MinBlocks > opts.MaxBlocks {
+		return fmt.Errorf("MinBlocks %d is more than MaxBlocks %d", opts.MinBlocks, opts.MaxBlocks)
+	}
+	workers := opts.Workers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty file")
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = OptimalBlockSize(data[:min(len(data), blockSizeSample)])
+	}
+	blockSize, err := parallelBlockSize(len(data), opts)
+	if err != nil {
+		return err
+	}
+
+	blocks := make([][]byte, (len(data)+blockSize-1)/blockSize)
+	errs := make([]error, len(blocks))
+	var stats []BlockStat
+	if opts.BlockStats {
+		stats = make([]BlockStat, len(blocks))
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				start := idx * blockSize
+				end := min(start+blockSize, len(data))
+				chunk := data[start:end]
+
+				freq := BuildFrequencyTableFromData(chunk)
+				var buf bytes.Buffer
+				errs[idx] = writeCompressed(&buf, chunk, freq, Options{})
+				blocks[idx] = buf.Bytes()
+				if stats != nil {
+					stats[idx] = BlockStat{Symbols: len(freq), Entropy: entropy(freq)}
+				}
+			}
+		}()
+	}
+	for idx := range blocks {
+		next <- idx
+	}
+	close(next)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to compress block: %w", err)
+	}
+
+	header := &Header{Version: formatVersion, OriginalSize: int64(len(data)), BlockStats: stats}
+	header.Blocks = make([]BlockInfo, len(blocks))
+	for i, block := range blocks {
+		header.Blocks[i] = BlockInfo{
+			OriginalSize:   int64(min(blockSize, len(data)-i*blockSize)),
+			CompressedSize: int64(len(block)),
+		}
+	}
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return outputError(outputPath, err)
+	}
+	defer func(output *os.File) {
+		err := output.Close()
+		if err != nil {
+			log.Printf("failed to close output file: %v", err)
+		}
+	}(output)
+
+	if err := writeHeader(output, header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	for _, block := range blocks {
+		if _, err := output.Write(block); err != nil {
+			return fmt.Errorf("failed to write block: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// parallelBlockSize returns the block size CompressParallel uses for n bytes:
+// opts.BlockSize, or DefaultBlockSize, adjusted to keep the number of blocks
+// within opts.MinBlocks and opts.MaxBlocks
+func parallelBlockSize(n int, opts ParallelOptions) (int, error) {
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	count := (n + blockSize - 1) / blockSize
+	switch {
+	case opts.MaxBlocks > 0 && count > opts.MaxBlocks:
+		blockSize = (n + opts.MaxBlocks - 1) / opts.MaxBlocks
+	case opts.MinBlocks > 1 && count < opts.MinBlocks:
+		if n < opts.MinBlocks {
+			return 0, fmt.Errorf("%d bytes can't be split into %d blocks", n, opts.MinBlocks)
+		}
+		// The largest size that still leaves more than MinBlocks-1 blocks
+		blockSize = (n+opts.MinBlocks-2)/(opts.MinBlocks-1) - 1
+	}
+
+	// Blocks all have the same size, so not every range can be met exactly
+	count = (n + blockSize - 1) / blockSize
+	if count < opts.MinBlocks || opts.MaxBlocks > 0 && count > opts.MaxBlocks {
+		return 0, fmt.Errorf("%d bytes can't be split into equal blocks numbering %d to %d", n, opts.MinBlocks, opts.MaxBlocks)
+	}
+	return blockSize, nil
+}
+
+// OptimalBlockSize recommends a block size for CompressParallel from a sample
+// of the input. Each power of two from 4KB to DefaultBlockSize is tried by
+// splitting the sample into blocks of that size and adding up the estimated
+// cost of each: its header, its payload at the entropy of its own byte
+// counts, and its index entry. Small blocks pay for a header and a model
+// each but follow local changes in the statistics; large blocks amortize the
+// header over more data. The size with the lowest total wins, the larger size
+// on a tie. Sizes beyond the sample's length all cost the same as coding the
+// sample as one block, so a sample whose statistics don't change gets
+// DefaultBlockSize.
+func OptimalBlockSize(sampleData []byte) int {
+	if len(sampleData) == 0 {
+		return DefaultBlockSize
+	}
+
+	// Count the smallest blocks once and merge pairs for each larger size
+	counts := make([]byteCounts, 0, (len(sampleData)+minOptimalBlockSize-1)/minOptimalBlockSize)
+	for start := 0; start < len(sampleData); start += minOptimalBlockSize {
+		var c byteCounts
+		c.add(sampleData[start:min(start+minOptimalBlockSize, len(sampleData))])
+		counts = append(counts, c)
+	}
+
+	best, bestCost := 0, math.Inf(1)
+	for size := minOptimalBlockSize; size <= DefaultBlockSize; size *= 2 {
+		cost := 0.0
+		for i := range counts {
+			cost += blockCost(&counts[i])
+		}
+		if cost <= bestCost {
+			best, bestCost = size, cost
+		}
+
+		merged := counts[:(len(counts)+1)/2]
+		for i := range merged {
+			c := counts[2*i]
+			if 2*i+1 < len(counts) {
+				for b, n := range counts[2*i+1] {
+					c[b] += n
+				}
+			}
+			merged[i] = c
+		}
+		counts = merged
+	}
+	return best
+}
+
+// blockCost estimates the bytes a block with the given counts takes in a
+// block archive
+func blockCost(c *byteCounts) float64 {
+	freq := c.table()
+	var n int
+	for _, count := range c {
+		n += count
+	}
+	payload := math.Ceil(float64(n) * entropy(freq) / 8)
+	compressed := HeaderLen(freq) + int(payload)
+	return float64(compressed + uvarintLen(uint64(n)) + uvarintLen(uint64(compressed)))
+}
+
+// appendBlockIndex serializes a block archive's index
+func appendBlockIndex(buf []byte, blocks []BlockInfo) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(blocks)))
+	for _, block := range blocks {
+		buf = binary.AppendUvarint(buf, uint64(block.OriginalSize))
+		buf = binary.AppendUvarint(buf, uint64(block.CompressedSize))
+	}
+	return buf
+}
+
+// readBlockIndex parses an index written by appendBlockIndex
+func readBlockIndex(br io.ByteReader, version int) (*Header, error) {
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if err := need(br, count, 2, "block index entries"); err != nil {
+		return nil, err
+	}
+
+	// Every index entry takes at least two bytes, so don't trust a huge
+	// count for the initial allocation
+	h := &Header{Version: version, Blocks: make([]BlockInfo, 0, min(count, 1<<16))}
+	for i := uint64(0); i < count; i++ {
+		originalSize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		compressedSize, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if originalSize > math.MaxInt64-uint64(h.OriginalSize) || compressedSize > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid size in block %d", i)
+		}
+
+		h.Blocks = append(h.Blocks, BlockInfo{
+			OriginalSize:   int64(originalSize),
+			CompressedSize: int64(compressedSize),
+		})
+		h.OriginalSize += int64(originalSize)
+	}
+
+	return h, nil
+}
+
+// appendBlockStats serializes the statistics of a block archive, which follow
+// its index as a symbol count and an entropy in thousandths of a bit, both
+// uvarints, for each block
+func appendBlockStats(buf []byte, h *Header) ([]byte, error) {
+	if len(h.BlockStats) != len(h.Blocks) {
+		return nil, fmt.Errorf("%d block statistics for %d blocks", len(h.BlockStats), len(h.Blocks))
+	}
+	for _, stat := range h.BlockStats {
+		buf = binary.AppendUvarint(buf, uint64(stat.Symbols))
+		buf = binary.AppendUvarint(buf, uint64(math.Round(stat.Entropy*1000)))
+	}
+	return buf, nil
+}
+
+// readBlockStats parses the statistics written by appendBlockStats for the
+// given blocks
+func readBlockStats(br io.ByteReader, blocks []BlockInfo) ([]BlockStat, error) {
+	if err := need(br, uint64(len(blocks)), 2, "block statistics"); err != nil {
+		return nil, err
+	}
+
+	stats := make([]BlockStat, len(blocks))
+	for i, block := range blocks {
+		symbols, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		millibits, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if symbols > 256 || millibits > 8000 {
+			return nil, fmt.Errorf("invalid statistics for block %d", i)
+		}
+
+		stats[i] = BlockStat{
+			OriginalSize:   block.OriginalSize,
+			CompressedSize: block.CompressedSize,
+			Symbols:        int(symbols),
+			Entropy:        float64(millibits) / 1000,
+		}
+	}
+	return stats, nil
+}
+
+// BlockStats returns the statistics recorded for each block of a block
+// archive written with ParallelOptions.BlockStats, in order
+func BlockStats(archivePath string) ([]BlockStat, error) {
+	if err := checkNotDirectory(archivePath); err != nil {
+		return nil, err
+	}
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Blocks == nil {
+		return nil, fmt.Errorf("file is not a block archive")
+	}
+	if header.BlockStats == nil {
+		return nil, fmt.Errorf("archive has no block statistics; compress it with ParallelOptions.BlockStats")
+	}
+	return header.BlockStats, nil
+}
+
+// DecompressParallelTo decompresses a block archive with up to workers blocks
+// decoding at once, writing the output to w in block order. At most workers
+// blocks are held in memory, decoded or waiting to be written. A workers of 0
+// or less uses runtime.GOMAXPROCS(0). A file that isn't a block archive is
+// decompressed serially.
+func DecompressParallelTo(inputPath string, w io.Writer, workers int) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	// A record needs every column, so a record archive gains nothing from
+	// decoding its blocks in parallel
+	if header.Blocks == nil || header.RecordSize > 0 {
+		if _, err := input.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind input file: %w", err)
+		}
+		return Decompress(input, w)
+	}
+
+	type blockResult struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan blockResult, len(header.Blocks))
+	for i := range results {
+		results[i] = make(chan blockResult, 1)
+	}
+
+	// Read blocks in order, starting a decoder for each while fewer than
+	// workers blocks are in flight
+	slots := make(chan struct{}, workers)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i, block := range header.Blocks {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			compressed, err := io.ReadAll(io.LimitReader(input, block.CompressedSize))
+			if err == nil && int64(len(compressed)) != block.CompressedSize {
+				err = fmt.Errorf("block truncated: got %d of %d bytes", len(compressed), block.CompressedSize)
+			}
+			if err != nil {
+				results[i] <- blockResult{err: err}
+				return
+			}
+
+			go func(i int, block BlockInfo) {
+				decoded, err := readBlock(bytes.NewReader(compressed), block)
+				results[i] <- blockResult{data: decoded, err: err}
+			}(i, block)
+		}
+	}()
+
+	for i := range header.Blocks {
+		result := <-results[i]
+		if result.err != nil {
+			return fmt.Errorf("failed to decode block %d: %w", i, result.err)
+		}
+		if _, err := w.Write(result.data); err != nil {
+			return err
+		}
+		<-slots
+	}
+
+	return nil
+}
+
+// decodeBlocks decodes every block of an archive from r and writes the
+// output to w in order, or the records the columns of a record archive make up
+func decodeBlocks(r io.Reader, h *Header, w io.Writer) error {
+	if h.RecordSize > 0 {
+		return decodeRecords(r, h, w)
+	}
+	for i, block := range h.Blocks {
+		decoded, err := readBlock(r, block)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %d: %w", i, err)
+		}
+		if _, err := w.Write(decoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlock reads and decodes the next block of an archive from r
+func readBlock(r io.Reader, block BlockInfo) ([]byte, error) {
+	compressed, err := io.ReadAll(io.LimitReader(r, block.CompressedSize))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(compressed)) != block.CompressedSize {
+		return nil, fmt.Errorf("block truncated: got %d of %d bytes", len(compressed), block.CompressedSize)
+	}
+
+	header, decoded, err := readCompressed(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	if header.Blocks != nil {
+		return nil, fmt.Errorf("nested block archive")
+	}
+	if int64(len(decoded)) != block.OriginalSize {
+		return nil, fmt.Errorf("block decoded to %d bytes, index records %d", len(decoded), block.OriginalSize)
+	}
+
+	return decoded, nil
+}
+
+// Reader decompresses a stream and supports seeking within the decompressed
+// data. For block and line archives a seek only decodes the block or line
+// that contains the new position; a single stream is decoded in full the
+// first time it is read.
+type Reader struct {
+	r         io.ReadSeeker
+	header    *Header
+	dataStart int64 // offset of the first block or payload in r
+	tree      *Node // shared tree of a line archive
+
+	starts      []int64 // decompressed offset of each block
+	compOffsets []int64 // offset of each block relative to dataStart
+
+	pos     int64 // position in the decompressed data
+	current int   // index of the cached block, -1 when none
+	block   []byte
+}
+
+// NewReader returns a Reader over the compressed stream in r.
+func NewReader(r io.ReadSeeker) (*Reader, error) {
+	header, err := ParseHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Encrypted {
+		return nil, ErrEncrypted
+	}
+	if header.ExternalCodes {
+		return nil, ErrExternalCodes
+	}
+	if header.RecordSize > 0 {
+		return nil, fmt.Errorf("record archive can't be read by block; use DecompressFixedRecords")
+	}
+	dataStart, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	zr := &Reader{r: r, header: header, dataStart: dataStart, current: -1}
+
+	blocks := header.Blocks
+	if header.Lines != nil {
+		// Each line is a block coded with the shared tree
+		if zr.tree = header.Root(); zr.tree == nil {
+			return nil, fmt.Errorf("failed to build huffman tree")
+		}
+		blocks = header.Lines
+	}
+	if blocks == nil {
+		// Treat a single stream as one block spanning the rest of r
+		blocks = []BlockInfo{{OriginalSize: header.OriginalSize, CompressedSize: -1}}
+	}
+	var start, offset int64
+	for _, block := range blocks {
+		zr.starts = append(zr.starts, start)
+		zr.compOffsets = append(zr.compOffsets, offset)
+		start += block.OriginalSize
+		offset += block.CompressedSize
+	}
+
+	return zr, nil
+}
+
+// Read reads decompressed data from the current position.
+func (zr *Reader) Read(p []byte) (int, error) {
+	size, err := zr.size()
+	if err != nil {
+		return 0, err
+	}
+	if zr.pos >= size {
+		return 0, io.EOF
+	}
+
+	idx := sort.Search(len(zr.starts), func(i int) bool { return zr.starts[i] > zr.pos }) - 1
+	if err := zr.load(idx); err != nil {
+		return 0, err
+	}
+
+	n := copy(p, zr.block[zr.pos-zr.starts[idx]:])
+	zr.pos += int64(n)
+	return n, nil
+}
+
+// size returns the decompressed length, decoding a single stream whose size
+// is only recorded in its trailer or not at all, or a stored stream
+func (zr *Reader) size() (int64, error) {
+	if zr.header.SizeInTrailer || zr.header.NoSize || zr.header.Stored {
+		if err := zr.load(0); err != nil {
+			return 0, err
+		}
+	}
+	return zr.header.OriginalSize, nil
+}
+
+// load decodes block idx into the cache unless it is already there
+func (zr *Reader) load(idx int) error {
+	if idx == zr.current {
+		return nil
+	}
+
+	if _, err := zr.r.Seek(zr.dataStart+zr.compOffsets[idx], io.SeekStart); err != nil {
+		return err
+	}
+
+	if zr.header.Blocks != nil {
+		block, err := readBlock(zr.r, zr.header.Blocks[idx])
+		if err != nil {
+			return fmt.Errorf("failed to decode block %d: %w", idx, err)
+		}
+		zr.block, zr.current = block, idx
+		return nil
+	}
+	if zr.header.Lines != nil {
+		line, err := readLine(zr.r, zr.tree, zr.header.Lines[idx])
+		if err != nil {
+			return fmt.Errorf("failed to decode line %d: %w", idx+1, err)
+		}
+		zr.block, zr.current = line, idx
+		return nil
+	}
+
+	encodedData, err := io.ReadAll(zr.r)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	encodedData, err = splitTrailer(zr.header, encodedData)
+	if err != nil {
+		return fmt.Errorf("failed to read trailer: %w", err)
+	}
+	if zr.header.Stored {
+		zr.header.OriginalSize = int64(len(encodedData))
+		zr.block, zr.current = encodedData, idx
+		return nil
+	}
+	tree := zr.header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+	decoded, err := zr.header.newDecoder(encodedData, tree).readAll()
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	if zr.header.NoSize {
+		zr.header.OriginalSize = int64(len(decoded))
+	}
+	if zr.header.Checksummed && crc32.ChecksumIEEE(decoded) != zr.header.Checksum {
+		return ErrChecksumMismatch
+	}
+	zr.block, zr.current = decoded, idx
+	return nil
+}
+
+// Seek sets the position in the decompressed data for the next Read.
+func (zr *Reader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = zr.pos + offset
+	case io.SeekEnd:
+		size, err := zr.size()
+		if err != nil {
+			return 0, err
+		}
+		pos = size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("negative position %d", pos)
+	}
+
+	zr.pos = pos
+	return pos, nil
+}
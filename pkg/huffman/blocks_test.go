@@ -0,0 +1,405 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBlockArchive compresses data into a block archive and returns its path
+func writeBlockArchive(t testing.TB, data []byte, opts ParallelOptions) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	archivePath := filepath.Join(tmpDir, "archive.huf")
+
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressParallel(inputPath, archivePath, opts); err != nil {
+		t.Fatalf("CompressParallel failed: %v", err)
+	}
+	return archivePath
+}
+
+// blockTestData varies its alphabet along the input so blocks get different models
+func blockTestData() []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 10000; i++ {
+		buf.WriteString("line ")
+		buf.WriteByte(byte('a' + i%26))
+		buf.WriteString(" of the block archive test\n")
+	}
+	return buf.Bytes()
+}
+
+func TestCompressParallelRoundTrip(t *testing.T) {
+	data := blockTestData()
+	archivePath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 1000, Workers: 3})
+
+	compressed, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ParseHeader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if expected := (len(data) + 999) / 1000; len(header.Blocks) != expected {
+		t.Errorf("Expected %d blocks, got %d", expected, len(header.Blocks))
+	}
+
+	decompressedPath := filepath.Join(t.TempDir(), "decompressed.txt")
+	if err := DecompressFile(archivePath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(data), len(decompressed))
+	}
+}
+
+func TestCompressParallelBlockBounds(t *testing.T) {
+	data := blockTestData()
+
+	tests := []struct {
+		name string
+		opts ParallelOptions
+	}{
+		{"max lowers the count", ParallelOptions{BlockSize: 100, MaxBlocks: 4}},
+		{"min raises the count", ParallelOptions{MinBlocks: 7}},
+		{"within bounds", ParallelOptions{BlockSize: 1000, MinBlocks: 2, MaxBlocks: 20}},
+		{"exact count", ParallelOptions{MinBlocks: 3, MaxBlocks: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := writeBlockArchive(t, data, tt.opts)
+			compressed, err := os.ReadFile(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, err := ParseHeader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			count := len(header.Blocks)
+			if count < tt.opts.MinBlocks || tt.opts.MaxBlocks > 0 && count > tt.opts.MaxBlocks {
+				t.Errorf("Expected %d to %d blocks, got %d", tt.opts.MinBlocks, tt.opts.MaxBlocks, count)
+			}
+
+			var decompressed bytes.Buffer
+			if err := Decompress(bytes.NewReader(compressed), &decompressed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(data, decompressed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed.Bytes()))
+			}
+		})
+	}
+
+	for _, opts := range []ParallelOptions{{MinBlocks: 5, MaxBlocks: 4}, {MinBlocks: -1}} {
+		if err := CompressParallel("unused", "unused.huf", opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestParallelBlockSize(t *testing.T) {
+	for n := 1; n <= 200; n++ {
+		for lo := 0; lo <= 12; lo++ {
+			for hi := max(lo, 1); hi <= 12; hi++ {
+				opts := ParallelOptions{BlockSize: 7, MinBlocks: lo, MaxBlocks: hi}
+				blockSize, err := parallelBlockSize(n, opts)
+				if err != nil {
+					// An upper bound alone can always be met
+					if lo <= 1 {
+						t.Errorf("Unexpected error for %d bytes in %d to %d blocks: %v", n, lo, hi, err)
+					}
+					continue
+				}
+				if count := (n + blockSize - 1) / blockSize; count < lo || count > hi {
+					t.Errorf("%d bytes with block size %d gives %d blocks, outside %d to %d", n, blockSize, count, lo, hi)
+				}
+			}
+		}
+	}
+}
+
+func TestOptimalBlockSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// The same skewed distribution of letters throughout
+	uniform := make([]byte, 2<<20)
+	for i := range uniform {
+		uniform[i] = 'a' + byte(rng.Intn(4)*rng.Intn(7))
+	}
+
+	// Alternating 8KB runs of a few letters and of high bytes
+	shifting := make([]byte, 2<<20)
+	for i := range shifting {
+		if i/(8<<10)%2 == 0 {
+			shifting[i] = 'a' + byte(rng.Intn(8))
+		} else {
+			shifting[i] = 0x80 + byte(rng.Intn(128))
+		}
+	}
+
+	uniformSize := OptimalBlockSize(uniform)
+	if uniformSize != DefaultBlockSize {
+		t.Errorf("Expected DefaultBlockSize for uniform data, got %d", uniformSize)
+	}
+	shiftingSize := OptimalBlockSize(shifting)
+	if shiftingSize > 8<<10 {
+		t.Errorf("Expected blocks no larger than the 8KB runs for shifting data, got %d", shiftingSize)
+	}
+	if size := OptimalBlockSize(uniform[:1000]); size != DefaultBlockSize {
+		t.Errorf("Expected DefaultBlockSize for a short sample, got %d", size)
+	}
+
+	archivePath := writeBlockArchive(t, shifting, ParallelOptions{})
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	header, err := ParseHeader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(shifting) / shiftingSize; len(header.Blocks) != want {
+		t.Errorf("Expected CompressParallel to use %d blocks of the optimal size, got %d", want, len(header.Blocks))
+	}
+}
+
+func TestBlockStats(t *testing.T) {
+	// Alternating 16KB regions of text and random bytes
+	rng := rand.New(rand.NewSource(1))
+	text := blockTestData()
+	var data []byte
+	for i := 0; i < 8; i++ {
+		region := make([]byte, 16<<10)
+		if i%2 == 0 {
+			copy(region, text)
+		} else {
+			rng.Read(region)
+		}
+		data = append(data, region...)
+	}
+
+	archivePath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 16 << 10, BlockStats: true})
+	stats, err := BlockStats(archivePath)
+	if err != nil {
+		t.Fatalf("BlockStats failed: %v", err)
+	}
+	if len(stats) != 8 {
+		t.Fatalf("Expected 8 blocks, got %d", len(stats))
+	}
+	for i, stat := range stats {
+		if stat.OriginalSize != 16<<10 {
+			t.Errorf("Block %d: expected 16384 bytes, got %d", i, stat.OriginalSize)
+		}
+		if i%2 == 0 {
+			if stat.Symbols > 64 || stat.Entropy > 5 || stat.CompressedSize > stat.OriginalSize*3/4 {
+				t.Errorf("Block %d: expected text statistics, got %+v", i, stat)
+			}
+		} else {
+			if stat.Symbols != 256 || stat.Entropy < 7.9 || stat.CompressedSize < stat.OriginalSize {
+				t.Errorf("Block %d: expected random statistics, got %+v", i, stat)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := DecompressParallelTo(archivePath, &out, 2); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output doesn't match original: %s", describeDiff(data, out.Bytes()))
+	}
+
+	// Statistics are opt-in
+	plainPath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 16 << 10})
+	if _, err := BlockStats(plainPath); err == nil {
+		t.Error("Expected an error for an archive without statistics")
+	}
+	plain, err := os.Stat(plainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withStats, err := os.Stat(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four bytes per block and a longer flags field
+	if extra := withStats.Size() - plain.Size(); extra <= 0 || extra > 4*8+1 {
+		t.Errorf("Expected statistics to add at most 4 bytes per block, got %d bytes", extra)
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	data := blockTestData()
+	archivePath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 1000})
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			t.Errorf("failed to close archive: %v", err)
+		}
+	}(file)
+
+	zr, err := NewReader(file)
+	if err != nil {
+		t.Fatalf("NewReader error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		offset   int64
+		whence   int
+		expected int64
+	}{
+		{"start of block", 3000, io.SeekStart, 3000},
+		{"middle of block", 4321, io.SeekStart, 4321},
+		{"forward from current", 1500, io.SeekCurrent, 4321 + 100 + 1500},
+		{"backward from current", -5000, io.SeekCurrent, 5921 + 100 - 5000},
+		{"from end", -250, io.SeekEnd, int64(len(data)) - 250},
+		{"start", 0, io.SeekStart, 0},
+	}
+
+	for _, tt := range tests {
+		pos, err := zr.Seek(tt.offset, tt.whence)
+		if err != nil {
+			t.Fatalf("%s: Seek error: %v", tt.name, err)
+		}
+		if pos != tt.expected {
+			t.Fatalf("%s: expected position %d, got %d", tt.name, tt.expected, pos)
+		}
+
+		// Read across block boundaries
+		got := make([]byte, 100)
+		if _, err := io.ReadFull(zr, got); err != nil {
+			t.Fatalf("%s: Read error: %v", tt.name, err)
+		}
+		if want := data[pos : pos+100]; !bytes.Equal(want, got) {
+			t.Errorf("%s: expected %q, got %q", tt.name, want, got)
+		}
+	}
+
+	if _, err := zr.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected error seeking before the start")
+	}
+	if _, err := zr.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zr.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected EOF at end, got %v", err)
+	}
+}
+
+func TestReaderSingleStream(t *testing.T) {
+	data := []byte("a single stream can be read and seeked too")
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"omit size", Options{OmitSize: true}},
+		{"top k", Options{TopK: 3}},
+		{"stored", Options{Store: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("NewReader error: %v", err)
+			}
+			if _, err := zr.Seek(9, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Read error: %v", err)
+			}
+			if !bytes.Equal(data[9:], got) {
+				t.Errorf("Expected %q, got %q", data[9:], got)
+			}
+		})
+	}
+}
+
+func TestDecompressParallelTo(t *testing.T) {
+	data := blockTestData()
+	archivePath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 700})
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var serial bytes.Buffer
+	if err := Decompress(archive, &serial); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+
+	for _, workers := range []int{1, 3, 100} {
+		var parallel bytes.Buffer
+		if err := DecompressParallelTo(archivePath, &parallel, workers); err != nil {
+			t.Fatalf("DecompressParallelTo with %d workers: %v", workers, err)
+		}
+		if !bytes.Equal(serial.Bytes(), parallel.Bytes()) {
+			t.Errorf("%d workers: parallel output differs from serial: %s", workers, describeDiff(serial.Bytes(), parallel.Bytes()))
+		}
+	}
+
+	// A single stream falls back to serial decoding
+	singlePath := filepath.Join(t.TempDir(), "single.huf")
+	inputPath := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, singlePath); err != nil {
+		t.Fatalf("CompressFile error: %v", err)
+	}
+	var single bytes.Buffer
+	if err := DecompressParallelTo(singlePath, &single, 4); err != nil {
+		t.Fatalf("DecompressParallelTo error: %v", err)
+	}
+	if !bytes.Equal(data, single.Bytes()) {
+		t.Errorf("Single stream output differs: %s", describeDiff(data, single.Bytes()))
+	}
+}
+
+func BenchmarkDecompressParallelTo(b *testing.B) {
+	data := bytes.Repeat(blockTestData(), 100)
+	archivePath := writeBlockArchive(b, data, ParallelOptions{BlockSize: 64 * 1024})
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if err := DecompressParallelTo(archivePath, io.Discard, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
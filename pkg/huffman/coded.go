@@ -0,0 +1,121 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// maxCodedTable is the longest frequency list a coded table can hold: the
+// symbol count byte, then 256 symbol gaps and maximal uvarint counts
+const maxCodedTable = 1 + 256*(1+binary.MaxVarintLen64)
+
+// codedTableModel is the fixed model a coded table is compressed with. The
+// symbol gaps of a dense table are mostly zero, the last byte of a count is
+// below 0x80 and more often small than not, and the other bytes of a count
+// are spread evenly over 0x80 to 0xFF.
+var codedTableModel = sync.OnceValues(func() (CodeTable, *Node) {
+	freq := make(FrequencyTable, 256)
+	freq[0] = 4096
+	for i := 1; i < 256; i++ {
+		if i < 0x80 {
+			freq[byte(i)] = 1 + 2048/i
+		} else {
+			freq[byte(i)] = 24
+		}
+	}
+	return BuildCodes(freq)
+})
+
+// appendCoded serializes a frequency table as the uvarint length of a
+// frequency list, then that list Huffman-coded with codedTableModel and
+// padded to a byte. The list is the one appendFrequencies writes, except that
+// each symbol after the first is stored as its gap from the previous one
+// minus one.
+func appendCoded(buf []byte, freq FrequencyTable) ([]byte, error) {
+	if len(freq) == 0 || len(freq) > 256 {
+		return nil, fmt.Errorf("invalid frequency table size %d", len(freq))
+	}
+
+	symbols := make([]int, 0, len(freq))
+	for char := range freq {
+		symbols = append(symbols, int(char))
+	}
+	sort.Ints(symbols)
+
+	list := []byte{byte(len(freq) - 1)}
+	prev := -1
+	for _, char := range symbols {
+		list = append(list, byte(char-prev-1))
+		list = binary.AppendUvarint(list, uint64(freq[byte(char)]))
+		prev = char
+	}
+
+	codes, _ := codedTableModel()
+	w := bitWriter{buf: binary.AppendUvarint(buf, uint64(len(list)))}
+	for _, b := range list {
+		for _, bit := range codes[b] {
+			w.writeBit(byte(bit - '0'))
+		}
+	}
+	return w.buf, nil
+}
+
+// readCoded parses a table written by appendCoded
+func readCoded(br io.ByteReader) (FrequencyTable, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if length < 3 || length > maxCodedTable {
+		return nil, fmt.Errorf("invalid coded table length %d", length)
+	}
+
+	_, root := codedTableModel()
+	r := bitReader{r: br}
+	list := make([]byte, 0, length)
+	for uint64(len(list)) < length {
+		node := root
+		for node.Left != nil {
+			bit, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if bit == 0 {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+		}
+		list = append(list, node.Char)
+	}
+
+	// Turn the gaps back into symbols and parse the plain frequency list
+	lr := bytes.NewReader(list[1:])
+	plain := []byte{list[0]}
+	prev := -1
+	for i := 0; i <= int(list[0]); i++ {
+		gap, err := lr.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("coded table truncated")
+		}
+		prev += int(gap) + 1
+		if prev > 255 {
+			return nil, fmt.Errorf("coded table symbol out of range")
+		}
+		plain = append(plain, byte(prev))
+		count, err := binary.ReadUvarint(lr)
+		if err != nil {
+			return nil, fmt.Errorf("coded table truncated")
+		}
+		plain = binary.AppendUvarint(plain, count)
+	}
+	if lr.Len() != 0 {
+		return nil, fmt.Errorf("coded table has %d trailing bytes", lr.Len())
+	}
+
+	return readFrequencies(bytes.NewReader(plain))
+}
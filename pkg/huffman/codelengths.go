@@ -0,0 +1,114 @@
+package huffman
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// CodeLengths returns the length of each symbol's code, 0 for the symbols
+// without one, which is how DEFLATE's dynamic blocks describe a code. Paired
+// with TreeFromCodeLengths it carries this package's codes into DEFLATE-style
+// encoders and back. DEFLATE limits codes to 15 bits, which only very skewed
+// counts over many symbols exceed.
+func (c CodeTable) CodeLengths() [256]uint8 {
+	var lengths [256]uint8
+	for char, code := range c {
+		lengths[char] = uint8(len(code))
+	}
+	return lengths
+}
+
+// TreeFromCodeLengths builds the tree of the canonical code with the given
+// lengths, as DEFLATE assigns it: shorter codes come first, and codes of the
+// same length count up in symbol order. Its codes differ from those the
+// lengths were taken from but have the same length for every symbol, so data
+// codes to the same size. The lengths must give a complete prefix code, or
+// a single code of length 1, which gives a one-leaf tree as for a single
+// symbol.
+func TreeFromCodeLengths(lengths [256]uint8) (*Node, error) {
+	var count [256]int
+	used := 0
+	for _, length := range lengths {
+		if length > 0 {
+			count[length]++
+			used++
+		}
+	}
+	if used == 0 {
+		return nil, fmt.Errorf("no code lengths")
+	}
+	if used == 1 {
+		if count[1] != 1 {
+			return nil, fmt.Errorf("a single code must have length 1")
+		}
+		for char, length := range lengths {
+			if length > 0 {
+				return &Node{Char: byte(char)}, nil
+			}
+		}
+	}
+
+	// A complete code has a Kraft sum of exactly 1. Lengths up to 255 need
+	// more precision than a float gives.
+	kraft := new(big.Rat)
+	for length, n := range count {
+		if n > 0 {
+			kraft.Add(kraft, new(big.Rat).SetFrac(big.NewInt(int64(n)), new(big.Int).Lsh(big.NewInt(1), uint(length))))
+		}
+	}
+	switch kraft.Cmp(big.NewRat(1, 1)) {
+	case 1:
+		return nil, fmt.Errorf("code lengths are over-subscribed")
+	case -1:
+		return nil, fmt.Errorf("code lengths are incomplete")
+	}
+
+	// Walk the symbols of each length in order, counting up the code
+	root := &Node{}
+	var code []byte
+	for length := 1; length < len(count); length++ {
+		for char, l := range lengths {
+			if int(l) != length {
+				continue
+			}
+			code = nextCanonicalCode(code, length)
+			insertCode(root, code, byte(char))
+		}
+	}
+	return root, nil
+}
+
+// nextCanonicalCode returns the canonical code of the given length after
+// prev: prev plus one, extended with zeros to length. The first code is all
+// zeros.
+func nextCanonicalCode(prev []byte, length int) []byte {
+	code := append([]byte(nil), prev...)
+	if len(code) > 0 {
+		i := len(code) - 1
+		for code[i] == '1' {
+			code[i] = '0'
+			i--
+		}
+		code[i] = '1'
+	}
+	for len(code) < length {
+		code = append(code, '0')
+	}
+	return code
+}
+
+// insertCode adds a leaf for char at the end of code's path from root
+func insertCode(root *Node, code []byte, char byte) {
+	node := root
+	for _, bit := range code {
+		next := &node.Left
+		if bit == '1' {
+			next = &node.Right
+		}
+		if *next == nil {
+			*next = &Node{}
+		}
+		node = *next
+	}
+	node.Char = char
+}
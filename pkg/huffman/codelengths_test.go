@@ -0,0 +1,85 @@
+package huffman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodeLengths(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":        blockTestData(),
+		"all bytes":   allBytes(),
+		"two symbols": []byte("abababbbbb"),
+		"skewed":      append(bytes.Repeat([]byte{'a'}, 1000), "abbcccddddeeeeeffffff"...),
+		"single":      bytes.Repeat([]byte{'z'}, 10),
+	}
+
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			codes, _ := BuildCodes(BuildFrequencyTableFromData(data))
+			lengths := codes.CodeLengths()
+			for i, length := range lengths {
+				if want := len(codes[byte(i)]); int(length) != want {
+					t.Errorf("Symbol %s: expected length %d, got %d", formatByte(byte(i)), want, length)
+				}
+			}
+
+			tree, err := TreeFromCodeLengths(lengths)
+			if err != nil {
+				t.Fatalf("TreeFromCodeLengths failed: %v", err)
+			}
+			canonical := GenerateCodeTable(tree)
+			if canonical.CodeLengths() != lengths {
+				t.Errorf("Canonical codes have different lengths: %v", canonical)
+			}
+
+			// Canonical codes of the same length count up in symbol order
+			var prev string
+			for _, entry := range canonical.Sorted() {
+				if len(entry.Code) == len(prev) && entry.Code <= prev {
+					t.Errorf("Code %s of %s doesn't follow %s", entry.Code, formatByte(entry.Symbol), prev)
+				}
+				prev = entry.Code
+			}
+
+			encoded := EncodeData(data, canonical)
+			if len(encoded) != len(EncodeData(data, codes)) {
+				t.Errorf("Expected canonical codes to give the same size")
+			}
+			var bits int
+			for _, b := range data {
+				bits += len(canonical[b])
+			}
+			decoded, err := DecodeData(encoded, tree, int64(len(data)), (8-bits%8)%8)
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !bytes.Equal(data, decoded) {
+				t.Errorf("Decoded data doesn't match original: %s", describeDiff(data, decoded))
+			}
+		})
+	}
+}
+
+func TestTreeFromCodeLengthsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths map[byte]uint8
+	}{
+		{"empty", nil},
+		{"over-subscribed", map[byte]uint8{'a': 1, 'b': 1, 'c': 1}},
+		{"incomplete", map[byte]uint8{'a': 1, 'b': 2}},
+		{"single long code", map[byte]uint8{'a': 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lengths [256]uint8
+			for char, length := range tt.lengths {
+				lengths[char] = length
+			}
+			if _, err := TreeFromCodeLengths(lengths); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
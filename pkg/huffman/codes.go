@@ -0,0 +1,236 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// ErrExternalCodes is returned when a file written by CompressFileWithCodes is
+// given to a function that can't supply its codes
+var ErrExternalCodes = errors.New("huffman: file was compressed with external codes; use DecompressFileWithCodes")
+
+// CodesID identifies a code table by a CRC-32 of its entries in symbol order.
+// A stream written by CompressFileWithCodes records the ID of its codes so
+// that decoding with different codes fails instead of producing garbage.
+func CodesID(codes CodeTable) uint32 {
+	var buf []byte
+	for _, entry := range codes.Sorted() {
+		buf = append(buf, entry.Symbol, byte(len(entry.Code)))
+		buf = append(buf, entry.Code...)
+	}
+	return crc32.ChecksumIEEE(buf)
+}
+
+// CompressFileWithCodes compresses a file with codes trained elsewhere, such
+// as on a representative sample, for pipelines that compress many files
+// against the same codes. The output has a minimal header holding the size,
+// padding and CodesID of codes but no model, so it must be decompressed with
+// DecompressFileWithCodes and the same tree. codes must be the code table of
+// tree and cover every byte of the input.
+func CompressFileWithCodes(inputPath, outputPath string, codes CodeTable, tree *Node) error {
+	if tree == nil {
+		return fmt.Errorf("invalid Huffman tree")
+	}
+	if CodesID(GenerateCodeTable(tree)) != CodesID(codes) {
+		return fmt.Errorf("codes don't match the tree")
+	}
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	var bits int64
+	for _, b := range data {
+		code, ok := codes[b]
+		if !ok {
+			return fmt.Errorf("no code for byte 0x%02x", b)
+		}
+		bits += int64(len(code))
+	}
+
+	header := &Header{
+		Version:       formatVersion,
+		OriginalSize:  int64(len(data)),
+		PaddingBits:   int((8 - bits%8) % 8),
+		ExternalCodes: true,
+		CodesID:       CodesID(codes),
+	}
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return outputError(outputPath, err)
+	}
+	defer func(output *os.File) {
+		err := output.Close()
+		if err != nil {
+			log.Printf("failed to close output file: %v", err)
+		}
+	}(output)
+
+	if err := writeHeader(output, header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := output.Write(EncodeData(data, codes)); err != nil {
+		return fmt.Errorf("failed to write encoded data: %w", err)
+	}
+
+	return nil
+}
+
+// DecompressFileWithCodes decompresses a file written by CompressFileWithCodes
+// using tree, whose codes must be the ones the file was compressed with
+func DecompressFileWithCodes(inputPath, outputPath string, tree *Node) error {
+	if tree == nil {
+		return fmt.Errorf("invalid Huffman tree")
+	}
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if !header.ExternalCodes {
+		return fmt.Errorf("file has its own model; use DecompressFile")
+	}
+	if id := CodesID(GenerateCodeTable(tree)); id != header.CodesID {
+		return fmt.Errorf("file was compressed with codes %08x, not %08x", header.CodesID, id)
+	}
+
+	encodedData, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	decoded, err := header.newDecoder(encodedData, tree).readAll()
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath, decoded, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// CodesFromFile returns the code table a compressed file was coded with,
+// rebuilt from the model in its header without decoding the payload. The
+// codes can be inspected or passed to CompressFileWithCodes to code related
+// files the same way. An escaped file's table includes the escape symbol, and
+// a case-folded file's table covers the letters in lowercase. A remapped
+// file's table is keyed by the original bytes. Block archives,
+// stored files and files without a model of their own have no single table.
+func CodesFromFile(path string) (CodeTable, error) {
+	if err := checkNotDirectory(path); err != nil {
+		return nil, err
+	}
+	input, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	switch {
+	case header.Encrypted:
+		return nil, ErrEncrypted
+	case header.Blocks != nil:
+		return nil, fmt.Errorf("block archive has a code table per block")
+	case header.Stored:
+		return nil, fmt.Errorf("stored file has no code table")
+	case header.ExternalCodes:
+		return nil, fmt.Errorf("file was compressed with external codes %08x", header.CodesID)
+	}
+
+	tree := header.Root()
+	if tree == nil {
+		return nil, fmt.Errorf("failed to build huffman tree")
+	}
+	codes := GenerateCodeTable(tree)
+	if header.Remap == nil {
+		return codes, nil
+	}
+
+	// A remapped model codes ranks; key the codes by the bytes they stand for
+	table := remapTable(header.Remap)
+	original := make(CodeTable, len(codes))
+	for rank, code := range codes {
+		original[table[rank]] = code
+	}
+	return original, nil
+}
+
+// appendExternalCodes serializes the rest of an external-codes header:
+// [Size:uvarint][Padding:1][CodesID:4]
+func appendExternalCodes(buf []byte, h *Header) []byte {
+	buf = binary.AppendUvarint(buf, uint64(h.OriginalSize))
+	buf = append(buf, byte(h.PaddingBits))
+	return binary.BigEndian.AppendUint32(buf, h.CodesID)
+}
+
+// readExternalCodes parses a header written by appendExternalCodes
+func readExternalCodes(br io.ByteReader, version int) (*Header, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > math.MaxInt64 {
+		return nil, fmt.Errorf("invalid original size %d", size)
+	}
+	paddingBits, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if paddingBits > 7 {
+		return nil, fmt.Errorf("invalid padding %d", paddingBits)
+	}
+	var id [4]byte
+	for i := range id {
+		if id[i], err = br.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Header{
+		Version:       version,
+		OriginalSize:  int64(size),
+		PaddingBits:   int(paddingBits),
+		ExternalCodes: true,
+		CodesID:       binary.BigEndian.Uint32(id[:]),
+	}, nil
+}
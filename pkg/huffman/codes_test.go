@@ -0,0 +1,130 @@
+package huffman
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCodesFromFile(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	topK, _ := topK(data, 6)
+	_, remappedFreq, remap := remapBytes(data, BuildFrequencyTableFromData(data))
+
+	tests := []struct {
+		name  string
+		opts  Options
+		freq  FrequencyTable
+		remap []byte
+	}{
+		{"frequencies", Options{Table: TableFrequencies}, BuildFrequencyTableFromData(data), nil},
+		{"tree", Options{Table: TableTree}, BuildFrequencyTableFromData(data), nil},
+		{"auto", Options{}, BuildFrequencyTableFromData(data), nil},
+		{"legacy", Options{Legacy: true}, BuildFrequencyTableFromData(data), nil},
+		{"escaped", Options{TopK: 6}, topK, nil},
+		{"remap", Options{Remap: true}, remappedFreq, remap},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.name+".huf")
+			if err := CompressFileWithOptions(inputPath, compressedPath, tt.opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			codes, err := CodesFromFile(compressedPath)
+			if err != nil {
+				t.Fatalf("CodesFromFile error: %v", err)
+			}
+			want, _ := BuildCodes(tt.freq)
+			if tt.remap != nil {
+				// The codes of the ranks belong to the bytes they stand for
+				byRank := want
+				want = make(CodeTable, len(byRank))
+				for rank, code := range byRank {
+					want[tt.remap[rank]] = code
+				}
+			}
+			if !reflect.DeepEqual(want, codes) {
+				t.Errorf("Expected the codes used to compress %v, got %v", want, codes)
+			}
+		})
+	}
+
+	// ReadHeader's bare table would count ranks as if they were bytes
+	remapFile, err := os.Open(filepath.Join(tmpDir, "remap.huf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remapFile.Close()
+	if _, _, _, err := ReadHeader(remapFile); err == nil {
+		t.Error("Expected ReadHeader to reject a remapped header")
+	}
+
+	archivePath := writeBlockArchive(t, data, ParallelOptions{BlockSize: 1000})
+	if _, err := CodesFromFile(archivePath); err == nil {
+		t.Error("Expected an error for a block archive")
+	}
+}
+
+func TestExternalCodesRejected(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	codes, tree := BuildCodes(BuildFrequencyTableFromData(data))
+	if err := CompressFileWithCodes(inputPath, compressedPath, codes, tree); err != nil {
+		t.Fatalf("CompressFileWithCodes error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		decode func() error
+	}{
+		{"DecompressFile", func() error {
+			return DecompressFile(compressedPath, filepath.Join(tmpDir, "file.out"))
+		}},
+		{"Decompress", func() error {
+			f, err := os.Open(compressedPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return Decompress(f, io.Discard)
+		}},
+		{"DecompressToFileMmap", func() error {
+			return DecompressToFileMmap(compressedPath, filepath.Join(tmpDir, "mmap.out"))
+		}},
+		{"DecompressHead", func() error {
+			return DecompressHead(compressedPath, 10, io.Discard)
+		}},
+		{"NewReader", func() error {
+			f, err := os.Open(compressedPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = NewReader(f)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.decode(); !errors.Is(err, ErrExternalCodes) {
+				t.Errorf("Expected ErrExternalCodes, got %v", err)
+			}
+		})
+	}
+}
@@ -1,72 +1,573 @@
 package huffman
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"time"
 )
 
+// ErrIsDirectory is returned when a directory is given where a file is
+// expected. Compress the files inside it one at a time instead.
+var ErrIsDirectory = errors.New("huffman: path is a directory, not a file")
+
+// checkNotDirectory returns ErrIsDirectory if path is a directory. Other stat
+// errors are left for the caller's open to report.
+func checkNotDirectory(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("%s: %w", path, ErrIsDirectory)
+	}
+	return nil
+}
+
+// ErrPermissionDenied is returned when the output file can't be created for
+// lack of permission, such as in a read-only directory
+var ErrPermissionDenied = errors.New("huffman: permission denied creating the output file")
+
+// outputError describes a failure to create the output file at path, as
+// ErrPermissionDenied for a permission error
+func outputError(path string, err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%s: %w", path, ErrPermissionDenied)
+	}
+	return fmt.Errorf("failed to create output file: %w", err)
+}
+
+// ErrChecksumMismatch is returned when decompressed data doesn't match the
+// checksum stored in its header
+var ErrChecksumMismatch = errors.New("huffman: decompressed data does not match the stored checksum")
+
+// ErrSameFile is returned when the input and output paths name the same file,
+// which creating the output would truncate before it was read
+var ErrSameFile = errors.New("huffman: input and output are the same file")
+
+// checkNotSameFile returns ErrSameFile if inputPath and outputPath resolve to
+// the same file. An output that doesn't exist yet can't be the input.
+func checkNotSameFile(inputPath, outputPath string) error {
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return nil
+	}
+	outputInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return nil
+	}
+	if os.SameFile(inputInfo, outputInfo) {
+		return fmt.Errorf("%s and %s: %w", inputPath, outputPath, ErrSameFile)
+	}
+	return nil
+}
+
 // CompressFile compresses a file using Huffman encoding
 func CompressFile(inputPath, outputPath string) error {
-	// Step 1: Build frequency table
-	freq, err := BuildFrequencyTable(inputPath)
+	_, err := CompressFileResult(inputPath, outputPath)
+	return err
+}
+
+// CompressFileWithOptions compresses a file using Huffman encoding, configured
+// by opts
+func CompressFileWithOptions(inputPath, outputPath string, opts Options) error {
+	_, err := CompressFileResultWithOptions(inputPath, outputPath, opts)
+	return err
+}
+
+// CompressFileResultWithOptions compresses a file like CompressFileWithOptions
+// and reports the sizes involved like CompressFileResult. The input is read
+// once. Inputs over 256MB are copied to a temporary file as they are read and
+// encoded from the copy a chunk at a time rather than held in memory, unless
+// opts stores the input or sets FoldCase, Remap, TopK or VerifyAfterCompress,
+// which need all of it at once.
+func CompressFileResultWithOptions(inputPath, outputPath string, opts Options) (Result, error) {
+	start := time.Now()
+
+	if err := checkNotDirectory(inputPath); err != nil {
+		return Result{}, err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return Result{}, err
+	}
+
+	input, err := openInput(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to build frequency table: %w", err)
+		return Result{}, fmt.Errorf("failed to read input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			opts.Diagnostics.report(DiagCloseError, "failed to close input file: %v", err)
+		}
+	}(input)
+	info, err := input.Stat()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read input file: %w", err)
 	}
 
-	// Step 2: Build a Huffman tree
-	tree := BuildHuffmanTree(freq)
-	if tree == nil {
-		return fmt.Errorf("failed to build huffman tree")
+	// Read the file once, hashing it on the way in, and count and encode
+	// from the same buffer, or from a temporary copy if it is too large to
+	// hold in memory
+	sha := sha256.New()
+	crc := crc32.NewIEEE()
+	var progress *compressProgress
+	if opts.Progress != nil {
+		progress = &compressProgress{cb: opts.Progress}
 	}
+	r := io.TeeReader(progress.reader(input, info.Size()), io.MultiWriter(sha, crc))
 
-	// Step 3: Generate code table
-	codes := GenerateCodeTable(tree)
+	var size int64
+	var counts byteCounts
+	var freq FrequencyTable
+	var compressedSize int64
+	if canSpill(opts) && info.Size() > spillThreshold {
+		spill, err := spillInput(r, opts.SampleEvery, opts.Diagnostics)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to read input file: %w", err)
+		}
+		defer spill.remove(opts.Diagnostics)
+		size, counts = spill.size, spill.counts
+		progress.read(size)
+		if size == 0 {
+			return Result{}, fmt.Errorf("failed to build frequency table: empty file")
+		}
 
-	// Read original file data
-	data, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to read input file: %w", err)
+		// Step 1: Build frequency table
+		freq = spill.frequencies(opts.SampleEvery)
+
+		// Step 5: Write a compressed file
+		compressedSize, err = writeSpilledFile(outputPath, spill, freq, opts, crc.Sum32(), progress.encoded(size))
+		if err != nil {
+			return Result{}, err
+		}
+	} else {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to read input file: %w", err)
+		}
+		if len(data) == 0 {
+			return Result{}, fmt.Errorf("failed to build frequency table: empty file")
+		}
+		size = int64(len(data))
+		progress.read(size)
+		counts.add(data)
+
+		// Step 1: Build frequency table
+		if opts.SampleEvery > 1 {
+			freq = sampleFrequencies(data, opts.SampleEvery)
+			addMissingSymbols(freq, data)
+		} else {
+			freq = counts.table()
+		}
+
+		// Step 5: Write a compressed file
+		compressedSize, err = writeCompressedFile(outputPath, data, freq, opts, crc.Sum32(), progress.encoded(size))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if !opts.Store {
+		opts.Diagnostics.reportRatio(size, compressedSize)
 	}
+	progress.finish()
 
-	// Step 4: Encode data
-	encoded := EncodeData(data, codes)
+	version := formatVersion
+	if opts.Legacy {
+		version = 0
+	}
+	result := Result{
+		OriginalSize:        size,
+		CompressedSize:      compressedSize,
+		DistinctSymbols:     len(counts.table()),
+		TheoreticalMinBytes: TheoreticalMinBytes(freq, size),
+		Duration:            time.Since(start),
+		InputPath:           inputPath,
+		OutputPath:          outputPath,
+		FormatVersion:       version,
+		SHA256:              hex.EncodeToString(sha.Sum(nil)),
+	}
+	result.Ratio = float64(result.CompressedSize) / float64(result.OriginalSize)
+	return result, nil
+}
 
-	// Calculate padding bits
-	totalBits := 0
-	for _, b := range data {
-		totalBits += len(codes[b])
+// writeCompressedFile writes data compressed with freq to path, returning the
+// number of bytes written, and checks it decompresses to data if
+// opts.VerifyAfterCompress is set. progress, if not nil, is called with the
+// number of input bytes encoded so far.
+func writeCompressedFile(path string, data []byte, freq FrequencyTable, opts Options, checksum uint32, progress func(encoded int64)) (n int64, err error) {
+	output, err := createOutput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = output.finish(err, opts.Diagnostics) }()
+
+	counter := &countingWriter{w: output}
+	if err := writeCompressedChecksum(counter, data, freq, opts, checksum, progress); err != nil {
+		return counter.n, err
 	}
-	paddingBits := (8 - (totalBits % 8)) % 8
+	if opts.VerifyAfterCompress {
+		if err := verifyRoundTrip(output.Name(), data); err != nil {
+			return counter.n, err
+		}
+	}
+	return counter.n, nil
+}
+
+// ErrRoundTripFailed is returned by a compression with VerifyAfterCompress
+// whose output doesn't decompress to the input
+var ErrRoundTripFailed = errors.New("huffman: compressed output does not decompress to the input")
 
-	// Step 5: Write a compressed file
-	output, err := os.Create(outputPath)
+// roundTripFault lets tests corrupt the data verifyRoundTrip decoded
+var roundTripFault func(decoded []byte) []byte
+
+// verifyRoundTrip decompresses the file at path in memory and compares the
+// result with original
+func verifyRoundTrip(path string, original []byte) error {
+	compressed, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return fmt.Errorf("failed to read output file for verification: %w", err)
 	}
-	defer func(output *os.File) {
-		err := output.Close()
-		if err != nil {
-			log.Printf("failed to close output file: %v", err)
+	_, decoded, err := readCompressed(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRoundTripFailed, err)
+	}
+	if roundTripFault != nil {
+		decoded = roundTripFault(decoded)
+	}
+	if !bytes.Equal(original, decoded) {
+		return ErrRoundTripFailed
+	}
+	return nil
+}
+
+// openInput opens input files for CompressFileResultWithOptions; tests
+// replace it to count the opens
+var openInput = os.Open
+
+// writeCompressed encodes data with the Huffman tree for freq and writes the
+// header and payload to w
+func writeCompressed(w io.Writer, data []byte, freq FrequencyTable, opts Options) error {
+	var checksum uint32
+	if opts.Checksum || opts.Trailer {
+		checksum = crc32.ChecksumIEEE(data)
+	}
+	return writeCompressedChecksum(w, data, freq, opts, checksum, nil)
+}
+
+// writeCompressedChecksum is writeCompressed for a caller that already has
+// the CRC-32 of data, used if opts.Checksum or opts.Trailer is set. progress,
+// if not nil, is called as the input is encoded.
+func writeCompressedChecksum(w io.Writer, data []byte, freq FrequencyTable, opts Options, checksum uint32, progress func(encoded int64)) error {
+	if opts.Store {
+		if err := validateOptions(opts); err != nil {
+			return err
 		}
-	}(output)
+		return writeStored(w, data, opts)
+	}
+
+	plan, err := planCompressed(data, freq, opts, checksum)
+	if err != nil {
+		return err
+	}
+
+	// Fall back before writing anything if coding would expand the input
+	if opts.StoreIfLarger && plan.size() > storedSize(int64(len(data)), opts) {
+		return writeStored(w, data, opts)
+	}
+
+	// Step 4: Encode data
+	var encoded []byte
+	if progress != nil || plan.escape >= 0 {
+		encoded, _ = encodeEscaped(plan.data, plan.codes, plan.escape, progress)
+	} else {
+		encoded = EncodeData(plan.data, plan.codes)
+	}
 
 	// Write Header
-	if err := WriteHeader(output, freq, int64(len(data)), paddingBits); err != nil {
+	if _, err := w.Write(plan.header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
 	// Write encoded data
-	if _, err := output.Write(encoded); err != nil {
+	if _, err := w.Write(encoded); err != nil {
 		return fmt.Errorf("failed to write encoded data: %w", err)
 	}
 
+	return plan.writeEnd(w, int64(len(data)), checksum)
+}
+
+// validateOptions checks opts for invalid values and combinations
+func validateOptions(opts Options) error {
+	if opts.PadTo < 0 {
+		return fmt.Errorf("invalid PadTo %d", opts.PadTo)
+	}
+	if opts.TopK < 0 {
+		return fmt.Errorf("invalid TopK %d", opts.TopK)
+	}
+	if opts.Legacy && (opts.Store || opts.PadTo > 1 || opts.OmitSize || opts.TopK > 0 || opts.DeltaBase != 0 || opts.FoldCase || opts.Checksum || opts.StoreIfLarger || opts.RecordPayloadLength) {
+		return fmt.Errorf("the legacy format does not support Store, PadTo, OmitSize, TopK, DeltaBase, FoldCase, Checksum, StoreIfLarger or RecordPayloadLength")
+	}
+	if opts.Remap && (opts.Legacy || opts.TopK > 0 || opts.DeltaBase != 0 || opts.FoldCase) {
+		return fmt.Errorf("Remap cannot be combined with Legacy, TopK, DeltaBase or FoldCase")
+	}
+	if (opts.Store || opts.StoreIfLarger) && opts.Checksum {
+		return fmt.Errorf("Checksum cannot be combined with Store or StoreIfLarger")
+	}
+	if opts.Trailer && (opts.Legacy || opts.Store || opts.StoreIfLarger || opts.PadTo > 1) {
+		return fmt.Errorf("Trailer cannot be combined with Legacy, Store, StoreIfLarger or PadTo")
+	}
+	if opts.DeltaBase != 0 {
+		if opts.Table != TableAuto {
+			return fmt.Errorf("DeltaBase cannot be combined with table format %v", opts.Table)
+		}
+		if opts.DeltaBase.Table() == nil {
+			return fmt.Errorf("unknown base model %v", opts.DeltaBase)
+		}
+	}
+	return nil
+}
+
+// compressedPlan holds everything needed to write a coded stream except the
+// payload itself, whose size is known before it is encoded
+type compressedPlan struct {
+	// header is the serialized header
+	header []byte
+	// data is the input as it is coded, after case folding or remapping
+	data   []byte
+	codes  CodeTable
+	escape int
+	// bits is the length of the payload in bits
+	bits    int64
+	padTo   int
+	trailer bool
+}
+
+// planCompressed builds the model and header for coding data with opts
+func planCompressed(data []byte, freq FrequencyTable, opts Options, checksum uint32) (*compressedPlan, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, err
+	}
+	var caseRuns []uint64
+	if opts.FoldCase {
+		data, caseRuns = foldCase(data)
+		freq = foldFrequencies(freq)
+	}
+
+	var remap []byte
+	if opts.Remap {
+		data, freq, remap = remapBytes(data, freq)
+	}
+
+	escape := -1
+	if opts.TopK > 0 {
+		freq, escape = topK(data, opts.TopK)
+	}
+
+	var counts byteCounts
+	counts.add(data)
+	plan, err := planCounts(&counts, freq, opts, checksum, escape, caseRuns, remap)
+	if err != nil {
+		return nil, err
+	}
+	plan.data = data
+	return plan, nil
+}
+
+// planCounts builds the model and header for coding input whose byte values
+// occur counts times, once planCompressed has applied the options that
+// transform the input, which leave escape, caseRuns and remap. The plan's
+// data is left for the caller to set.
+func planCounts(counts *byteCounts, freq FrequencyTable, opts Options, checksum uint32, escape int, caseRuns []uint64, remap []byte) (*compressedPlan, error) {
+	table := opts.Table
+	if opts.DeltaBase != 0 {
+		table = TableDelta
+		freq = deltaModel(freq, opts.DeltaBase.Table())
+	} else if opts.Quantize {
+		freq = QuantizeFrequencies(freq)
+	}
+	// Last, as a delta table drops a zero count and quantizing raises it.
+	// A delta model keeps the base's symbols, so it is never left with one.
+	if opts.TwoLeafSingleSymbol && len(freq) == 1 {
+		freq = addUnusedSymbol(freq)
+	}
+
+	// Steps 2 and 3: Build a Huffman tree and generate its code table
+	codes, tree := BuildCodes(freq)
+	if tree == nil {
+		return nil, fmt.Errorf("failed to build huffman tree")
+	}
+
+	// The header only needs the payload's padding, so it can be built
+	// before the payload is encoded
+	var size int64
+	for _, count := range counts {
+		size += int64(count)
+	}
+	bits := countedBits(counts, codes, escape)
+	paddingBits := int((8 - bits%8) % 8)
+
+	header := newHeader(freq, tree, size, paddingBits, table)
+	header.Base = opts.DeltaBase
+	header.Aligned = opts.PadTo > 1
+	header.NoSize = opts.OmitSize && (tree.Left != nil || tree.Right != nil)
+	header.Escaped, header.Escape = escape >= 0, byte(escape)
+	header.CaseRuns = caseRuns
+	header.Remap = remap
+	header.Checksummed, header.Checksum = opts.Checksum, checksum
+	header.InfoTrailer = opts.Trailer
+	if opts.RecordPayloadLength {
+		header.recordPayloadBits(bits, table == TableAuto)
+	}
+	var headerBytes []byte
+	var err error
+	if opts.Legacy {
+		headerBytes, err = appendLegacyHeader(nil, header)
+	} else {
+		headerBytes, err = appendHeader(nil, header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return &compressedPlan{
+		header:  headerBytes,
+		codes:   codes,
+		escape:  escape,
+		bits:    bits,
+		padTo:   opts.PadTo,
+		trailer: opts.Trailer,
+	}, nil
+}
+
+// size returns the exact number of bytes the planned stream takes
+func (p *compressedPlan) size() int64 {
+	n := int64(len(p.header)) + (p.bits+7)/8
+	if p.padTo > 1 {
+		n += int64(len(alignmentPad(n, p.padTo)))
+	}
+	if p.trailer {
+		n += infoTrailerSize
+	}
+	return n
+}
+
+// writeEnd writes what follows the payload of the planned stream: the
+// alignment padding and the info trailer for size bytes of input with the
+// given checksum
+func (p *compressedPlan) writeEnd(w io.Writer, size int64, checksum uint32) error {
+	if p.padTo > 1 {
+		pad := alignmentPad(int64(len(p.header))+(p.bits+7)/8, p.padTo)
+		if _, err := w.Write(pad); err != nil {
+			return fmt.Errorf("failed to write alignment padding: %w", err)
+		}
+	}
+
+	if p.trailer {
+		info := TrailerInfo{Version: formatVersion, OriginalSize: size, Checksum: checksum}
+		if _, err := w.Write(appendInfoTrailer(nil, info)); err != nil {
+			return fmt.Errorf("failed to write info trailer: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// encodedBits returns the length in bits of data coded with codes. With an
+// escape symbol, bytes outside the model cost the escape code and a literal.
+func encodedBits(data []byte, codes CodeTable, escape int) int64 {
+	var counts byteCounts
+	counts.add(data)
+	return countedBits(&counts, codes, escape)
+}
+
+// countedBits is encodedBits for input whose byte values occur counts times
+func countedBits(counts *byteCounts, codes CodeTable, escape int) int64 {
+	var bits int64
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		code, ok := codes[byte(i)]
+		cost := int64(len(code))
+		if escape >= 0 && (!ok || i == escape) {
+			cost = int64(len(codes[byte(escape)])) + 8
+		}
+		bits += int64(count) * cost
+	}
+	return bits
+}
+
+// addUnusedSymbol returns a copy of a single-symbol table with a second
+// symbol, the next byte value, whose count of zero means it is never coded
+func addUnusedSymbol(freq FrequencyTable) FrequencyTable {
+	padded := make(FrequencyTable, 2)
+	for char, count := range freq {
+		padded[char] = count
+		padded[char+1] = 0
+	}
+	return padded
+}
+
+// storedHeader returns the header of a stored stream written with opts
+func storedHeader(opts Options) *Header {
+	return &Header{Version: formatVersion, Stored: true, Aligned: opts.PadTo > 1}
+}
+
+// storedSize returns the exact number of bytes writeStored takes for size
+// bytes of input
+func storedSize(size int64, opts Options) int64 {
+	headerBytes, _ := appendHeader(nil, storedHeader(opts))
+	n := int64(len(headerBytes)) + size
+	if opts.PadTo > 1 {
+		n += int64(len(alignmentPad(n, opts.PadTo)))
+	}
+	return n
+}
+
+// writeStored writes data uncompressed behind a stored header
+func writeStored(w io.Writer, data []byte, opts Options) error {
+	header := storedHeader(opts)
+	headerBytes, err := appendHeader(nil, header)
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := w.Write(headerBytes); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write stored data: %w", err)
+	}
+
+	if header.Aligned {
+		pad := alignmentPad(int64(len(headerBytes)+len(data)), opts.PadTo)
+		if _, err := w.Write(pad); err != nil {
+			return fmt.Errorf("failed to write alignment padding: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// DecompressFile decompresses a Huffman encoded file
+// DecompressFile decompresses a Huffman encoded file. A file already at
+// outputPath is only replaced once the output is complete.
 func DecompressFile(inputPath, outputPath string) error {
+	return DecompressFileWithOptions(inputPath, outputPath, DecompressOptions{})
+}
+
+// DecompressFileWithOptions decompresses a Huffman encoded file as configured
+// by opts
+func DecompressFileWithOptions(inputPath, outputPath string, opts DecompressOptions) error {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
 	// Open the input file
 	input, err := os.Open(inputPath)
 	if err != nil {
@@ -75,37 +576,141 @@ func DecompressFile(inputPath, outputPath string) error {
 	defer func(input *os.File) {
 		err := input.Close()
 		if err != nil {
-			log.Printf("failed to close input file: %v", err)
+			opts.Diagnostics.report(DiagCloseError, "failed to close input file: %v", err)
 		}
 	}(input)
 
+	if opts.Sparse {
+		var decoded bytes.Buffer
+		if err := decompress(input, &decoded, opts); err != nil {
+			return err
+		}
+		return writeSparseFile(outputPath, decoded.Bytes(), opts.Diagnostics)
+	}
+
+	return decompressToFile(input, outputPath, opts)
+}
+
+// decompressToFile streams the decoded bytes of r into a new file at
+// outputPath. A checksum in the header is verified as the bytes are written,
+// so the output is never held in memory; if decoding or the checksum fails the
+// partial output is removed and a file already at outputPath is left as it
+// was.
+func decompressToFile(r io.Reader, outputPath string, opts DecompressOptions) (err error) {
+	output, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer func() { err = output.finish(err, opts.Diagnostics) }()
+
+	return decompress(r, output, opts)
+}
+
+// readCompressed parses the header from r and decodes the payload after it
+func readCompressed(r io.Reader) (*Header, []byte, error) {
 	// Step 6: Read header
-	freq, originalSize, paddingBits, err := ReadHeader(input)
+	header, err := ParseHeader(r)
 	if err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if header.Encrypted {
+		return nil, nil, ErrEncrypted
+	}
+	if header.Blocks != nil {
+		var buf bytes.Buffer
+		if err := decodeBlocks(r, header, &buf); err != nil {
+			return nil, nil, err
+		}
+		return header, buf.Bytes(), nil
+	}
+	if header.Lines != nil {
+		var buf bytes.Buffer
+		if err := decodeLines(r, header, &buf); err != nil {
+			return nil, nil, err
+		}
+		return header, buf.Bytes(), nil
+	}
+
+	if header.Stored {
+		stored, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read stored data: %w", err)
+		}
+		stored, err = splitTrailer(header, stored)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read trailer: %w", err)
+		}
+		header.OriginalSize = int64(len(stored))
+		return header, stored, nil
+	}
+
+	if header.ExternalCodes {
+		return nil, nil, ErrExternalCodes
 	}
 
 	// Rebuild Huffman tree
-	tree := BuildHuffmanTree(freq)
+	tree := header.Root()
 	if tree == nil {
-		return fmt.Errorf("failed to build huffman tree")
+		return nil, nil, fmt.Errorf("failed to build huffman tree")
 	}
 
 	// Step 7: Read and decode compressed data
-	encodedData, err := io.ReadAll(input)
+	encodedData, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to read encoded data: %w", err)
+		return nil, nil, fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	encodedData, err = splitTrailer(header, encodedData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read trailer: %w", err)
 	}
 
-	decoded, err := DecodeData(encodedData, tree, originalSize, paddingBits)
+	decoded, err := header.newDecoder(encodedData, tree).readAll()
 	if err != nil {
-		return fmt.Errorf("failed to decode data: %w", err)
+		return nil, nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	if header.NoSize {
+		header.OriginalSize = int64(len(decoded))
+	}
+	if header.Checksummed && crc32.ChecksumIEEE(decoded) != header.Checksum {
+		return nil, nil, ErrChecksumMismatch
 	}
 
-	// Write decoded data
-	if err := os.WriteFile(outputPath, decoded, 0644); err != nil {
-		return fmt.Errorf("failed to write output file: %w", err)
+	return header, decoded, nil
+}
+
+// Recompress decompresses a file written in any supported format version and
+// compresses it again in the current format. The decoded data is checked
+// against the original size recorded in the old header before anything is
+// written.
+func Recompress(inputPath, outputPath string) (err error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
 	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
 
-	return nil
+	header, decoded, err := readCompressed(input)
+	if err != nil {
+		return err
+	}
+	if int64(len(decoded)) != header.OriginalSize {
+		return fmt.Errorf("decoded %d bytes, header records %d", len(decoded), header.OriginalSize)
+	}
+	if len(decoded) == 0 {
+		return fmt.Errorf("empty file")
+	}
+
+	output, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	defer func() { err = output.finish(err, nil) }()
+
+	return writeCompressed(output, decoded, BuildFrequencyTableFromData(decoded), Options{})
 }
@@ -0,0 +1,100 @@
+package huffman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Dedup block tags, each followed by the block's bytes or by the uvarint
+// index of the earlier block it repeats
+const (
+	dedupLiteral = 0
+	dedupRef     = 1
+)
+
+// CompressDedup compresses data that has large repeated regions. It first
+// splits data into blockSize-byte blocks and replaces every block equal to an
+// earlier one with a reference to it, found by the blocks' SHA-256 hashes,
+// then Huffman-codes the result. Only whole aligned blocks are matched, so
+// this is a bounded LZ-like layer rather than a general one. The output
+// decodes with DecompressDedup.
+func CompressDedup(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty input")
+	}
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	stream := binary.AppendUvarint(nil, uint64(blockSize))
+	seen := make(map[[sha256.Size]byte]int)
+	for i := 0; i*blockSize < len(data); i++ {
+		block := data[i*blockSize : min((i+1)*blockSize, len(data))]
+		sum := sha256.Sum256(block)
+		j, ok := seen[sum]
+		if ok && bytes.Equal(block, dedupBlock(data, j, blockSize)) {
+			stream = append(stream, dedupRef)
+			stream = binary.AppendUvarint(stream, uint64(j))
+			continue
+		}
+		if !ok {
+			seen[sum] = i
+		}
+		stream = append(stream, dedupLiteral)
+		stream = append(stream, block...)
+	}
+
+	var out bytes.Buffer
+	if err := writeCompressed(&out, stream, BuildFrequencyTableFromData(stream), Options{}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// DecompressDedup decodes data written by CompressDedup
+func DecompressDedup(compressed []byte) ([]byte, error) {
+	_, stream, err := readCompressed(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+
+	size, n := binary.Uvarint(stream)
+	if n <= 0 || size == 0 || size > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid dedup block size")
+	}
+	blockSize := int(size)
+	stream = stream[n:]
+
+	var result []byte
+	for blocks := 0; len(stream) > 0; blocks++ {
+		tag := stream[0]
+		stream = stream[1:]
+		switch tag {
+		case dedupLiteral:
+			// Only the last block may be short, so every block a reference
+			// can name is whole
+			length := min(blockSize, len(stream))
+			result = append(result, stream[:length]...)
+			stream = stream[length:]
+		case dedupRef:
+			j, n := binary.Uvarint(stream)
+			if n <= 0 || j >= uint64(blocks) {
+				return nil, fmt.Errorf("invalid reference in dedup block %d", blocks)
+			}
+			stream = stream[n:]
+			result = append(result, dedupBlock(result, int(j), blockSize)...)
+		default:
+			return nil, fmt.Errorf("invalid tag 0x%02X in dedup block %d", tag, blocks)
+		}
+	}
+
+	return result, nil
+}
+
+// dedupBlock returns block i of data
+func dedupBlock(data []byte, i, blockSize int) []byte {
+	return data[i*blockSize : min((i+1)*blockSize, len(data))]
+}
@@ -0,0 +1,81 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressDedupRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	blocks := make([][]byte, 4)
+	for i := range blocks {
+		blocks[i] = make([]byte, 1024)
+		rng.Read(blocks[i])
+	}
+	var repeated []byte
+	for i := 0; i < 32; i++ {
+		repeated = append(repeated, blocks[rng.Intn(len(blocks))]...)
+	}
+	// A short tail that is not a whole block
+	repeated = append(repeated, blocks[0][:100]...)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		blockSize int
+	}{
+		{"repeated blocks", repeated, 1024},
+		{"unaligned block size", repeated, 1000},
+		{"text", blockTestData(), 64},
+		{"single symbol", bytes.Repeat([]byte("z"), 5000), 512},
+		{"shorter than a block", []byte("short"), 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := CompressDedup(tt.data, tt.blockSize)
+			if err != nil {
+				t.Fatalf("CompressDedup error: %v", err)
+			}
+			decoded, err := DecompressDedup(compressed)
+			if err != nil {
+				t.Fatalf("DecompressDedup error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decoded))
+			}
+		})
+	}
+
+	// Random blocks don't compress on their own, so only deduplication helps
+	dedup, err := CompressDedup(repeated, 1024)
+	if err != nil {
+		t.Fatalf("CompressDedup error: %v", err)
+	}
+	var plain bytes.Buffer
+	if err := writeCompressed(&plain, repeated, BuildFrequencyTableFromData(repeated), Options{}); err != nil {
+		t.Fatalf("writeCompressed error: %v", err)
+	}
+	if len(dedup)*4 > plain.Len() {
+		t.Errorf("Expected deduplication to shrink the output well below %d bytes, got %d", plain.Len(), len(dedup))
+	}
+}
+
+func TestCompressDedupInvalid(t *testing.T) {
+	if _, err := CompressDedup(nil, 1024); err == nil {
+		t.Error("Expected an error for empty input")
+	}
+	if _, err := CompressDedup([]byte("abc"), 0); err == nil {
+		t.Error("Expected an error for a zero block size")
+	}
+
+	var bad bytes.Buffer
+	stream := []byte{4, dedupRef, 0}
+	if err := writeCompressed(&bad, stream, BuildFrequencyTableFromData(stream), Options{}); err != nil {
+		t.Fatalf("writeCompressed error: %v", err)
+	}
+	if _, err := DecompressDedup(bad.Bytes()); err == nil {
+		t.Error("Expected an error for a reference to a block not yet seen")
+	}
+}
@@ -0,0 +1,154 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// BaseModel names a built-in frequency table that a TableDelta header stores
+// its model against. Its value is written to the header, so existing values
+// must never change.
+type BaseModel uint8
+
+const (
+	// EnglishTextModel holds typical counts for English prose, scaled so
+	// the space is 255
+	EnglishTextModel BaseModel = iota + 1
+)
+
+// baseModels holds the tables of the built-in base models
+var baseModels = map[BaseModel]FrequencyTable{
+	EnglishTextModel: {
+		' ': 255, 'e': 142, 't': 102, 'a': 92, 'o': 85, 'i': 79, 'n': 79,
+		's': 72, 'h': 69, 'r': 68, 'd': 48, 'l': 45, 'u': 31, 'c': 31,
+		'm': 28, 'w': 27, 'f': 25, 'g': 23, 'y': 23, 'p': 21, 'b': 17,
+		',': 14, '.': 14, 'v': 11, 'k': 9, '\n': 7, 'T': 4, 'I': 4,
+		'A': 3, 'S': 3, '\'': 3, 'H': 3, 'x': 2, 'W': 2, 'M': 2, 'B': 2,
+		'"': 2, '-': 2, 'j': 1, 'q': 1, 'z': 1, 'C': 1, 'E': 1, 'O': 1,
+		'N': 1, 'P': 1, 'L': 1, 'D': 1, 'F': 1, 'G': 1, 'R': 1, 'Y': 1,
+		'?': 1, '!': 1, ';': 1, ':': 1,
+	},
+}
+
+// Table returns a copy of the counts of the base model, or nil if it is not
+// a known model
+func (b BaseModel) Table() FrequencyTable {
+	base, ok := baseModels[b]
+	if !ok {
+		return nil
+	}
+	table := make(FrequencyTable, len(base))
+	for char, count := range base {
+		table[char] = count
+	}
+	return table
+}
+
+// String returns the name of the base model
+func (b BaseModel) String() string {
+	switch b {
+	case EnglishTextModel:
+		return "english"
+	}
+	return fmt.Sprintf("BaseModel(%d)", uint8(b))
+}
+
+// deltaModel returns the table a delta header stores for freq: the counts
+// quantized to the scale of the base, with base symbols that freq lacks kept
+// at their base count. Keeping them costs a little code space but nothing in
+// the header, where they would otherwise each need an entry.
+func deltaModel(freq FrequencyTable, base FrequencyTable) FrequencyTable {
+	model := QuantizeFrequencies(freq)
+	for char, count := range base {
+		if _, ok := model[char]; !ok {
+			model[char] = count
+		}
+	}
+	return model
+}
+
+// appendDelta serializes freq as the base model id, the number of symbols
+// whose count differs from base, then each such symbol and its signed varint
+// difference. A difference that brings a count to zero removes the symbol.
+func appendDelta(buf []byte, freq FrequencyTable, b BaseModel) ([]byte, error) {
+	base, ok := baseModels[b]
+	if !ok {
+		return nil, fmt.Errorf("unknown base model %v", b)
+	}
+
+	type change struct {
+		symbol byte
+		delta  int
+	}
+	var changes []change
+	for i := 0; i < 256; i++ {
+		if delta := freq[byte(i)] - base[byte(i)]; delta != 0 {
+			changes = append(changes, change{byte(i), delta})
+		}
+	}
+
+	buf = append(buf, byte(b))
+	buf = binary.AppendUvarint(buf, uint64(len(changes)))
+	for _, c := range changes {
+		buf = append(buf, c.symbol)
+		buf = binary.AppendVarint(buf, int64(c.delta))
+	}
+	return buf, nil
+}
+
+// readDelta parses a table written by appendDelta
+func readDelta(br io.ByteReader) (BaseModel, FrequencyTable, error) {
+	id, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	b := BaseModel(id)
+	freq := b.Table()
+	if freq == nil {
+		return 0, nil, fmt.Errorf("unknown base model %v", b)
+	}
+
+	changes, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	if changes > 256 {
+		return 0, nil, fmt.Errorf("invalid delta count %d", changes)
+	}
+	if err := need(br, changes, 2, "deltas"); err != nil {
+		return 0, nil, err
+	}
+
+	seen := make(map[byte]bool)
+	for i := uint64(0); i < changes; i++ {
+		char, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if seen[char] {
+			return 0, nil, fmt.Errorf("duplicate symbol 0x%02x in deltas", char)
+		}
+		seen[char] = true
+
+		delta, err := binary.ReadVarint(br)
+		if err != nil {
+			return 0, nil, err
+		}
+		count := int64(freq[char]) + delta
+		if count < 0 || count > math.MaxInt32 {
+			return 0, nil, fmt.Errorf("frequency %d out of range", count)
+		}
+		if count == 0 {
+			delete(freq, char)
+		} else {
+			freq[char] = int(count)
+		}
+	}
+
+	if len(freq) == 0 {
+		return 0, nil, fmt.Errorf("empty frequency table")
+	}
+	return b, freq, nil
+}
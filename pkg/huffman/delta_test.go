@@ -0,0 +1,81 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// headerLen returns the number of bytes ParseHeader consumes from compressed
+func headerLen(t *testing.T, compressed []byte) int {
+	t.Helper()
+	r := bytes.NewReader(compressed)
+	if _, err := ParseHeader(r); err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	return len(compressed) - r.Len()
+}
+
+func TestDeltaModelRoundTrip(t *testing.T) {
+	text := []byte(strings.Repeat("It is a truth universally acknowledged, that a single man in possession "+
+		"of a good fortune, must be in want of a wife. However little known the feelings or views "+
+		"of such a man may be on his first entering a neighbourhood, this truth is so well fixed "+
+		"in the minds of the surrounding families, that he is considered the rightful property "+
+		"of some one or other of their daughters.\n", 50))
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, text, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fullPath := filepath.Join(tmpDir, "full.huf")
+	deltaPath := filepath.Join(tmpDir, "delta.huf")
+	if err := CompressFileWithOptions(inputPath, fullPath, Options{Table: TableFrequencies}); err != nil {
+		t.Fatalf("Compression with a full table failed: %v", err)
+	}
+	if err := CompressFileWithOptions(inputPath, deltaPath, Options{DeltaBase: EnglishTextModel}); err != nil {
+		t.Fatalf("Compression with a delta table failed: %v", err)
+	}
+
+	full, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := os.ReadFile(deltaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fullLen, deltaLen := headerLen(t, full), headerLen(t, delta); deltaLen >= fullLen {
+		t.Errorf("Expected the delta header to be smaller than the full table, got %d >= %d bytes", deltaLen, fullLen)
+	}
+
+	header, err := ParseHeader(bytes.NewReader(delta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Table != TableDelta || header.Base != EnglishTextModel {
+		t.Errorf("Expected a delta table against %v, got %v against %v", EnglishTextModel, header.Table, header.Base)
+	}
+
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+	if err := DecompressFile(deltaPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(text, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(text, decompressed))
+	}
+}
+
+func TestDeltaModelUnknownBase(t *testing.T) {
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader([]byte("abc")), &compressed, Options{DeltaBase: 200}); err == nil {
+		t.Error("Expected an error for an unknown base model")
+	}
+}
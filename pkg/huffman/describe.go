@@ -0,0 +1,179 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// describeHexBytes is the number of bytes of a field Describe shows in hex
+const describeHexBytes = 8
+
+// flagNames names the header flags in bit order for Describe
+var flagNames = []string{
+	"size-in-trailer", "aligned", "blocks", "stored", "no-size", "escape",
+	"fold-case", "checksum", "info-trailer", "external-codes", "encrypted", "lines",
+	"block-stats", "remap", "records", "payload-bits",
+}
+
+// Describe returns a breakdown of the layout of the compressed file at path,
+// one field per line with its offset, length, leading bytes in hex and
+// decoded value, for working out why a file won't decompress. The header is
+// parsed with ParseHeader, so a header it rejects gives an error rather than
+// a description.
+func Describe(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	r := bytes.NewReader(data)
+	header, err := ParseHeader(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %w", err)
+	}
+	headerEnd := len(data) - r.Len()
+
+	d := describer{data: data}
+	fmt.Fprintf(&d.out, "%-8s %-8s %-16s %-26s %s\n", "offset", "length", "field", "bytes", "value")
+	d.field("magic", 1, fmt.Sprintf("%q", data[0]))
+
+	if header.Version == 0 {
+		d.field("size", 4, fmt.Sprint(header.OriginalSize))
+		d.field("padding", 1, fmt.Sprint(header.PaddingBits))
+		d.field("symbols", 1, fmt.Sprint(len(header.Freq)))
+		d.field("model", headerEnd-d.pos, "legacy frequency list")
+		d.rest(header)
+		return d.out.String(), nil
+	}
+
+	d.field("version", 1, fmt.Sprint(header.Version))
+	flags, n := binary.Uvarint(data[d.pos:])
+	d.field("flags", n, describeFlags(flags))
+
+	switch {
+	case header.Blocks != nil:
+		value := fmt.Sprintf("%d blocks", len(header.Blocks))
+		if header.BlockStats != nil {
+			value += " with statistics"
+		}
+		if header.RecordSize > 0 {
+			value += fmt.Sprintf(", columns of %d-byte records", header.RecordSize)
+		}
+		d.field("block index", headerEnd-d.pos, value)
+	case header.Lines != nil:
+		d.field("line index", headerEnd-d.pos, fmt.Sprintf("%d lines, %v table", len(header.Lines), header.Table))
+	case header.Encrypted, header.Stored:
+	case header.ExternalCodes:
+		d.field("external codes", headerEnd-d.pos, fmt.Sprintf("size %d, padding %d, codes %08x", header.OriginalSize, header.PaddingBits, header.CodesID))
+	default:
+		d.field("table", 1, header.Table.String())
+		if !header.NoSize {
+			_, n := binary.Uvarint(data[d.pos:])
+			size := fmt.Sprint(header.OriginalSize)
+			if header.SizeInTrailer {
+				size += " (placeholder, see trailer)"
+			}
+			d.field("size", n, size)
+		}
+		d.field("padding", 1, fmt.Sprint(header.PaddingBits))
+		if header.Escaped {
+			d.field("escape", 1, formatByte(header.Escape))
+		}
+		if header.CaseRuns != nil {
+			start := d.pos
+			count, n := binary.Uvarint(data[d.pos:])
+			end := start + n
+			for i := uint64(0); i < count; i++ {
+				_, n := binary.Uvarint(data[end:])
+				end += n
+			}
+			d.field("case runs", end-start, fmt.Sprintf("%d runs", count))
+		}
+		if header.Checksummed {
+			d.field("checksum", 4, fmt.Sprintf("%08x", header.Checksum))
+		}
+		if header.Remap != nil {
+			d.field("remap", 1+len(header.Remap), fmt.Sprintf("%d symbols", len(header.Remap)))
+		}
+		if header.PayloadBits > 0 {
+			_, n := binary.Uvarint(data[d.pos:])
+			d.field("payload bits", n, fmt.Sprint(header.PayloadBits))
+		}
+		model := fmt.Sprintf("%v table", header.Table)
+		if header.Freq != nil {
+			model += fmt.Sprintf(", %d symbols", len(header.Freq))
+		}
+		d.field("model", headerEnd-d.pos, model)
+	}
+
+	d.rest(header)
+	return d.out.String(), nil
+}
+
+// describer accumulates the fields of a Describe listing
+type describer struct {
+	data []byte
+	pos  int
+	out  strings.Builder
+}
+
+// field lists the next length bytes as the named field
+func (d *describer) field(name string, length int, value string) {
+	end := min(d.pos+length, len(d.data))
+	raw := d.data[d.pos:end]
+	hex := fmt.Sprintf("% x", raw[:min(len(raw), describeHexBytes)])
+	if len(raw) > describeHexBytes {
+		hex += " ..."
+	}
+	fmt.Fprintf(&d.out, "%-8d %-8d %-16s %-26s %s\n", d.pos, len(raw), name, hex, value)
+	d.pos = end
+}
+
+// rest lists the payload after the header and any trailers after it
+func (d *describer) rest(h *Header) {
+	name := "payload"
+	switch {
+	case h.Encrypted:
+		name = "ciphertext"
+	case h.Stored:
+		name = "stored data"
+	case h.Blocks != nil:
+		name = "blocks"
+	case h.Lines != nil:
+		name = "line records"
+	}
+
+	// splitTrailer fills in the size and padding of a size trailer, so work
+	// on a copy of the header
+	hc := *h
+	payload, err := splitTrailer(&hc, d.data[d.pos:])
+	if err != nil || h.Encrypted {
+		payload = d.data[d.pos:]
+	}
+	d.field(name, len(payload), fmt.Sprintf("%d bytes", len(payload)))
+
+	if d.pos < len(d.data) {
+		value := fmt.Sprintf("%d bytes", len(d.data)-d.pos)
+		if h.SizeInTrailer && err == nil {
+			value = fmt.Sprintf("size %d, padding %d", hc.OriginalSize, hc.PaddingBits)
+		}
+		d.field("trailer", len(d.data)-d.pos, value)
+	}
+}
+
+// describeFlags names the bits set in flags
+func describeFlags(flags uint64) string {
+	if flags == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range flagNames {
+		if flags&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
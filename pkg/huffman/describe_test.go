@@ -0,0 +1,83 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	data := []byte("abracadabra")
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &compressed, Options{Table: TableFrequencies, Checksum: true}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "abracadabra.huf")
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	description, err := Describe(path)
+	if err != nil {
+		t.Fatalf("Describe error: %v", err)
+	}
+	// The header is magic, version, flags (checksum), table, size 11,
+	// padding, checksum and a five-symbol frequency list; the model is the
+	// count byte then a symbol and single-byte count per symbol
+	headerLen := 1 + 1 + 2 + 1 + 1 + 1 + 4 + 1 + 5*2
+	want := []struct {
+		offset, length int
+		field, value   string
+	}{
+		{0, 1, "magic", `'H'`},
+		{1, 1, "version", "1"},
+		{2, 2, "flags", "checksum"},
+		{4, 1, "table", "frequencies"},
+		{5, 1, "size", "11"},
+		{6, 1, "padding", "1"},
+		{7, 4, "checksum", ""},
+		{11, headerLen - 11, "model", "frequencies table, 5 symbols"},
+		{headerLen, compressed.Len() - headerLen, "payload", "bytes"},
+	}
+
+	lines := strings.Split(strings.TrimSpace(description), "\n")
+	if len(lines) != len(want)+1 {
+		t.Fatalf("Expected %d lines, got %d", len(want)+1, len(lines))
+	}
+	for i, w := range want {
+		fields := strings.Fields(lines[i+1])
+		if len(fields) < 3 || fields[0] != strconv.Itoa(w.offset) || fields[1] != strconv.Itoa(w.length) || fields[2] != w.field {
+			t.Errorf("Line %d: expected %s at offset %d, length %d, got %q", i+1, w.field, w.offset, w.length, lines[i+1])
+			continue
+		}
+		if !strings.Contains(lines[i+1], w.value) {
+			t.Errorf("Line %d: expected value %q in %q", i+1, w.value, lines[i+1])
+		}
+	}
+}
+
+func TestDescribeTrailer(t *testing.T) {
+	model := FrequencyTable{'h': 1, 'e': 1, 'l': 2, 'o': 1}
+	var streamed bytes.Buffer
+	mw, err := NewModelWriter(&streamed, model)
+	if err != nil {
+		t.Fatalf("NewModelWriter error: %v", err)
+	}
+	mw.Write([]byte("hello"))
+	mw.Close()
+
+	path := filepath.Join(t.TempDir(), "streamed.huf")
+	if err := os.WriteFile(path, streamed.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	description, err := Describe(path)
+	if err != nil {
+		t.Fatalf("Describe error: %v", err)
+	}
+	if !strings.Contains(description, "size-in-trailer") || !strings.Contains(description, "size 5, padding ") {
+		t.Errorf("Expected the size trailer to be described, got\n%s", description)
+	}
+}
@@ -0,0 +1,95 @@
+package huffman
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// DiagnosticKind classifies a Diagnostic
+type DiagnosticKind string
+
+const (
+	// DiagCloseError reports a file that failed to close after the
+	// operation had finished with it
+	DiagCloseError DiagnosticKind = "file close error"
+	// DiagRemoveError reports a partial output file that couldn't be
+	// removed after a failure
+	DiagRemoveError DiagnosticKind = "file remove error"
+	// DiagOutputLarger reports compressed output larger than its input
+	DiagOutputLarger DiagnosticKind = "output larger than input"
+	// DiagLowCompressibility reports output that saved less than
+	// lowCompressibilityRatio of the input, where storing it may be better
+	DiagLowCompressibility DiagnosticKind = "low compressibility"
+)
+
+// lowCompressibilityRatio is the compressed-to-original ratio above which
+// DiagLowCompressibility is reported
+const lowCompressibilityRatio = 0.9
+
+// Diagnostic is a non-fatal issue found during an operation
+type Diagnostic struct {
+	Kind    DiagnosticKind
+	Message string
+}
+
+// String returns the kind and message of the diagnostic
+func (d Diagnostic) String() string {
+	return string(d.Kind) + ": " + d.Message
+}
+
+// Diagnostics collects the non-fatal issues of the operations it is passed
+// to through Options or DecompressOptions, for the caller to inspect once
+// they return. It is safe for concurrent use. Operations given no collector
+// log the issues instead.
+type Diagnostics struct {
+	mu    sync.Mutex
+	items []Diagnostic
+}
+
+// All returns the diagnostics collected so far, in the order they were found
+func (d *Diagnostics) All() []Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnostic(nil), d.items...)
+}
+
+// Has reports whether a diagnostic of the given kind has been collected
+func (d *Diagnostics) Has(kind DiagnosticKind) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, item := range d.items {
+		if item.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// report records a diagnostic, or logs it when d is nil
+func (d *Diagnostics) report(kind DiagnosticKind, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if d == nil {
+		log.Print(message)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, Diagnostic{Kind: kind, Message: message})
+}
+
+// reportRatio reports output that is larger than, or barely smaller than, its
+// input. Nothing is logged without a collector: a poor ratio is a property of
+// the input, not a fault.
+func (d *Diagnostics) reportRatio(originalSize, compressedSize int64) {
+	if d == nil {
+		return
+	}
+	if compressedSize > originalSize {
+		d.report(DiagOutputLarger, "compressed output is %d bytes, %d more than the input", compressedSize, compressedSize-originalSize)
+		return
+	}
+	if float64(compressedSize) > float64(originalSize)*lowCompressibilityRatio {
+		d.report(DiagLowCompressibility, "compressed output is %.1f%% of the input; consider Store", float64(compressedSize)/float64(originalSize)*100)
+	}
+}
@@ -0,0 +1,93 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressDiagnostics(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	// Uniform over 200 byte values codes at about 7.6 bits a byte
+	uniform := make([]byte, 64*1024)
+	for i := range uniform {
+		uniform[i] = byte(rng.Intn(200))
+	}
+	random := make([]byte, 4096)
+	rng.Read(random)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []DiagnosticKind
+	}{
+		{"text", blockTestData(), nil},
+		{"low compressibility", uniform, []DiagnosticKind{DiagLowCompressibility}},
+		{"random", random, []DiagnosticKind{DiagOutputLarger}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "input")
+			if err := os.WriteFile(inputPath, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+
+			diag := &Diagnostics{}
+			opts := Options{Diagnostics: diag}
+			if _, err := CompressFileResultWithOptions(inputPath, filepath.Join(tmpDir, "output.huf"), opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			got := diag.All()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected diagnostics %v, got %v", tt.want, got)
+			}
+			for i, kind := range tt.want {
+				if got[i].Kind != kind || !diag.Has(kind) {
+					t.Errorf("Expected diagnostic %d to be %q, got %q", i, kind, got[i])
+				}
+			}
+		})
+	}
+}
+
+// swapOutputReader fails its first read after putting a non-empty directory
+// in place of the output file, so the partial output can't be removed
+type swapOutputReader struct {
+	outputPath string
+}
+
+func (r swapOutputReader) Read([]byte) (int, error) {
+	if err := os.Remove(r.outputPath); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Join(r.outputPath, "child"), 0755); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("read failed")
+}
+
+func TestDecompressDiagnostics(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	outputPath := filepath.Join(t.TempDir(), "output")
+	diag := &Diagnostics{}
+	err := decompressToFile(swapOutputReader{outputPath}, outputPath, DecompressOptions{Diagnostics: diag})
+	if err == nil {
+		t.Fatal("Expected the decompression to fail")
+	}
+	if !diag.Has(DiagRemoveError) {
+		t.Errorf("Expected a %q diagnostic, got %v", DiagRemoveError, diag.All())
+	}
+	if logged.Len() != 0 {
+		t.Errorf("Expected nothing logged with a collector, got %q", logged.String())
+	}
+}
@@ -0,0 +1,86 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// DirOptions configures BuildFrequencyTableDirWithOptions
+type DirOptions struct {
+	// ContinueOnError skips files that can't be read instead of stopping at
+	// the first one. Their errors are joined and returned together with the
+	// table of everything else.
+	ContinueOnError bool
+}
+
+// BuildFrequencyTableDir counts the bytes of every regular file under root
+// for which filter returns true into one table, for a model shared by many
+// files. A nil filter matches every file. It stops at the first file that
+// can't be read.
+func BuildFrequencyTableDir(root string, filter func(path string) bool) (FrequencyTable, error) {
+	return BuildFrequencyTableDirWithOptions(root, filter, DirOptions{})
+}
+
+// BuildFrequencyTableDirWithOptions counts bytes like BuildFrequencyTableDir,
+// configured by opts. Each file error names the file.
+func BuildFrequencyTableDirWithOptions(root string, filter func(path string) bool, opts DirOptions) (FrequencyTable, error) {
+	var counts byteCounts
+	var fileErrs []error
+	buf := make([]byte, 64*1024)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && (!entry.Type().IsRegular() || (filter != nil && !filter(path))) {
+			return nil
+		}
+		if err == nil {
+			err = countFile(path, &counts, buf)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", path, err)
+			if !opts.ContinueOnError {
+				return err
+			}
+			fileErrs = append(fileErrs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	freq := counts.table()
+	if len(freq) == 0 && len(fileErrs) == 0 {
+		return nil, fmt.Errorf("no data in %s", root)
+	}
+	return freq, errors.Join(fileErrs...)
+}
+
+// countFile adds the bytes of the file at path to counts, reading through buf
+func countFile(path string, counts *byteCounts, buf []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(file)
+
+	for {
+		n, err := file.Read(buf)
+		counts.add(buf[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
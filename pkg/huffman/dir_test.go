@@ -0,0 +1,55 @@
+package huffman
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildFrequencyTableDir(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":          "aab",
+		"sub/b.txt":      "bcc",
+		"sub/deep/c.txt": "c",
+		"sub/skip.log":   "zzzz",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freq, err := BuildFrequencyTableDir(root, func(path string) bool {
+		return !strings.HasSuffix(path, ".log")
+	})
+	if err != nil {
+		t.Fatalf("BuildFrequencyTableDir error: %v", err)
+	}
+	want := FrequencyTable{'a': 2, 'b': 2, 'c': 3}
+	if !reflect.DeepEqual(want, freq) {
+		t.Errorf("Expected %v, got %v", want, freq)
+	}
+
+	all, err := BuildFrequencyTableDir(root, nil)
+	if err != nil {
+		t.Fatalf("BuildFrequencyTableDir error: %v", err)
+	}
+	if all['z'] != 4 {
+		t.Errorf("Expected the unfiltered walk to count 4 z's, got %d", all['z'])
+	}
+
+	if _, err := BuildFrequencyTableDir(filepath.Join(root, "missing"), nil); err == nil {
+		t.Error("Expected an error walking a missing directory")
+	}
+	freq, err = BuildFrequencyTableDirWithOptions(filepath.Join(root, "missing"), nil, DirOptions{ContinueOnError: true})
+	if err == nil || !strings.Contains(err.Error(), "missing") || len(freq) != 0 {
+		t.Errorf("Expected the missing directory's error to be collected, got %v and %v", freq, err)
+	}
+}
@@ -0,0 +1,24 @@
+package huffman
+
+import "fmt"
+
+// formatByte renders a symbol for terminal output. Printable ASCII is shown as
+// is, common control characters as their escapes and anything else as \xNN, so
+// listings of codes or statistics never emit raw control bytes.
+func formatByte(b byte) string {
+	switch b {
+	case 0:
+		return `\0`
+	case '\t':
+		return `\t`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	}
+
+	if b >= 0x20 && b < 0x7f {
+		return string(rune(b))
+	}
+	return fmt.Sprintf(`\x%02x`, b)
+}
@@ -0,0 +1,149 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// encoderStateMagic starts every state written by Encoder.SaveState
+const encoderStateMagic = "HUFE"
+
+// encoderStateVersion is the layout version SaveState writes and
+// LoadEncoderState reads
+const encoderStateVersion = 1
+
+// ErrEncoderState is returned by LoadEncoderState for data that isn't an
+// encoder state or is in a version it doesn't read
+var ErrEncoderState = errors.New("huffman: not a supported encoder state")
+
+// Encoder is a model that adapts to the data a long-running service codes.
+// Learn adds to its byte counts and Codes and NewWriter code with the tree
+// the counts give so far. SaveState and LoadEncoderState persist the counts,
+// so a restarted service can start from the distribution it had learned. It
+// is safe for concurrent use.
+type Encoder struct {
+	mu     sync.Mutex
+	counts byteCounts
+}
+
+// NewEncoder returns an Encoder starting from the counts of model, which may
+// be nil to start with nothing learned
+func NewEncoder(model FrequencyTable) *Encoder {
+	e := &Encoder{}
+	for char, count := range model {
+		e.counts[char] = count
+	}
+	return e
+}
+
+// Learn adds the bytes of data to the counts
+func (e *Encoder) Learn(data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts.add(data)
+}
+
+// Model returns a copy of the counts learned so far
+func (e *Encoder) Model() FrequencyTable {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.counts.table()
+}
+
+// Codes returns the code table of the tree built from the counts learned so
+// far, or nil if nothing has been learned
+func (e *Encoder) Codes() CodeTable {
+	model := e.Model()
+	if len(model) == 0 {
+		return nil
+	}
+	codes, _ := BuildCodes(model)
+	return codes
+}
+
+// NewWriter returns a Writer that codes with the model learned so far, as
+// NewModelWriter does. Later calls to Learn don't change it.
+func (e *Encoder) NewWriter(w io.Writer) (*Writer, error) {
+	model := e.Model()
+	if len(model) == 0 {
+		return nil, fmt.Errorf("encoder has learned no symbols")
+	}
+	return NewModelWriter(w, model)
+}
+
+// SaveState writes the counts learned so far to w, for LoadEncoderState
+//
+// Format:
+//
+//	[Magic:4][Version:1][SymbolCount:uvarint][SymbolCount×(Symbol:1, Count:uvarint)]
+func (e *Encoder) SaveState(w io.Writer) error {
+	e.mu.Lock()
+	counts := e.counts
+	e.mu.Unlock()
+
+	n := 0
+	for _, count := range counts {
+		if count > 0 {
+			n++
+		}
+	}
+	buf := append([]byte(encoderStateMagic), encoderStateVersion)
+	buf = binary.AppendUvarint(buf, uint64(n))
+	for i, count := range counts {
+		if count > 0 {
+			buf = append(buf, byte(i))
+			buf = binary.AppendUvarint(buf, uint64(count))
+		}
+	}
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write encoder state: %w", err)
+	}
+	return nil
+}
+
+// LoadEncoderState reads a state written by SaveState and returns an Encoder
+// with its counts. It reads nothing past the end of the state.
+func LoadEncoderState(r io.Reader) (*Encoder, error) {
+	br := asByteReader(r)
+	prefix := make([]byte, len(encoderStateMagic)+1)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read encoder state: %w", err)
+	}
+	if string(prefix[:len(encoderStateMagic)]) != encoderStateMagic {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrEncoderState, prefix[:len(encoderStateMagic)])
+	}
+	if version := prefix[len(encoderStateMagic)]; version != encoderStateVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrEncoderState, version)
+	}
+
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encoder state: %w", err)
+	}
+	if n > 256 {
+		return nil, fmt.Errorf("%w: %d symbols", ErrEncoderState, n)
+	}
+	e := &Encoder{}
+	for i := uint64(0); i < n; i++ {
+		char, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encoder state: %w", err)
+		}
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encoder state: %w", err)
+		}
+		if count == 0 || count > math.MaxInt {
+			return nil, fmt.Errorf("%w: count %d for symbol %s", ErrEncoderState, count, formatByte(char))
+		}
+		if e.counts[char] != 0 {
+			return nil, fmt.Errorf("%w: duplicate symbol %s", ErrEncoderState, formatByte(char))
+		}
+		e.counts[char] = int(count)
+	}
+	return e, nil
+}
@@ -0,0 +1,109 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestEncoderStateRoundTrip(t *testing.T) {
+	enc := NewEncoder(FrequencyTable{'x': 3})
+	enc.Learn([]byte("the quick brown fox jumps over the lazy dog"))
+	enc.Learn([]byte("pack my box with five dozen liquor jugs"))
+
+	var state bytes.Buffer
+	if err := enc.SaveState(&state); err != nil {
+		t.Fatalf("SaveState error: %v", err)
+	}
+	// Anything after the state is left unread
+	state.WriteString("rest")
+	loaded, err := LoadEncoderState(&state)
+	if err != nil {
+		t.Fatalf("LoadEncoderState error: %v", err)
+	}
+	if state.String() != "rest" {
+		t.Errorf("LoadEncoderState left %q unread, want %q", state.String(), "rest")
+	}
+
+	if !maps.Equal(enc.Model(), loaded.Model()) {
+		t.Errorf("Reloaded model = %v, want %v", loaded.Model(), enc.Model())
+	}
+	if !maps.Equal(enc.Codes(), loaded.Codes()) {
+		t.Errorf("Reloaded codes = %v, want %v", loaded.Codes(), enc.Codes())
+	}
+
+	// Both code a message to the same stream
+	message := []byte("a lazy fox")
+	var want, got bytes.Buffer
+	for _, tt := range []struct {
+		enc *Encoder
+		out *bytes.Buffer
+	}{{enc, &want}, {loaded, &got}} {
+		w, err := tt.enc.NewWriter(tt.out)
+		if err != nil {
+			t.Fatalf("NewWriter error: %v", err)
+		}
+		if _, err := w.Write(message); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+	}
+	if !bytes.Equal(want.Bytes(), got.Bytes()) {
+		t.Errorf("Reloaded encoder's stream differs: %s", describeDiff(want.Bytes(), got.Bytes()))
+	}
+	var decoded bytes.Buffer
+	if err := Decompress(bytes.NewReader(got.Bytes()), &decoded); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(message, decoded.Bytes()) {
+		t.Errorf("Decompressed %q, want %q", decoded.Bytes(), message)
+	}
+}
+
+func TestEncoderStateEmpty(t *testing.T) {
+	var state bytes.Buffer
+	if err := NewEncoder(nil).SaveState(&state); err != nil {
+		t.Fatalf("SaveState error: %v", err)
+	}
+	loaded, err := LoadEncoderState(&state)
+	if err != nil {
+		t.Fatalf("LoadEncoderState error: %v", err)
+	}
+	if len(loaded.Model()) != 0 || loaded.Codes() != nil {
+		t.Errorf("Expected an empty model, got %v", loaded.Model())
+	}
+	if _, err := loaded.NewWriter(&bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a writer with no symbols")
+	}
+}
+
+func TestLoadEncoderStateInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     []byte
+		wantState bool // whether the error is ErrEncoderState
+	}{
+		{"empty", nil, false},
+		{"bad magic", []byte("HUFX\x01\x00"), true},
+		{"compressed file", []byte{magicByte, versionFlag | formatVersion, 0, 0, 1, 0}, true},
+		{"future version", []byte("HUFE\x02\x00"), true},
+		{"too many symbols", []byte("HUFE\x01\x81\x02"), true},
+		{"zero count", []byte("HUFE\x01\x01a\x00"), true},
+		{"duplicate symbol", []byte("HUFE\x01\x02a\x01a\x01"), true},
+		{"truncated", []byte("HUFE\x01\x02a\x01"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadEncoderState(bytes.NewReader(tt.state))
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if errors.Is(err, ErrEncoderState) != tt.wantState {
+				t.Errorf("errors.Is(%v, ErrEncoderState) = %v, want %v", err, !tt.wantState, tt.wantState)
+			}
+		})
+	}
+}
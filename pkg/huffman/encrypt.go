@@ -0,0 +1,92 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrEncrypted is returned when a file written by CompressEncrypt is given to
+// a function that can't decrypt it
+var ErrEncrypted = errors.New("huffman: file is encrypted; use DecompressDecrypt")
+
+// CompressEncrypt compresses a file into memory and passes the result through
+// encrypt before writing it, since compressing after encryption gains
+// nothing. The package doesn't pick a cipher: encrypt might seal the stream
+// with AES-GCM, for example. The output starts with a header marking it as
+// encrypted, so DecompressFile and the other readers fail with ErrEncrypted
+// instead of decoding ciphertext; it must be read with DecompressDecrypt.
+func CompressEncrypt(inputPath, outputPath string, encrypt func([]byte) ([]byte, error)) error {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty file")
+	}
+
+	var compressed bytes.Buffer
+	if err := writeCompressed(&compressed, data, BuildFrequencyTableFromData(data), Options{}); err != nil {
+		return err
+	}
+	ciphertext, err := encrypt(compressed.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	out, err := appendHeader(nil, &Header{Version: formatVersion, Encrypted: true})
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	out = append(out, ciphertext...)
+	if err := os.WriteFile(outputPath, out, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// DecompressDecrypt decompresses a file written by CompressEncrypt, passing
+// the encrypted stream through decrypt before decoding it
+func DecompressDecrypt(inputPath, outputPath string, decrypt func([]byte) ([]byte, error)) error {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	r := bytes.NewReader(data)
+	header, err := ParseHeader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if !header.Encrypted {
+		return fmt.Errorf("file is not encrypted; use DecompressFile")
+	}
+
+	plaintext, err := decrypt(data[len(data)-r.Len():])
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	_, decoded, err := readCompressed(bytes.NewReader(plaintext))
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(outputPath, decoded, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
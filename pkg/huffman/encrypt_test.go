@@ -0,0 +1,79 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xorCipher "encrypts" by XORing with a repeating key. It is its own inverse.
+func xorCipher(key []byte) func([]byte) ([]byte, error) {
+	return func(in []byte) ([]byte, error) {
+		out := make([]byte, len(in))
+		for i, b := range in {
+			out[i] = b ^ key[i%len(key)]
+		}
+		return out, nil
+	}
+}
+
+func TestCompressEncryptRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("compress first, then encrypt "), 200)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	encryptedPath := filepath.Join(tmpDir, "input.huf")
+	decryptedPath := filepath.Join(tmpDir, "output.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cipher := xorCipher([]byte("secret"))
+	if err := CompressEncrypt(inputPath, encryptedPath, cipher); err != nil {
+		t.Fatalf("CompressEncrypt error: %v", err)
+	}
+	if err := DecompressDecrypt(encryptedPath, decryptedPath, cipher); err != nil {
+		t.Fatalf("DecompressDecrypt error: %v", err)
+	}
+	decrypted, err := os.ReadFile(decryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decrypted) {
+		t.Errorf("Decrypted data doesn't match original: %s", describeDiff(data, decrypted))
+	}
+
+	// Plain decompression fails cleanly
+	if err := DecompressFile(encryptedPath, filepath.Join(tmpDir, "plain.txt")); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted from DecompressFile, got %v", err)
+	}
+	encrypted, err := os.ReadFile(encryptedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Decompress(bytes.NewReader(encrypted), io.Discard); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted from Decompress, got %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader(encrypted)); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted from NewReader, got %v", err)
+	}
+
+	// A wrong key yields a stream that doesn't decode to the input
+	wrongPath := filepath.Join(tmpDir, "wrong.txt")
+	if err := DecompressDecrypt(encryptedPath, wrongPath, xorCipher([]byte("guess"))); err == nil {
+		if wrong, _ := os.ReadFile(wrongPath); bytes.Equal(data, wrong) {
+			t.Error("Expected a wrong key not to reproduce the input")
+		}
+	}
+
+	// Cipher errors are passed on
+	failing := func([]byte) ([]byte, error) { return nil, errors.New("no key") }
+	if err := DecompressDecrypt(encryptedPath, decryptedPath, failing); err == nil {
+		t.Error("Expected an error from a failing decrypt")
+	}
+	if err := DecompressDecrypt(inputPath, decryptedPath, cipher); err == nil {
+		t.Error("Expected an error decrypting a file that isn't encrypted")
+	}
+}
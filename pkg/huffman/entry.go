@@ -0,0 +1,140 @@
+package huffman
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// DecompressEntry decompresses one stream from r, such as the reader of a tar
+// or zip entry, reading exactly the bytes of the stream and no more, so a
+// reader over a larger archive is left at whatever follows. r needn't be
+// seekable. Unless r is an io.ByteReader it is read a byte at a time, since
+// the end of the payload is only known once it has been decoded; wrap a slow
+// reader in a bufio.Reader if over-reading into the buffer is acceptable.
+//
+// The stream must record where it ends: block archives and streams with a
+// known original size are supported, while stored streams and streams with
+// the size omitted, in a trailer or followed by alignment padding are not.
+func DecompressEntry(r io.Reader, w io.Writer) error {
+	br := asByteReader(r)
+	header, err := ParseHeader(br)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	switch {
+	case header.Encrypted:
+		return ErrEncrypted
+	case header.Blocks != nil:
+		return decodeBlocks(br, header, w)
+	case header.Lines != nil:
+		return decodeLines(br, header, w)
+	case header.ExternalCodes:
+		return ErrExternalCodes
+	case header.Stored || header.NoSize || header.SizeInTrailer || header.Aligned:
+		return fmt.Errorf("stream doesn't record where its payload ends")
+	}
+
+	tree := header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+
+	payload, err := readPayload(br, header, tree)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	if header.InfoTrailer {
+		trailer := make([]byte, infoTrailerSize)
+		if _, err := io.ReadFull(br, trailer); err != nil {
+			return fmt.Errorf("failed to read info trailer: %w", err)
+		}
+		if _, err := parseInfoTrailer(trailer); err != nil {
+			return fmt.Errorf("failed to read info trailer: %w", err)
+		}
+	}
+
+	decoded, err := header.newDecoder(payload, tree).readAll()
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	if header.Checksummed && crc32.ChecksumIEEE(decoded) != header.Checksum {
+		return ErrChecksumMismatch
+	}
+
+	if _, err := w.Write(decoded); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readPayload reads the payload described by h from br a byte at a time,
+// walking tree to find the byte holding the end of the last code
+func readPayload(br io.ByteReader, h *Header, tree *Node) ([]byte, error) {
+	remaining := h.OriginalSize
+
+	// Special case: single character, coded as one bit per symbol
+	if tree.Left == nil && tree.Right == nil {
+		remaining = (remaining + 7) / 8
+		payload := make([]byte, 0, min(remaining, 64*1024))
+		for ; remaining > 0; remaining-- {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			payload = append(payload, b)
+		}
+		return payload, nil
+	}
+
+	var payload []byte
+	current := tree
+	literalBits := 0 // bits left in an escaped literal
+	for remaining > 0 {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		payload = append(payload, b)
+
+		for i := 0; i < 8 && remaining > 0; i++ {
+			if literalBits > 0 {
+				literalBits--
+				if literalBits == 0 {
+					remaining--
+				}
+				continue
+			}
+
+			if (b>>(7-i))&1 == 0 {
+				current = current.Left
+			} else {
+				current = current.Right
+			}
+			if current == nil {
+				return nil, fmt.Errorf("invalid bit sequence")
+			}
+
+			// Reached leaf node
+			if current.Left == nil && current.Right == nil {
+				if h.Escaped && current.Char == h.Escape {
+					literalBits = 8
+				} else {
+					remaining--
+				}
+				current = tree
+			}
+		}
+	}
+	return payload, nil
+}
+
+// unexpectedEOF reports an EOF in the middle of a payload as
+// io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
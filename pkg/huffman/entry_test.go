@@ -0,0 +1,92 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// plainReader hides every method of its reader but Read, as an archive
+// entry's reader would
+type plainReader struct {
+	io.Reader
+}
+
+func TestDecompressEntryNoOverRead(t *testing.T) {
+	data := blockTestData()
+	archive, err := os.ReadFile(writeBlockArchive(t, data, ParallelOptions{BlockSize: 1500}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+	}{
+		{"frequencies", data, Options{}},
+		{"tree", data, Options{Table: TableTree}},
+		{"legacy", data, Options{Legacy: true}},
+		{"escaped", data, Options{TopK: 4}},
+		{"fold case", []byte(strings.Repeat("Mixed CASE text ", 50)), Options{FoldCase: true}},
+		{"checksum", data, Options{Checksum: true}},
+		{"info trailer", data, Options{Trailer: true}},
+		{"single symbol", bytes.Repeat([]byte("s"), 37), Options{}},
+		{"one byte", []byte("x"), Options{}},
+		{"block archive", data, Options{}},
+	}
+
+	sentinel := []byte("NEXT ENTRY")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blob bytes.Buffer
+			if tt.name == "block archive" {
+				blob.Write(archive)
+			} else if err := writeCompressed(&blob, tt.data, BuildFrequencyTableFromData(tt.data), tt.opts); err != nil {
+				t.Fatalf("writeCompressed error: %v", err)
+			}
+			blob.Write(sentinel)
+
+			r := plainReader{bytes.NewReader(blob.Bytes())}
+			var decoded bytes.Buffer
+			if err := DecompressEntry(r, &decoded); err != nil {
+				t.Fatalf("DecompressEntry error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decoded.Bytes()))
+			}
+
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sentinel, rest) {
+				t.Errorf("Expected the reader to be left at %q, got %q", sentinel, rest)
+			}
+		})
+	}
+}
+
+func TestDecompressEntryUnsupported(t *testing.T) {
+	data := []byte("streams that don't record their end")
+	for _, opts := range []Options{{Store: true}, {OmitSize: true}, {PadTo: 64}} {
+		var blob bytes.Buffer
+		if err := writeCompressed(&blob, data, BuildFrequencyTableFromData(data), opts); err != nil {
+			t.Fatalf("writeCompressed error: %v", err)
+		}
+		if err := DecompressEntry(&blob, io.Discard); err == nil {
+			t.Errorf("Expected an error for options %+v", opts)
+		}
+	}
+
+	var blob bytes.Buffer
+	if err := writeCompressed(&blob, data, BuildFrequencyTableFromData(data), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	truncated := blob.Bytes()[:blob.Len()-2]
+	if err := DecompressEntry(bytes.NewReader(truncated), io.Discard); err == nil {
+		t.Error("Expected an error for a truncated payload")
+	}
+}
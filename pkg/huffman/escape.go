@@ -0,0 +1,81 @@
+package huffman
+
+import "sort"
+
+// BuildFrequencyTableTopK builds a frequency table over the k most frequent
+// symbols of data plus an escape symbol standing for all the others. The
+// escape is the lowest byte value outside the top k, and its count is the
+// total count of the symbols it replaces. Each escaped byte is coded as the
+// escape code followed by the 8 literal bits, which bounds the tree and the
+// header for large alphabets at a small cost in ratio. escape is false when
+// data has no more than k distinct symbols and the table is complete. A k
+// below 1 is treated as 1.
+func BuildFrequencyTableTopK(data []byte, k int) (freq FrequencyTable, escape bool) {
+	freq, symbol := topK(data, k)
+	return freq, symbol >= 0
+}
+
+// topK does the work behind BuildFrequencyTableTopK, returning the escape
+// symbol, or -1 when there is none
+func topK(data []byte, k int) (FrequencyTable, int) {
+	if k < 1 {
+		k = 1
+	}
+
+	freq := BuildFrequencyTableFromData(data)
+	if len(freq) <= k {
+		return freq, -1
+	}
+
+	symbols := make([]byte, 0, len(freq))
+	for char := range freq {
+		symbols = append(symbols, char)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if freq[symbols[i]] != freq[symbols[j]] {
+			return freq[symbols[i]] > freq[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+
+	kept := make(FrequencyTable, k+1)
+	for _, char := range symbols[:k] {
+		kept[char] = freq[char]
+	}
+
+	// kept holds at most 255 symbols, so one is always unused
+	escape := int(kept.UnusedBytes()[0])
+
+	others := 0
+	for _, char := range symbols[k:] {
+		others += freq[char]
+	}
+	kept[byte(escape)] = others
+
+	return kept, escape
+}
+
+// encodeEscaped encodes data like EncodeData, writing bytes that are not in
+// codes, and the escape byte itself, as the escape code and a literal byte.
+// A negative escape codes every byte with codes alone. report, if not nil, is
+// called with the number of bytes encoded after every progressChunk of them.
+// It returns the payload and its padding bits.
+func encodeEscaped(data []byte, codes CodeTable, escape int, report func(encoded int64)) ([]byte, int) {
+	var w bitWriter
+	for start := 0; start < len(data); start += progressChunk {
+		end := min(start+progressChunk, len(data))
+		for _, b := range data[start:end] {
+			if code, ok := codes[b]; escape < 0 || (ok && int(b) != escape) {
+				w.writeCode(code)
+				continue
+			}
+			w.writeCode(codes[byte(escape)])
+			w.writeBits(uint64(b), 8)
+		}
+		if report != nil {
+			report(int64(end))
+		}
+	}
+
+	return w.buf, (8 - w.nbits) % 8
+}
@@ -0,0 +1,118 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildFrequencyTableTopK(t *testing.T) {
+	data := []byte("aaaaabbbbcccdde\x00")
+
+	freq, escape := BuildFrequencyTableTopK(data, 3)
+	if !escape {
+		t.Fatal("Expected an escape symbol when k is below the distinct-symbol count")
+	}
+	// a, b and c are kept and byte 0, the lowest byte outside them, stands in
+	// for d, d, e and 0
+	expected := FrequencyTable{'a': 5, 'b': 4, 'c': 3, 0: 4}
+	if len(freq) != len(expected) {
+		t.Fatalf("Expected %d symbols, got %d: %v", len(expected), len(freq), freq)
+	}
+	for char, count := range expected {
+		if freq[char] != count {
+			t.Errorf("Expected count %d for %s, got %d", count, formatByte(char), freq[char])
+		}
+	}
+
+	if _, escape := BuildFrequencyTableTopK(data, 6); escape {
+		t.Error("Expected no escape symbol when every symbol fits")
+	}
+}
+
+func TestTopKRoundTrip(t *testing.T) {
+	var data []byte
+	for i := 0; i < 2000; i++ {
+		data = append(data, "etaoin shrdlu"[i%13])
+		if i%7 == 0 {
+			data = append(data, byte(i))
+		}
+	}
+
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &compressed, Options{TopK: 4}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+
+	header, err := ParseHeader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if !header.Escaped {
+		t.Error("Expected the header to record an escape symbol")
+	}
+	if codes := GenerateCodeTable(header.Root()); len(codes) != 5 {
+		t.Errorf("Expected 5 codes, got %d", len(codes))
+	}
+
+	_, decoded, err := readCompressed(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("readCompressed error: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Error("Decoded data doesn't match original")
+	}
+
+	var streamed bytes.Buffer
+	if err := Decompress(bytes.NewReader(compressed.Bytes()), &streamed); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(data, streamed.Bytes()) {
+		t.Error("Decompressed data doesn't match original")
+	}
+
+	tmpDir := t.TempDir()
+	compressedPath := filepath.Join(tmpDir, "topk.huf")
+	decompressedPath := filepath.Join(tmpDir, "topk.txt")
+	if err := os.WriteFile(compressedPath, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write compressed file: %v", err)
+	}
+	if err := DecompressToFileMmap(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("DecompressToFileMmap error: %v", err)
+	}
+	mapped, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatalf("Failed to read decompressed file: %v", err)
+	}
+	if !bytes.Equal(data, mapped) {
+		t.Error("Memory-mapped output doesn't match original")
+	}
+}
+
+func TestUnusedBytes(t *testing.T) {
+	sparse := FrequencyTable{0: 3, 'a': 1, 'b': 0, 255: 2}
+	unused := sparse.UnusedBytes()
+	if len(unused) != 253 {
+		t.Fatalf("Expected 253 unused bytes, got %d", len(unused))
+	}
+	for i, b := range unused {
+		if b == 0 || b == 'a' || b == 255 {
+			t.Errorf("Used byte %d reported as unused", b)
+		}
+		if i > 0 && b <= unused[i-1] {
+			t.Errorf("Unused bytes not ascending at index %d: %v", i, unused[i-1:i+1])
+		}
+	}
+	if unused[0] != 1 || unused[len(unused)-1] != 254 {
+		t.Errorf("Expected unused bytes from 1 to 254, got %d to %d", unused[0], unused[len(unused)-1])
+	}
+
+	dense := make(FrequencyTable)
+	for i := 0; i < 256; i++ {
+		dense[byte(i)] = i + 1
+	}
+	if unused := dense.UnusedBytes(); len(unused) != 0 {
+		t.Errorf("Expected no unused bytes in a dense table, got %v", unused)
+	}
+}
@@ -0,0 +1,73 @@
+package huffman
+
+// foldCase lowercases the ASCII letters of data and returns the folded copy
+// with the case of the letters as run lengths, alternating between lowercase
+// and uppercase and starting with lowercase. Only letters count towards the
+// runs.
+func foldCase(data []byte) ([]byte, []uint64) {
+	folded := make([]byte, len(data))
+	runs := []uint64{0}
+	upper := false
+	for i, b := range data {
+		folded[i] = b
+		isUpper := b >= 'A' && b <= 'Z'
+		if !isUpper && !(b >= 'a' && b <= 'z') {
+			continue
+		}
+		if isUpper {
+			folded[i] = b + 'a' - 'A'
+		}
+		if isUpper != upper {
+			runs = append(runs, 0)
+			upper = isUpper
+		}
+		runs[len(runs)-1]++
+	}
+	return folded, runs
+}
+
+// foldFrequencies merges the counts of uppercase ASCII letters into their
+// lowercase forms
+func foldFrequencies(freq FrequencyTable) FrequencyTable {
+	folded := make(FrequencyTable, len(freq))
+	for char, count := range freq {
+		if char >= 'A' && char <= 'Z' {
+			char += 'a' - 'A'
+		}
+		folded[char] += count
+	}
+	return folded
+}
+
+// caseMap restores the case of decoded letters from the runs of foldCase
+type caseMap struct {
+	runs  []uint64
+	idx   int // index of the current run
+	left  uint64
+	upper bool
+}
+
+func newCaseMap(runs []uint64) *caseMap {
+	return &caseMap{runs: runs, idx: -1, upper: true}
+}
+
+// apply returns b with the case of the next letter, or b unchanged if it is
+// not a letter. It returns false when the runs have no letters left.
+func (m *caseMap) apply(b byte) (byte, bool) {
+	if b < 'a' || b > 'z' {
+		return b, true
+	}
+	for m.left == 0 {
+		m.idx++
+		if m.idx >= len(m.runs) {
+			return b, false
+		}
+		m.left = m.runs[m.idx]
+		m.upper = !m.upper
+	}
+	m.left--
+	if m.upper {
+		b -= 'a' - 'A'
+	}
+	return b, true
+}
@@ -0,0 +1,52 @@
+package huffman
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFoldCaseRoundTrip(t *testing.T) {
+	prose := []byte(strings.Repeat("THE QUICK BROWN FOX. The quick brown fox jumps over the lazy dog. "+
+		"NASA and the BBC reported it; Mr. McDonald said \"OK\" in Paris.\n", 100))
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+	}{
+		{"mixed-case prose", prose, Options{FoldCase: true}},
+		{"single symbol", []byte("AAAAaaaaAAaa"), Options{FoldCase: true}},
+		{"no letters", []byte("1234 5678 !?"), Options{FoldCase: true}},
+		{"with top k", prose, Options{FoldCase: true, TopK: 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var folded, plain bytes.Buffer
+			if err := Compress(bytes.NewReader(tt.data), &folded, tt.opts); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+			if err := Compress(bytes.NewReader(tt.data), &plain, Options{}); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+			t.Logf("folded %d bytes, plain %d bytes, improved: %v", folded.Len(), plain.Len(), folded.Len() < plain.Len())
+
+			_, decoded, err := readCompressed(bytes.NewReader(folded.Bytes()))
+			if err != nil {
+				t.Fatalf("readCompressed error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded) {
+				t.Errorf("Decoded data doesn't match original: %s", describeDiff(tt.data, decoded))
+			}
+
+			var streamed bytes.Buffer
+			if err := Decompress(bytes.NewReader(folded.Bytes()), &streamed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, streamed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, streamed.Bytes()))
+			}
+		})
+	}
+}
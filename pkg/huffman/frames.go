@@ -0,0 +1,79 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// EncodeFrames splits data into frames of at most maxFrameBytes, for message
+// protocols with a frame size limit. Each frame is a complete compressed
+// stream with its own header, coded with a model of its own part of data or
+// stored if that is smaller, so frames can be decoded independently. A frame
+// always holds whole symbols: the code of the last one is followed by padding
+// to the frame's byte boundary rather than split across frames.
+// maxFrameBytes must leave room for a header and at least one symbol.
+func EncodeFrames(data []byte, maxFrameBytes int) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty input")
+	}
+
+	var frames [][]byte
+	for len(data) > 0 {
+		// A symbol takes at least one bit unless it is the only one, so a
+		// frame can't hold more than 8 symbols per byte worth checking
+		lo, hi := 0, min(len(data), maxFrameBytes*8)
+		var frame []byte
+		for lo < hi {
+			mid := lo + (hi-lo+1)/2
+			candidate, err := encodeFrame(data[:mid])
+			if err != nil {
+				return nil, err
+			}
+			if len(candidate) <= maxFrameBytes {
+				lo, frame = mid, candidate
+			} else {
+				hi = mid - 1
+			}
+		}
+		if lo == 0 {
+			return nil, fmt.Errorf("frame size %d is too small for a single symbol", maxFrameBytes)
+		}
+
+		frames = append(frames, frame)
+		data = data[lo:]
+	}
+
+	return frames, nil
+}
+
+// encodeFrame compresses data into a single stream, or stores it if that is
+// smaller
+func encodeFrame(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	if err := writeCompressed(&compressed, data, BuildFrequencyTableFromData(data), Options{}); err != nil {
+		return nil, err
+	}
+
+	var stored bytes.Buffer
+	if err := writeStored(&stored, data, Options{}); err != nil {
+		return nil, err
+	}
+
+	if stored.Len() < compressed.Len() {
+		return stored.Bytes(), nil
+	}
+	return compressed.Bytes(), nil
+}
+
+// DecodeFrames decodes frames written by EncodeFrames and joins them in order
+func DecodeFrames(frames [][]byte) ([]byte, error) {
+	var result []byte
+	for i, frame := range frames {
+		_, decoded, err := readCompressed(bytes.NewReader(frame))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame %d: %w", i, err)
+		}
+		result = append(result, decoded...)
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeFramesRoundTrip(t *testing.T) {
+	random := make([]byte, 500)
+	rand.New(rand.NewSource(5)).Read(random)
+
+	tests := []struct {
+		name          string
+		data          []byte
+		maxFrameBytes int
+	}{
+		{"text", blockTestData(), 64},
+		{"random", random, 32},
+		{"single symbol", bytes.Repeat([]byte("z"), 1000), 16},
+		{"one byte", []byte("x"), 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := EncodeFrames(tt.data, tt.maxFrameBytes)
+			if err != nil {
+				t.Fatalf("EncodeFrames error: %v", err)
+			}
+			for i, frame := range frames {
+				if len(frame) > tt.maxFrameBytes {
+					t.Errorf("Frame %d is %d bytes, over the limit of %d", i, len(frame), tt.maxFrameBytes)
+				}
+			}
+
+			decoded, err := DecodeFrames(frames)
+			if err != nil {
+				t.Fatalf("DecodeFrames error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded) {
+				t.Errorf("Decoded frames don't match original: %s", describeDiff(tt.data, decoded))
+			}
+		})
+	}
+}
+
+func TestEncodeFramesTooSmall(t *testing.T) {
+	if _, err := EncodeFrames([]byte("abc"), 2); err == nil {
+		t.Error("Expected an error for a frame size that can't hold a header")
+	}
+}
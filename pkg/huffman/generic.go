@@ -0,0 +1,189 @@
+package huffman
+
+import (
+	"math"
+	"slices"
+)
+
+// Symbol is the constraint on the symbol types the generic tree and code
+// functions work over: bytes, 16-bit symbols and runes
+type Symbol interface {
+	~uint8 | ~uint16 | ~int32
+}
+
+// NodeG is a node in a Huffman tree over symbols of type T. Node is the byte
+// instantiation used by the file format.
+type NodeG[T Symbol] struct {
+	Char  T
+	Freq  int64 // Summed in int64 so counts over huge inputs cannot overflow
+	Seq   int   // Sequence number for tiebreaking in tree building
+	Left  *NodeG[T]
+	Right *NodeG[T]
+}
+
+// BuildHuffmanTreeG constructs the Huffman tree for symbol counts of any
+// Symbol type. It merges in the same order as BuildHuffmanTree, so the two
+// build the same tree for the same byte counts.
+func BuildHuffmanTreeG[T Symbol](freq map[T]int) *NodeG[T] {
+	return buildHuffmanTree(freq, nil)
+}
+
+// buildHuffmanTree builds the tree for freq, merging equal-frequency nodes in
+// the order given by less, or by Seq when less is nil or doesn't order them
+func buildHuffmanTree[T Symbol](freq map[T]int, less func(a, b *NodeG[T]) bool) *NodeG[T] {
+	if len(freq) == 0 {
+		return nil
+	}
+
+	// Special case: single character
+	if len(freq) == 1 {
+		for char, count := range freq {
+			return &NodeG[T]{
+				Char:  char,
+				Freq:  int64(count),
+				Seq:   0,
+				Left:  nil,
+				Right: nil,
+			}
+		}
+	}
+
+	// Create initial nodes sorted by character for deterministic ordering
+	// This ensures that regardless of map iteration order, we always get the same tree
+	nodes := make([]*NodeG[T], 0, len(freq))
+	chars := make([]T, 0, len(freq))
+	for char := range freq {
+		chars = append(chars, char)
+	}
+	slices.Sort(chars)
+
+	seq := 0
+	for _, char := range chars {
+		nodes = append(nodes, &NodeG[T]{
+			Char: char,
+			Freq: int64(freq[char]),
+			Seq:  seq,
+		})
+		seq++
+	}
+
+	// Build tree by repeatedly combining two lowest frequency nodes
+	for len(nodes) > 1 {
+		// Find two nodes with a minimum frequency
+		min1Idx, min2Idx := findTwoMinimum(nodes, less)
+
+		// Create parent node
+		parent := &NodeG[T]{
+			Freq:  addFreq(nodes[min1Idx].Freq, nodes[min2Idx].Freq),
+			Seq:   seq,
+			Left:  nodes[min1Idx],
+			Right: nodes[min2Idx],
+		}
+		seq++
+
+		// Remove the two minimum nodes and add a parent
+		nodes = removeNodes(nodes, min1Idx, min2Idx)
+		nodes = append(nodes, parent)
+	}
+
+	return nodes[0]
+}
+
+// addFreq adds two node frequencies, saturating at math.MaxInt64 rather than
+// wrapping to a negative count that would break the merge order
+func addFreq(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func findTwoMinimum[T Symbol](nodes []*NodeG[T], less func(a, b *NodeG[T]) bool) (int, int) {
+	// before orders nodes by frequency, breaking ties with less and then Seq
+	before := func(a, b *NodeG[T]) bool {
+		if a.Freq != b.Freq {
+			return a.Freq < b.Freq
+		}
+		if less != nil {
+			if less(a, b) {
+				return true
+			}
+			if less(b, a) {
+				return false
+			}
+		}
+		return a.Seq < b.Seq
+	}
+
+	min1, min2 := 0, 1
+	if before(nodes[min2], nodes[min1]) {
+		min1, min2 = min2, min1
+	}
+
+	for i := 2; i < len(nodes); i++ {
+		if before(nodes[i], nodes[min1]) {
+			min2 = min1
+			min1 = i
+		} else if before(nodes[i], nodes[min2]) {
+			min2 = i
+		}
+	}
+
+	return min1, min2
+}
+
+func removeNodes[T Symbol](nodes []*NodeG[T], idx1, idx2 int) []*NodeG[T] {
+	if idx1 > idx2 {
+		idx1, idx2 = idx2, idx1
+	}
+	result := make([]*NodeG[T], 0, len(nodes)-2)
+	for i, node := range nodes {
+		if i != idx1 && i != idx2 {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// GenerateCodeTableG creates prefix codes from a Huffman tree over symbols of
+// any Symbol type
+func GenerateCodeTableG[T Symbol](root *NodeG[T]) map[T]string {
+	return GenerateCodeTableWithG(root, SmallerIsZero)
+}
+
+// GenerateCodeTableWithG is GenerateCodeTableWith for symbols of any Symbol
+// type
+func GenerateCodeTableWithG[T Symbol](root *NodeG[T], convention BranchConvention) map[T]string {
+	codes := make(map[T]string)
+	if root == nil {
+		return codes
+	}
+
+	// Special case: single character
+	if root.Left == nil && root.Right == nil {
+		codes[root.Char] = "0"
+		return codes
+	}
+
+	left, right := "0", "1"
+	if convention == SmallerIsOne {
+		left, right = right, left
+	}
+	generateCodes(root, "", left, right, codes)
+	return codes
+}
+
+func generateCodes[T Symbol](node *NodeG[T], code, left, right string, codes map[T]string) {
+	if node == nil {
+		return
+	}
+
+	// Leaf node
+	if node.Left == nil && node.Right == nil {
+		codes[node.Char] = code
+		return
+	}
+
+	generateCodes(node.Left, code+left, left, right, codes)
+	generateCodes(node.Right, code+right, left, right, codes)
+}
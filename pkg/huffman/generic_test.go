@@ -0,0 +1,86 @@
+package huffman
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestGenericCoreMatchesBytePath(t *testing.T) {
+	rng := rand.New(rand.NewSource(29))
+	for trial := 0; trial < 20; trial++ {
+		freq := make(FrequencyTable)
+		generic := make(map[uint8]int)
+		for i := 0; i < 1+rng.Intn(256); i++ {
+			char, count := byte(rng.Intn(256)), 1+rng.Intn(1000)
+			freq[char] = count
+			generic[char] = count
+		}
+
+		want := GenerateCodeTable(BuildHuffmanTree(freq))
+		got := GenerateCodeTableG(BuildHuffmanTreeG(generic))
+		if !reflect.DeepEqual(map[byte]string(want), got) {
+			t.Fatalf("Trial %d: generic uint8 codes %v differ from byte codes %v", trial, got, want)
+		}
+	}
+}
+
+func TestGenericCoreUint16(t *testing.T) {
+	// More symbols than a byte can hold, with skewed counts
+	freq := make(map[uint16]int)
+	for i := 0; i < 1000; i++ {
+		freq[uint16(i*61)] = 1 + 100000/(i+1)
+	}
+
+	tree := BuildHuffmanTreeG(freq)
+	codes := GenerateCodeTableG(tree)
+	if len(codes) != len(freq) {
+		t.Fatalf("Expected %d codes, got %d", len(freq), len(codes))
+	}
+
+	// The codes are a complete prefix code: the Kraft sum is exactly one
+	var kraft float64
+	for _, code := range codes {
+		kraft += 1 / float64(uint64(1)<<len(code))
+	}
+	if kraft != 1 {
+		t.Errorf("Expected a Kraft sum of 1, got %v", kraft)
+	}
+
+	// Each code walks the tree to its own symbol
+	for symbol, code := range codes {
+		node := tree
+		for _, bit := range code {
+			if bit == '0' {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+		}
+		if node.Left != nil || node.Right != nil || node.Char != symbol {
+			t.Errorf("Code %s for symbol %d leads to %+v", code, symbol, node)
+		}
+	}
+
+	// More frequent symbols never get longer codes
+	if len(codes[0]) > len(codes[uint16(999*61)]) {
+		t.Errorf("Most frequent symbol has a longer code than the least frequent")
+	}
+}
+
+func TestGenericCoreRunes(t *testing.T) {
+	freq := make(map[rune]int)
+	for _, r := range "héllo wörld, hello world" {
+		freq[r]++
+	}
+	codes := GenerateCodeTableG(BuildHuffmanTreeG(freq))
+	if len(codes) != len(freq) {
+		t.Fatalf("Expected %d codes, got %d", len(freq), len(codes))
+	}
+	// 'l' is the most frequent rune, so no code is shorter than its own
+	for r, code := range codes {
+		if len(code) < len(codes['l']) {
+			t.Errorf("Code %q for %q is shorter than %q for 'l'", code, r, codes['l'])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// EncodeToGoSource compresses data and writes a Go source file in package pkg
+// declaring it as varName, a []byte, along with a function that decompresses
+// it, for embedding compressed assets in a binary. The function is named
+// after varName, as decompressLogo for logo or DecompressLogo for Logo.
+// varName can't be the name of an import, bytes or huffman, or of a
+// predeclared identifier such as byte or error.
+func EncodeToGoSource(data []byte, pkg, varName string, w io.Writer) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid package name %q", pkg)
+	}
+	// The generated file refers to its imports and to the predeclared byte,
+	// error and nil, which a variable of the same name would shadow
+	if !token.IsIdentifier(varName) || varName == "_" || varName == "bytes" || varName == "huffman" || types.Universe.Lookup(varName) != nil {
+		return fmt.Errorf("invalid variable name %q", varName)
+	}
+
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &compressed, Options{}); err != nil {
+		return err
+	}
+
+	helper := "decompress"
+	if token.IsExported(varName) {
+		helper = "Decompress"
+	}
+	helper += strings.ToUpper(varName[:1]) + varName[1:]
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by huffman.EncodeToGoSource. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	fmt.Fprintf(&src, "import (\n\t\"bytes\"\n\n\t\"github.com/letsmakecakes/huffman/pkg/huffman\"\n)\n\n")
+	fmt.Fprintf(&src, "// %s holds %d bytes compressed to %d\n", varName, len(data), compressed.Len())
+	fmt.Fprintf(&src, "var %s = []byte{", varName)
+	for i, b := range compressed.Bytes() {
+		if i%12 == 0 {
+			src.WriteString("\n")
+		}
+		fmt.Fprintf(&src, "0x%02x, ", b)
+	}
+	fmt.Fprintf(&src, "\n}\n\n")
+	fmt.Fprintf(&src, "// %s returns the decompressed contents of %s\n", helper, varName)
+	fmt.Fprintf(&src, "func %s() ([]byte, error) {\n", helper)
+	// The variable is read before any local is declared, so it may share a
+	// local's name
+	fmt.Fprintf(&src, "\tr := bytes.NewReader(%s)\n", varName)
+	fmt.Fprintf(&src, "\tvar buf bytes.Buffer\n")
+	fmt.Fprintf(&src, "\tif err := huffman.Decompress(r, &buf); err != nil {\n")
+	fmt.Fprintf(&src, "\t\treturn nil, err\n\t}\n\treturn buf.Bytes(), nil\n}\n")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated source: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
@@ -0,0 +1,118 @@
+package huffman
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"testing"
+)
+
+func TestEncodeToGoSource(t *testing.T) {
+	data := bytes.Repeat([]byte("<svg>an embedded asset</svg>\n"), 20)
+
+	var src bytes.Buffer
+	if err := EncodeToGoSource(data, "assets", "logo", &src); err != nil {
+		t.Fatalf("EncodeToGoSource error: %v", err)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "logo.go", src.Bytes(), 0)
+	if err != nil {
+		t.Fatalf("Generated source doesn't parse: %v\n%s", err, src.String())
+	}
+	if file.Name.Name != "assets" {
+		t.Errorf("Expected package assets, got %s", file.Name.Name)
+	}
+
+	var compressed []byte
+	var helper bool
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if n.Names[0].Name != "logo" {
+				return true
+			}
+			for _, elt := range n.Values[0].(*ast.CompositeLit).Elts {
+				b, err := strconv.ParseUint(elt.(*ast.BasicLit).Value, 0, 8)
+				if err != nil {
+					t.Fatalf("Invalid byte literal: %v", err)
+				}
+				compressed = append(compressed, byte(b))
+			}
+		case *ast.FuncDecl:
+			helper = helper || n.Name.Name == "decompressLogo"
+		}
+		return true
+	})
+	if !helper {
+		t.Error("Expected a decompressLogo helper")
+	}
+
+	var decoded bytes.Buffer
+	if err := Decompress(bytes.NewReader(compressed), &decoded); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(data, decoded.Bytes()) {
+		t.Errorf("Embedded bytes don't decompress to the original: %s", describeDiff(data, decoded.Bytes()))
+	}
+
+	for _, name := range []string{"not valid", "_", "bytes", "huffman", "byte", "error", "nil"} {
+		if err := EncodeToGoSource(data, "assets", name, &src); err == nil {
+			t.Errorf("Expected an error for the variable name %q", name)
+		}
+	}
+}
+
+func TestEncodeToGoSourceTypeChecks(t *testing.T) {
+	data := []byte("an embedded asset")
+
+	// The names of the generated function's locals are valid variable names
+	for _, name := range []string{"logo", "Logo", "buf", "err", "r"} {
+		t.Run(name, func(t *testing.T) {
+			var src bytes.Buffer
+			if err := EncodeToGoSource(data, "assets", name, &src); err != nil {
+				t.Fatalf("EncodeToGoSource error: %v", err)
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, name+".go", src.Bytes(), 0)
+			if err != nil {
+				t.Fatalf("Generated source doesn't parse: %v\n%s", err, src.String())
+			}
+			conf := types.Config{Importer: stubImporter{importer.Default()}}
+			if _, err := conf.Check("assets", fset, []*ast.File{file}, nil); err != nil {
+				t.Errorf("Generated source doesn't type-check: %v\n%s", err, src.String())
+			}
+		})
+	}
+}
+
+// stubImporter stands in for this package, declaring only the Decompress
+// function generated sources call, so they type-check without compiling it.
+// Other imports go to the wrapped importer.
+type stubImporter struct {
+	types.Importer
+}
+
+func (s stubImporter) Import(path string) (*types.Package, error) {
+	if path != "github.com/letsmakecakes/huffman/pkg/huffman" {
+		return s.Importer.Import(path)
+	}
+	io, err := s.Importer.Import("io")
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := types.NewPackage(path, "huffman")
+	params := types.NewTuple(
+		types.NewParam(token.NoPos, pkg, "r", io.Scope().Lookup("Reader").Type()),
+		types.NewParam(token.NoPos, pkg, "w", io.Scope().Lookup("Writer").Type()),
+	)
+	results := types.NewTuple(types.NewParam(token.NoPos, pkg, "", types.Universe.Lookup("error").Type()))
+	signature := types.NewSignatureType(nil, nil, nil, params, results, false)
+	pkg.Scope().Insert(types.NewFunc(token.NoPos, pkg, "Decompress", signature))
+	pkg.MarkComplete()
+	return pkg, nil
+}
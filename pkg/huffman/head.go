@@ -0,0 +1,167 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// DecompressHead writes the first n bytes of the decompressed file to w, or
+// the whole file if it is shorter. It stops as soon as n bytes are produced:
+// only the blocks or lines of an archive that cover them are decoded, and a single
+// stream whose header records its size is read no further than n symbols can
+// reach. Streams with the size in a trailer, or no size at all, are read in
+// full but still only decoded up to n bytes, and every column of a record
+// archive is decoded.
+func DecompressHead(inputPath string, n int64, w io.Writer) error {
+	if n < 0 {
+		return fmt.Errorf("invalid byte count %d", n)
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if header.Encrypted {
+		return ErrEncrypted
+	}
+	if header.ExternalCodes {
+		return ErrExternalCodes
+	}
+	if header.RecordSize > 0 {
+		// Every record takes a byte from every column
+		var records bytes.Buffer
+		if err := decodeRecords(input, header, &records); err != nil {
+			return err
+		}
+		if _, err := w.Write(records.Bytes()[:min(n, int64(records.Len()))]); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		return nil
+	}
+	if header.Blocks != nil {
+		for i, block := range header.Blocks {
+			if n == 0 {
+				break
+			}
+			decoded, err := readBlock(input, block)
+			if err != nil {
+				return fmt.Errorf("failed to decode block %d: %w", i, err)
+			}
+			decoded = decoded[:min(n, int64(len(decoded)))]
+			if _, err := w.Write(decoded); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			n -= int64(len(decoded))
+		}
+		return nil
+	}
+	if header.Lines != nil {
+		tree := header.Root()
+		if tree == nil {
+			return fmt.Errorf("failed to build huffman tree")
+		}
+		for i, line := range header.Lines {
+			if n == 0 {
+				break
+			}
+			decoded, err := readLine(input, tree, line)
+			if err != nil {
+				return fmt.Errorf("failed to decode line %d: %w", i+1, err)
+			}
+			decoded = decoded[:min(n, int64(len(decoded)))]
+			if _, err := w.Write(decoded); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			n -= int64(len(decoded))
+		}
+		return nil
+	}
+
+	if header.Stored {
+		if !header.Aligned {
+			if _, err := io.CopyN(w, input, n); err != nil && err != io.EOF {
+				return fmt.Errorf("failed to copy stored data: %w", err)
+			}
+			return nil
+		}
+
+		stored, err := io.ReadAll(input)
+		if err != nil {
+			return fmt.Errorf("failed to read stored data: %w", err)
+		}
+		stored, err = splitTrailer(header, stored)
+		if err != nil {
+			return fmt.Errorf("failed to read trailer: %w", err)
+		}
+		if _, err := w.Write(stored[:min(n, int64(len(stored)))]); err != nil {
+			return fmt.Errorf("failed to write stored data: %w", err)
+		}
+		return nil
+	}
+
+	tree := header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+
+	var dec *decoder
+	sizeKnown := !header.SizeInTrailer && !header.NoSize
+	if sizeKnown {
+		// No symbol takes more bits than the longest code, plus a literal
+		// byte when it is the escape
+		maxBits := 0
+		for _, code := range GenerateCodeTable(tree) {
+			maxBits = max(maxBits, len(code))
+		}
+		if header.Escaped {
+			maxBits += 8
+		}
+		n = min(n, header.OriginalSize)
+
+		payload, err := io.ReadAll(io.LimitReader(input, (n*int64(maxBits)+7)/8))
+		if err != nil {
+			return fmt.Errorf("failed to read encoded data: %w", err)
+		}
+
+		// The payload may be cut short of its padding, and the decoder stops
+		// after n symbols, so every bit read is available
+		dec = header.newDecoder(payload, tree)
+		dec.totalBits = len(payload) * 8
+	} else {
+		payload, err := io.ReadAll(input)
+		if err != nil {
+			return fmt.Errorf("failed to read encoded data: %w", err)
+		}
+		payload, err = splitTrailer(header, payload)
+		if err != nil {
+			return fmt.Errorf("failed to read trailer: %w", err)
+		}
+		dec = header.newDecoder(payload, tree)
+	}
+	dec.remaining = min(dec.remaining, n)
+
+	written, err := decodeToWriter(dec, w)
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	if sizeKnown && written != n {
+		return fmt.Errorf("failed to decode data: got %d of %d bytes", written, n)
+	}
+
+	return nil
+}
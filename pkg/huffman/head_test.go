@@ -0,0 +1,52 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressHead(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"blocks": writeBlockArchive(t, data, ParallelOptions{BlockSize: 1000}),
+	}
+	for name, opts := range map[string]Options{
+		"default":   {},
+		"omit size": {OmitSize: true},
+		"top k":     {TopK: 4},
+		"stored":    {Store: true},
+		"aligned":   {Store: true, PadTo: 4096},
+	} {
+		var compressed bytes.Buffer
+		if err := Compress(bytes.NewReader(data), &compressed, opts); err != nil {
+			t.Fatalf("Compress with %s failed: %v", name, err)
+		}
+		path := filepath.Join(tmpDir, name+".huf")
+		if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[name] = path
+	}
+
+	for name, path := range files {
+		for _, n := range []int64{0, 1, 100, 2500, int64(len(data)), int64(len(data)) + 10} {
+			var head bytes.Buffer
+			if err := DecompressHead(path, n, &head); err != nil {
+				t.Fatalf("DecompressHead(%s, %d) error: %v", name, n, err)
+			}
+
+			want := data[:min(n, int64(len(data)))]
+			if !bytes.Equal(want, head.Bytes()) {
+				t.Errorf("DecompressHead(%s, %d) doesn't match the original prefix: %s", name, n, describeDiff(want, head.Bytes()))
+			}
+		}
+	}
+
+	if err := DecompressHead(files["default"], -1, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a negative byte count")
+	}
+}
@@ -0,0 +1,1212 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	// magicByte starts every compressed file
+	magicByte = 0x48 // 'H'
+
+	// versionFlag marks the byte after the magic as a format version. Legacy
+	// files hold the high byte of a uint32 size there instead, which stays
+	// below 0x80 for every file whose counts fitted the legacy uint16 field.
+	versionFlag = 0x80
+
+	// formatVersion is the version written by this package
+	formatVersion = 1
+)
+
+// ErrInvalidFormat is returned for a malformed header, such as one whose
+// magic byte is wrong or which declares more table entries than the stream
+// has bytes left
+var ErrInvalidFormat = errors.New("huffman: invalid file format")
+
+// Header flags, stored as a uvarint bit set after the version byte
+const (
+	// flagSizeInTrailer moves the original size and padding to a trailer
+	// after the payload, for streams whose length is unknown up front
+	flagSizeInTrailer = 1 << iota
+	// flagAligned appends zero bytes after everything else so the file size
+	// is a multiple of a block size; the last four bytes hold their count
+	flagAligned
+	// flagBlocks marks a block archive: the header holds an index of
+	// independently compressed blocks instead of a single model
+	flagBlocks
+	// flagStored marks a stream whose payload is the raw input, running to
+	// the end of the stream (or to the alignment padding)
+	flagStored
+	// flagNoSize omits the original size; the decoder stops when the payload
+	// runs out
+	flagNoSize
+	// flagEscape adds an escape symbol byte after the padding; see
+	// BuildFrequencyTableTopK
+	flagEscape
+	// flagFoldCase adds the case of the ASCII letters, which the payload
+	// holds in lowercase, as run lengths before the model
+	flagFoldCase
+	// flagChecksum adds a CRC-32 of the original data as four big-endian
+	// bytes before the model
+	flagChecksum
+	// flagInfoTrailer ends the file with an info trailer; see ReadTrailer
+	flagInfoTrailer
+	// flagExternalCodes marks a stream coded with codes supplied by the
+	// caller: the header holds the size, padding and an ID of the codes
+	// instead of a model
+	flagExternalCodes
+	// flagEncrypted marks an encrypted file: everything after the flags is
+	// a complete compressed stream passed through the caller's cipher
+	flagEncrypted
+	// flagLines marks a line archive: the header holds an index of
+	// byte-aligned line records followed by the one model they share
+	flagLines
+	// flagBlockStats adds the symbol count and entropy of each block after
+	// the index of a block archive
+	flagBlockStats
+	// flagRemap adds the symbols in the order of the byte values that code
+	// them after the checksum; see Options.Remap
+	flagRemap
+	// flagRecords marks a block archive whose blocks are the columns of
+	// fixed-width records, and adds the record size after the index
+	flagRecords
+	// flagPayloadBits adds the length of the payload in bits after the
+	// remap, for streams whose model doesn't give it
+	flagPayloadBits
+
+	knownFlags = flagSizeInTrailer | flagAligned | flagBlocks | flagStored | flagNoSize | flagEscape | flagFoldCase | flagChecksum | flagInfoTrailer | flagExternalCodes | flagEncrypted | flagLines | flagBlockStats | flagRemap | flagRecords | flagPayloadBits
+)
+
+// trailerSize is the length of the size trailer: [Size:8][Padding:1]
+const trailerSize = 9
+
+// TableFormat selects how the Huffman model is stored in a header
+type TableFormat uint8
+
+const (
+	// TableAuto picks whichever encoding is smaller for the input
+	TableAuto TableFormat = iota
+	// TableFrequencies stores each symbol with its count, and the decoder
+	// rebuilds the tree from them
+	TableFrequencies
+	// TableTree stores the shape of the tree itself in pre-order
+	TableTree
+	// TableRanges stores the symbols as runs of consecutive byte values
+	// followed by their counts, which suits contiguous alphabets such as
+	// digits or lowercase letters
+	TableRanges
+	// TableDelta stores the counts as differences from a built-in
+	// BaseModel, which is small for inputs that resemble the base
+	TableDelta
+	// TableNibbles packs the symbols and counts of a tiny alphabet into
+	// 4-bit fields: at most 16 symbols within 16 consecutive byte values,
+	// each counted at most 15 times, as in very small files
+	TableNibbles
+	// TableCoded stores the frequency list, with symbols as gaps, Huffman
+	// coded with a fixed built-in model, which shrinks the tables of large
+	// alphabets
+	TableCoded
+)
+
+// tableFormats lists the encodings TableAuto chooses between
+var tableFormats = []TableFormat{TableFrequencies, TableTree, TableRanges, TableNibbles, TableCoded}
+
+// String returns the name of the table format
+func (f TableFormat) String() string {
+	switch f {
+	case TableAuto:
+		return "auto"
+	case TableFrequencies:
+		return "frequencies"
+	case TableTree:
+		return "tree"
+	case TableRanges:
+		return "ranges"
+	case TableDelta:
+		return "delta"
+	case TableNibbles:
+		return "nibbles"
+	case TableCoded:
+		return "coded"
+	}
+	return fmt.Sprintf("TableFormat(%d)", uint8(f))
+}
+
+// Header describes the metadata stored in front of a compressed payload.
+//
+// Version 1 headers are laid out as
+//
+//	[Magic:1][Version:1][Flags:uvarint][Table:1][Size:uvarint][Padding:1][Model]
+//
+// where Model is a frequency list, a serialized tree, a list of symbol runs,
+// deltas from a base model, nibble-packed counts or a Huffman-coded frequency
+// list depending on Table. Version 0 is the legacy layout without a version
+// byte.
+type Header struct {
+	Version      int
+	Table        TableFormat
+	OriginalSize int64
+	PaddingBits  int
+
+	// SizeInTrailer reports that OriginalSize and PaddingBits were unknown
+	// when the header was written and follow the payload instead
+	SizeInTrailer bool
+	// Aligned reports that the file ends in zero padding for block alignment
+	Aligned bool
+
+	// Blocks indexes the blocks of a block archive, in order. It is nil for
+	// a single stream. A block archive has no model of its own: each block
+	// is a complete stream with its own header.
+	Blocks []BlockInfo
+	// BlockStats describes each block of a block archive written with
+	// ParallelOptions.BlockStats, in the order of Blocks. It is nil
+	// otherwise.
+	BlockStats []BlockStat
+	// RecordSize is the width of the records of an archive written by
+	// CompressFixedRecords, whose blocks hold byte i of every record in
+	// block i. Decoding transposes them back. It is 0 otherwise.
+	RecordSize int
+
+	// Stored reports that the payload is the uncompressed input. A stored
+	// header has no model, and OriginalSize is only known after reading.
+	Stored bool
+
+	// NoSize reports that the header omits the original size. ParseHeader
+	// sets OriginalSize to -1 and the size is derived from the payload.
+	NoSize bool
+
+	// Escaped reports that the model has an escape symbol, Escape, whose
+	// code is followed by a literal byte. See BuildFrequencyTableTopK.
+	Escaped bool
+	Escape  byte
+
+	// CaseRuns holds the case of the ASCII letters of a case-folded stream as
+	// alternating run lengths of lowercase and uppercase letters, starting
+	// with lowercase. It is nil unless the payload was case-folded.
+	CaseRuns []uint64
+
+	// Checksummed reports that the header holds Checksum, the CRC-32 (IEEE)
+	// of the original data, which the decoder checks its output against
+	Checksummed bool
+	Checksum    uint32
+
+	// Remap lists the symbols of a remapped stream in order of frequency:
+	// the payload and model code Remap[i] as the byte value i. It is nil
+	// unless the stream was compressed with Options.Remap.
+	Remap []byte
+
+	// PayloadBits is the length of the payload in bits, recorded when the
+	// model can't give it, as with a tree table, so that QuickVerify can
+	// check the payload's length without decoding it. It is 0 when absent.
+	PayloadBits int64
+
+	// InfoTrailer reports that the file ends in an info trailer, which
+	// ReadTrailer reads
+	InfoTrailer bool
+
+	// ExternalCodes reports that the stream has no model and must be
+	// decoded with the codes it was compressed with, which CodesID
+	// identifies. See CompressFileWithCodes.
+	ExternalCodes bool
+	CodesID       uint32
+
+	// Encrypted reports that the rest of the file is an encrypted stream,
+	// which only DecompressDecrypt reads. See CompressEncrypt.
+	Encrypted bool
+
+	// Lines indexes the records of a line archive, in order: each entry
+	// gives the length of a line, with its newline, and of its record. It
+	// is nil unless the file was written by CompressLines.
+	Lines []BlockInfo
+
+	// Freq holds the symbol counts of a frequency-table header
+	Freq FrequencyTable
+	// Tree holds the decoded tree of a tree header
+	Tree *Node
+	// Base is the model a delta header stores Freq against
+	Base BaseModel
+}
+
+// Root returns the Huffman tree used to decode the payload
+func (h *Header) Root() *Node {
+	if h.Tree != nil {
+		return h.Tree
+	}
+	return BuildHuffmanTree(h.Freq)
+}
+
+// newDecoder returns a decoder for the payload described by h
+func (h *Header) newDecoder(data []byte, root *Node) *decoder {
+	d := newDecoder(data, root, h.OriginalSize, h.PaddingBits)
+	d.escaped, d.escape = h.Escaped, h.Escape
+	if h.CaseRuns != nil {
+		d.caseMap = newCaseMap(h.CaseRuns)
+	}
+	if h.Remap != nil {
+		d.remap = remapTable(h.Remap)
+	}
+	return d
+}
+
+// newHeader builds a header for the given model. A TableAuto format is
+// resolved to the encoding with the smaller serialized size.
+func newHeader(freq FrequencyTable, tree *Node, originalSize int64, paddingBits int, table TableFormat) *Header {
+	h := &Header{
+		Version:      formatVersion,
+		Table:        table,
+		OriginalSize: originalSize,
+		PaddingBits:  paddingBits,
+		Freq:         freq,
+		Tree:         tree,
+	}
+
+	if table == TableAuto {
+		best := -1
+		for _, format := range tableFormats {
+			h.Table = format
+			model, err := appendTable(nil, h)
+			if err == nil && (best < 0 || len(model) < best) {
+				best, table = len(model), format
+			}
+		}
+		h.Table = table
+	}
+
+	return h
+}
+
+// WriteHeader writes a compression header to an output file. The table is
+// stored as a frequency list, or Huffman-coded as a TableCoded table when
+// that is smaller.
+func WriteHeader(writer io.Writer, freq FrequencyTable, originalSize int64, paddingBits int) error {
+	table, _ := writeHeaderTable(freq)
+	return writeHeader(writer, newHeader(freq, nil, originalSize, paddingBits, table))
+}
+
+// writeHeaderTable returns the table format WriteHeader uses for freq and the
+// length of the model in it
+func writeHeaderTable(freq FrequencyTable) (TableFormat, int) {
+	// The symbol count byte, then a symbol byte and a uvarint per symbol
+	model := 1
+	for _, count := range freq {
+		model += 1 + uvarintLen(uint64(count))
+	}
+
+	coded, err := appendCoded(nil, freq)
+	if err == nil && len(coded) < model {
+		return TableCoded, len(coded)
+	}
+	return TableFrequencies, model
+}
+
+// HeaderLen returns the number of bytes WriteHeader writes for freq and an
+// original size equal to the sum of its counts, as it is for a table built
+// from the data being compressed. It returns 0 for an empty table, which
+// WriteHeader rejects.
+func HeaderLen(freq FrequencyTable) int {
+	if len(freq) == 0 {
+		return 0
+	}
+
+	var size uint64
+	for _, count := range freq {
+		size += uint64(count)
+	}
+	_, model := writeHeaderTable(freq)
+
+	// Magic, version, flags (none), table format, size and padding
+	return 2 + uvarintLen(0) + 1 + uvarintLen(size) + 1 + model
+}
+
+// uvarintLen returns the number of bytes binary.AppendUvarint uses for x
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// writeHeader serializes h in the current format version
+func writeHeader(writer io.Writer, h *Header) error {
+	buf, err := appendHeader(nil, h)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(buf)
+	return err
+}
+
+// appendHeader appends the serialized form of h to buf
+func appendHeader(buf []byte, h *Header) ([]byte, error) {
+	var flags uint64
+	if h.SizeInTrailer {
+		flags |= flagSizeInTrailer
+	}
+	if h.Aligned {
+		flags |= flagAligned
+	}
+	if h.Blocks != nil {
+		flags |= flagBlocks
+	}
+	if h.Stored {
+		flags |= flagStored
+	}
+	if h.NoSize {
+		flags |= flagNoSize
+	}
+	if h.Escaped {
+		flags |= flagEscape
+	}
+	if h.CaseRuns != nil {
+		flags |= flagFoldCase
+	}
+	if h.Checksummed {
+		flags |= flagChecksum
+	}
+	if h.InfoTrailer {
+		flags |= flagInfoTrailer
+	}
+	if h.ExternalCodes {
+		flags |= flagExternalCodes
+	}
+	if h.Encrypted {
+		flags |= flagEncrypted
+	}
+	if h.Lines != nil {
+		flags |= flagLines
+	}
+	if h.BlockStats != nil {
+		flags |= flagBlockStats
+	}
+	if h.Remap != nil {
+		flags |= flagRemap
+	}
+	if h.RecordSize > 0 {
+		flags |= flagRecords
+	}
+	if h.PayloadBits > 0 {
+		flags |= flagPayloadBits
+	}
+
+	buf = append(buf, magicByte, versionFlag|formatVersion)
+	buf = binary.AppendUvarint(buf, flags)
+
+	if h.Blocks != nil {
+		buf = appendBlockIndex(buf, h.Blocks)
+		if h.BlockStats != nil {
+			var err error
+			if buf, err = appendBlockStats(buf, h); err != nil {
+				return nil, err
+			}
+		}
+		if h.RecordSize > 0 {
+			buf = binary.AppendUvarint(buf, uint64(h.RecordSize))
+		}
+		return buf, nil
+	}
+	if h.Lines != nil {
+		return appendLineIndex(buf, h)
+	}
+	if h.Stored || h.Encrypted {
+		return buf, nil
+	}
+	if h.ExternalCodes {
+		return appendExternalCodes(buf, h), nil
+	}
+
+	buf = append(buf, byte(h.Table))
+	if !h.NoSize {
+		buf = binary.AppendUvarint(buf, uint64(h.OriginalSize))
+	}
+	buf = append(buf, byte(h.PaddingBits))
+	if h.Escaped {
+		buf = append(buf, h.Escape)
+	}
+	if h.CaseRuns != nil {
+		buf = binary.AppendUvarint(buf, uint64(len(h.CaseRuns)))
+		for _, run := range h.CaseRuns {
+			buf = binary.AppendUvarint(buf, run)
+		}
+	}
+	if h.Checksummed {
+		buf = binary.BigEndian.AppendUint32(buf, h.Checksum)
+	}
+	if h.Remap != nil {
+		if len(h.Remap) == 0 || len(h.Remap) > 256 {
+			return nil, fmt.Errorf("invalid remap size %d", len(h.Remap))
+		}
+		buf = append(buf, byte(len(h.Remap)-1))
+		buf = append(buf, h.Remap...)
+	}
+	if h.PayloadBits > 0 {
+		buf = binary.AppendUvarint(buf, uint64(h.PayloadBits))
+	}
+
+	return appendTable(buf, h)
+}
+
+// appendTable appends the model of h in its table format
+func appendTable(buf []byte, h *Header) ([]byte, error) {
+	switch h.Table {
+	case TableFrequencies, TableRanges:
+		if len(h.Freq) == 0 || len(h.Freq) > 256 {
+			return nil, fmt.Errorf("invalid frequency table size %d", len(h.Freq))
+		}
+		if h.Table == TableRanges {
+			return appendRanges(buf, h.Freq), nil
+		}
+		return appendFrequencies(buf, h.Freq), nil
+	case TableTree:
+		if h.Tree == nil {
+			return nil, fmt.Errorf("missing huffman tree")
+		}
+		return appendTree(buf, h.Tree), nil
+	case TableDelta:
+		return appendDelta(buf, h.Freq, h.Base)
+	case TableNibbles:
+		return appendNibbles(buf, h.Freq)
+	case TableCoded:
+		return appendCoded(buf, h.Freq)
+	}
+	return nil, fmt.Errorf("unsupported table format %v", h.Table)
+}
+
+// appendFrequencies serializes a frequency table as a symbol count followed by
+// symbol and uvarint count pairs in ascending symbol order
+func appendFrequencies(buf []byte, freq FrequencyTable) []byte {
+	symbols := make([]int, 0, len(freq))
+	for char := range freq {
+		symbols = append(symbols, int(char))
+	}
+	sort.Ints(symbols)
+
+	// Store the count minus one so that all 256 symbols fit in a byte
+	buf = append(buf, byte(len(freq)-1))
+	for _, char := range symbols {
+		buf = append(buf, byte(char))
+		buf = binary.AppendUvarint(buf, uint64(freq[byte(char)]))
+	}
+	return buf
+}
+
+// appendRanges serializes a frequency table as runs of consecutive symbols,
+// each a start byte and length minus one, followed by the uvarint counts of
+// every symbol in order
+func appendRanges(buf []byte, freq FrequencyTable) []byte {
+	type run struct{ start, length int }
+	var runs []run
+	for i := 0; i < 256; i++ {
+		if _, ok := freq[byte(i)]; !ok {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].start+runs[n-1].length == i {
+			runs[n-1].length++
+		} else {
+			runs = append(runs, run{start: i, length: 1})
+		}
+	}
+
+	// At most 128 runs fit in 256 symbols, so the count fits in a byte
+	buf = append(buf, byte(len(runs)-1))
+	for _, r := range runs {
+		buf = append(buf, byte(r.start), byte(r.length-1))
+	}
+	for _, r := range runs {
+		for i := r.start; i < r.start+r.length; i++ {
+			buf = binary.AppendUvarint(buf, uint64(freq[byte(i)]))
+		}
+	}
+	return buf
+}
+
+// appendTree serializes a tree in pre-order: a 0 bit for an internal node
+// followed by its children, or a 1 bit and eight symbol bits for a leaf
+func appendTree(buf []byte, root *Node) []byte {
+	w := bitWriter{buf: buf}
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		if node.Left == nil && node.Right == nil {
+			w.writeBit(1)
+			w.writeBits(uint64(node.Char), 8)
+			return
+		}
+		w.writeBit(0)
+		walk(node.Left)
+		walk(node.Right)
+	}
+	walk(root)
+	return w.buf
+}
+
+// DetectFormat sniffs the leading bytes of a file for the magic numbers of
+// common compressed formats. It returns "huffman" for files written by this
+// package, "gzip" or "zip" for those formats, and "" when nothing is
+// recognized. A lone 'H' is ambiguous with text, so a huffman match also
+// requires a plausible version byte or legacy padding field.
+func DetectFormat(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == magicByte && b[1] == versionFlag|formatVersion:
+		return "huffman"
+	case len(b) >= 7 && b[0] == magicByte && b[1]&versionFlag == 0 && b[5] <= 7:
+		return "huffman"
+	case len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b:
+		return "gzip"
+	case len(b) >= 4 && b[0] == 'P' && b[1] == 'K' &&
+		(b[2] == 3 && b[3] == 4 || b[2] == 5 && b[3] == 6 || b[2] == 7 && b[3] == 8):
+		return "zip"
+	}
+	return ""
+}
+
+// ReadHeader reads compression header from an input file. Legacy version 0
+// headers are dispatched to their own parser and read the same way.
+func ReadHeader(reader io.Reader) (FrequencyTable, int64, int, error) {
+	h, err := ParseHeader(reader)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if h.Freq == nil {
+		return nil, 0, 0, fmt.Errorf("header stores a %v table, use ParseHeader", h.Table)
+	}
+	if h.Remap != nil {
+		return nil, 0, 0, fmt.Errorf("header is remapped, so its table counts ranks rather than bytes; use ParseHeader")
+	}
+	return h.Freq, h.OriginalSize, h.PaddingBits, nil
+}
+
+// ParseHeader reads a header of any supported version. It consumes exactly
+// the header bytes, leaving reader positioned at the start of the payload.
+//
+// When the length of the rest of the stream is known, because reader is a
+// bytes.Reader, an *os.File or another reader with a Len method or that can
+// seek, every size the header declares is checked against it before the
+// entries are read, and a header that can't fit fails with ErrInvalidFormat.
+func ParseHeader(reader io.Reader) (*Header, error) {
+	br := asByteReader(reader)
+	if remaining := remainingLen(reader); remaining >= 0 {
+		br = &boundedReader{byteReadReader: br, remaining: remaining}
+	}
+
+	// Read and verify the magic byte
+	magic, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read magic byte: %w", err)
+	}
+	if magic != magicByte {
+		return nil, ErrInvalidFormat
+	}
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version&versionFlag == 0 {
+		return readLegacyHeader(br, version)
+	}
+
+	version &^= versionFlag
+	if version != formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d", version)
+	}
+
+	flags, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if flags&^knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported header flags %#x", flags)
+	}
+
+	if flags&(flagBlocks|flagBlockStats|flagRecords) != 0 {
+		if flags&^(flagBlockStats|flagRecords) != flagBlocks {
+			return nil, fmt.Errorf("unsupported header flags %#x", flags)
+		}
+		h, err := readBlockIndex(br, int(version))
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagBlockStats != 0 {
+			if h.BlockStats, err = readBlockStats(br, h.Blocks); err != nil {
+				return nil, err
+			}
+		}
+		if flags&flagRecords != 0 {
+			if h.RecordSize, err = readRecordSize(br, h.Blocks); err != nil {
+				return nil, err
+			}
+		}
+		return h, nil
+	}
+	if flags&flagStored != 0 {
+		if flags&^(flagStored|flagAligned) != 0 {
+			return nil, fmt.Errorf("unsupported header flags %#x", flags)
+		}
+		return &Header{Version: int(version), Stored: true, Aligned: flags&flagAligned != 0}, nil
+	}
+	if flags&flagExternalCodes != 0 {
+		if flags != flagExternalCodes {
+			return nil, fmt.Errorf("unsupported header flags %#x", flags)
+		}
+		return readExternalCodes(br, int(version))
+	}
+	if flags&flagEncrypted != 0 {
+		if flags != flagEncrypted {
+			return nil, fmt.Errorf("unsupported header flags %#x", flags)
+		}
+		return &Header{Version: int(version), Encrypted: true}, nil
+	}
+	if flags&flagLines != 0 {
+		if flags != flagLines {
+			return nil, fmt.Errorf("unsupported header flags %#x", flags)
+		}
+		return readLineIndex(br, int(version))
+	}
+
+	if flags&flagNoSize != 0 && flags&flagSizeInTrailer != 0 {
+		return nil, fmt.Errorf("unsupported header flags %#x", flags)
+	}
+
+	table, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	originalSize := int64(-1)
+	if flags&flagNoSize == 0 {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if size > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid original size %d", size)
+		}
+		originalSize = int64(size)
+	}
+
+	paddingBits, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if paddingBits > 7 {
+		return nil, fmt.Errorf("invalid padding %d", paddingBits)
+	}
+
+	var escape byte
+	if flags&flagEscape != 0 {
+		if escape, err = br.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	var caseRuns []uint64
+	if flags&flagFoldCase != 0 {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if err := need(br, count, 1, "case runs"); err != nil {
+			return nil, err
+		}
+		// Every run takes at least a byte, so don't trust a huge count for
+		// the initial allocation
+		caseRuns = make([]uint64, 0, min(count, 1<<16))
+		for i := uint64(0); i < count; i++ {
+			run, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, err
+			}
+			caseRuns = append(caseRuns, run)
+		}
+	}
+
+	var checksum uint32
+	if flags&flagChecksum != 0 {
+		var sum [4]byte
+		if _, err := io.ReadFull(br, sum[:]); err != nil {
+			return nil, err
+		}
+		checksum = binary.BigEndian.Uint32(sum[:])
+	}
+
+	var remap []byte
+	if flags&flagRemap != 0 {
+		if remap, err = readRemap(br); err != nil {
+			return nil, err
+		}
+	}
+
+	var payloadBits uint64
+	if flags&flagPayloadBits != 0 {
+		if payloadBits, err = binary.ReadUvarint(br); err != nil {
+			return nil, err
+		}
+		if payloadBits == 0 || payloadBits > math.MaxInt64 || int((8-payloadBits%8)%8) != int(paddingBits) {
+			return nil, fmt.Errorf("invalid payload length %d bits with padding %d", payloadBits, paddingBits)
+		}
+	}
+
+	h := &Header{
+		Version:       int(version),
+		Table:         TableFormat(table),
+		OriginalSize:  originalSize,
+		PaddingBits:   int(paddingBits),
+		SizeInTrailer: flags&flagSizeInTrailer != 0,
+		NoSize:        flags&flagNoSize != 0,
+		Escaped:       flags&flagEscape != 0,
+		Escape:        escape,
+		CaseRuns:      caseRuns,
+		Checksummed:   flags&flagChecksum != 0,
+		InfoTrailer:   flags&flagInfoTrailer != 0,
+		Checksum:      checksum,
+		Remap:         remap,
+		PayloadBits:   int64(payloadBits),
+		Aligned:       flags&flagAligned != 0,
+	}
+
+	if err := readTable(br, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// readTable reads the model of h in its table format
+func readTable(br byteReadReader, h *Header) error {
+	var err error
+	switch h.Table {
+	case TableFrequencies:
+		h.Freq, err = readFrequencies(br)
+	case TableTree:
+		h.Tree, err = readTree(br)
+	case TableRanges:
+		h.Freq, err = readRanges(br)
+	case TableDelta:
+		h.Base, h.Freq, err = readDelta(br)
+	case TableNibbles:
+		h.Freq, err = readNibbles(br)
+	case TableCoded:
+		h.Freq, err = readCoded(br)
+	default:
+		err = fmt.Errorf("unsupported table format %v", h.Table)
+	}
+	return err
+}
+
+// alignmentPad returns the zero padding, including its four-byte length, that
+// makes n bytes a multiple of blockSize
+func alignmentPad(n int64, blockSize int) []byte {
+	padLen := (int64(blockSize) - (n+4)%int64(blockSize)) % int64(blockSize)
+	pad := make([]byte, padLen+4)
+	binary.BigEndian.PutUint32(pad[padLen:], uint32(padLen+4))
+	return pad
+}
+
+// splitTrailer strips the info trailer, alignment padding and size trailer
+// from payload when the header has them, filling in the header's size and
+// padding bits
+func splitTrailer(h *Header, payload []byte) ([]byte, error) {
+	if h.InfoTrailer {
+		if _, err := parseInfoTrailer(payload); err != nil {
+			return nil, err
+		}
+		payload = payload[:len(payload)-infoTrailerSize]
+	}
+
+	if h.Aligned {
+		if len(payload) < 4 {
+			return nil, fmt.Errorf("missing alignment trailer")
+		}
+		padLen := binary.BigEndian.Uint32(payload[len(payload)-4:])
+		if padLen < 4 || uint64(padLen) > uint64(len(payload)) {
+			return nil, fmt.Errorf("invalid alignment length %d", padLen)
+		}
+		payload = payload[:len(payload)-int(padLen)]
+	}
+
+	if !h.SizeInTrailer {
+		return payload, nil
+	}
+	if len(payload) < trailerSize {
+		return nil, fmt.Errorf("missing size trailer")
+	}
+
+	trailer := payload[len(payload)-trailerSize:]
+	originalSize := binary.BigEndian.Uint64(trailer)
+	if originalSize > math.MaxInt64 {
+		return nil, fmt.Errorf("invalid original size %d", originalSize)
+	}
+	if trailer[8] > 7 {
+		return nil, fmt.Errorf("invalid padding %d", trailer[8])
+	}
+
+	h.OriginalSize = int64(originalSize)
+	h.PaddingBits = int(trailer[8])
+	return payload[:len(payload)-trailerSize], nil
+}
+
+// appendLegacyHeader appends h in the version 0 layout read by
+// readLegacyHeader. The layout cannot hold every header: the size must leave
+// the high bit of its first byte clear, so it is not mistaken for a version
+// byte, and the table is limited to 255 symbols with counts below 65,536.
+func appendLegacyHeader(buf []byte, h *Header) ([]byte, error) {
+	if h.OriginalSize > math.MaxInt32 {
+		return nil, fmt.Errorf("original size %d is too large for the legacy format", h.OriginalSize)
+	}
+	if len(h.Freq) > math.MaxUint8 {
+		return nil, fmt.Errorf("%d symbols are too many for the legacy format", len(h.Freq))
+	}
+
+	buf = append(buf, magicByte)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(h.OriginalSize))
+	buf = append(buf, byte(h.PaddingBits), byte(len(h.Freq)))
+	for i := 0; i < 256; i++ {
+		count, ok := h.Freq[byte(i)]
+		if !ok {
+			continue
+		}
+		if count > math.MaxUint16 {
+			return nil, fmt.Errorf("count %d of symbol %s is too large for the legacy format", count, formatByte(byte(i)))
+		}
+		buf = append(buf, byte(i))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(count))
+	}
+	return buf, nil
+}
+
+// readLegacyHeader parses the version 0 layout written before the format was
+// versioned:
+//
+//	[Magic:1][FileSize:4][Padding:1][TableSize:1][FreqTable:N×3]
+//
+// sizeHigh is the first byte of the file size, already consumed while looking
+// for a version byte.
+func readLegacyHeader(reader byteReadReader, sizeHigh byte) (*Header, error) {
+	// Read the rest of the original file size as uint32
+	var sizeLow [3]byte
+	if _, err := io.ReadFull(reader, sizeLow[:]); err != nil {
+		return nil, err
+	}
+	originalSize := binary.BigEndian.Uint32([]byte{sizeHigh, sizeLow[0], sizeLow[1], sizeLow[2]})
+
+	// Read padding bits as a separate byte
+	var paddingBits uint8
+	if err := binary.Read(reader, binary.BigEndian, &paddingBits); err != nil {
+		return nil, err
+	}
+
+	// Read table size as a full byte (supports 0-255 unique characters)
+	var tableSize uint8
+	if err := binary.Read(reader, binary.BigEndian, &tableSize); err != nil {
+		return nil, err
+	}
+	if err := need(reader, uint64(tableSize), 3, "frequency table entries"); err != nil {
+		return nil, err
+	}
+
+	// Read the frequency table
+	freq := make(FrequencyTable)
+	for i := uint8(0); i < tableSize; i++ {
+		var char byte
+		if err := binary.Read(reader, binary.BigEndian, &char); err != nil {
+			return nil, err
+		}
+
+		// Read frequency as uint16 (supports counts up to 65,535)
+		var count uint16
+		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+
+		freq[char] = int(count)
+	}
+
+	return &Header{
+		Version:      0,
+		Table:        TableFrequencies,
+		OriginalSize: int64(originalSize),
+		PaddingBits:  int(paddingBits),
+		Freq:         freq,
+	}, nil
+}
+
+// readFrequencies parses a table written by appendFrequencies
+func readFrequencies(br io.ByteReader) (FrequencyTable, error) {
+	sizeMinusOne, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	// Each entry takes a symbol byte and at least one count byte
+	if err := need(br, uint64(sizeMinusOne)+1, 2, "frequency table entries"); err != nil {
+		return nil, err
+	}
+
+	freq := make(FrequencyTable)
+	for i := 0; i <= int(sizeMinusOne); i++ {
+		char, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if count > math.MaxInt {
+			return nil, fmt.Errorf("frequency %d out of range", count)
+		}
+		if _, ok := freq[char]; ok {
+			return nil, fmt.Errorf("duplicate symbol 0x%02x in frequency table", char)
+		}
+		freq[char] = int(count)
+	}
+	return freq, nil
+}
+
+// readRanges parses a table written by appendRanges
+func readRanges(br io.ByteReader) (FrequencyTable, error) {
+	runCountMinusOne, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if err := need(br, uint64(runCountMinusOne)+1, 2, "symbol runs"); err != nil {
+		return nil, err
+	}
+
+	var symbols []byte
+	seen := make(map[byte]bool)
+	for i := 0; i <= int(runCountMinusOne); i++ {
+		start, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		lengthMinusOne, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if int(start)+int(lengthMinusOne) > 255 {
+			return nil, fmt.Errorf("symbol run 0x%02x+%d out of range", start, int(lengthMinusOne)+1)
+		}
+		for j := int(start); j <= int(start)+int(lengthMinusOne); j++ {
+			if seen[byte(j)] {
+				return nil, fmt.Errorf("duplicate symbol 0x%02x in symbol runs", j)
+			}
+			seen[byte(j)] = true
+			symbols = append(symbols, byte(j))
+		}
+	}
+
+	if err := need(br, uint64(len(symbols)), 1, "symbol counts"); err != nil {
+		return nil, err
+	}
+	freq := make(FrequencyTable, len(symbols))
+	for _, char := range symbols {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if count > math.MaxInt {
+			return nil, fmt.Errorf("frequency %d out of range", count)
+		}
+		freq[char] = int(count)
+	}
+	return freq, nil
+}
+
+// readTree parses a tree written by appendTree
+func readTree(br io.ByteReader) (*Node, error) {
+	r := bitReader{r: br}
+	seen := make(map[byte]bool)
+
+	var read func(depth int) (*Node, error)
+	read = func(depth int) (*Node, error) {
+		// A tree over 256 symbols can never be deeper than 255 levels
+		if depth > 255 {
+			return nil, fmt.Errorf("serialized tree too deep")
+		}
+
+		bit, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+
+		if bit == 1 {
+			char, err := r.readBits(8)
+			if err != nil {
+				return nil, err
+			}
+			if seen[byte(char)] {
+				return nil, fmt.Errorf("duplicate symbol 0x%02x in serialized tree", char)
+			}
+			seen[byte(char)] = true
+			return &Node{Char: byte(char)}, nil
+		}
+
+		left, err := read(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		right, err := read(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Left: left, Right: right}, nil
+	}
+
+	return read(0)
+}
+
+// byteReader adapts an io.Reader to io.ByteReader without reading ahead, so
+// the underlying reader stays positioned right after the last byte consumed
+type byteReader struct {
+	io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.Reader, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
+
+// boundedReader counts down the bytes left in a stream of known length, so
+// sizes declared in a header can be checked before their entries are read
+type boundedReader struct {
+	byteReadReader
+	remaining int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	n, err := b.byteReadReader.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *boundedReader) ReadByte() (byte, error) {
+	c, err := b.byteReadReader.ReadByte()
+	if err == nil {
+		b.remaining--
+	}
+	return c, err
+}
+
+// need returns ErrInvalidFormat if br is a boundedReader with too few bytes
+// left for entries of at least entrySize bytes each. Other readers aren't
+// checked.
+func need(br io.ByteReader, entries, entrySize uint64, what string) error {
+	b, ok := br.(*boundedReader)
+	if !ok {
+		return nil
+	}
+	if remaining := uint64(max(b.remaining, 0)); entries > remaining/entrySize {
+		return fmt.Errorf("%w: %d %s need at least %d bytes each, only %d bytes remain", ErrInvalidFormat, entries, what, entrySize, remaining)
+	}
+	return nil
+}
+
+// remainingLen returns the number of bytes left in reader, or -1 if it
+// can't tell without reading
+func remainingLen(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case *boundedReader:
+		return r.remaining
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case io.Seeker:
+		current, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := r.Seek(current, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - current
+	}
+	return -1
+}
+
+// byteReadReader is a reader that can also be read a byte at a time
+type byteReadReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func asByteReader(reader io.Reader) byteReadReader {
+	if br, ok := reader.(byteReadReader); ok {
+		return br
+	}
+	return &byteReader{Reader: reader}
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first
+type bitWriter struct {
+	buf   []byte
+	nbits int // bits used in the last byte of buf, 0 when it is full
+}
+
+func (w *bitWriter) writeBit(bit byte) {
+	if w.nbits == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit != 0 {
+		w.buf[len(w.buf)-1] |= 1 << (7 - w.nbits)
+	}
+	w.nbits = (w.nbits + 1) % 8
+}
+
+func (w *bitWriter) writeBits(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(byte(value>>i) & 1)
+	}
+}
+
+// writeCode writes a code spelled out in '0' and '1' characters
+func (w *bitWriter) writeCode(code string) {
+	for i := 0; i < len(code); i++ {
+		w.writeBit(code[i] - '0')
+	}
+}
+
+// bitReader reads bits from a byte stream, most significant bit first
+type bitReader struct {
+	r     io.ByteReader
+	cur   byte
+	nbits int // unread bits left in cur
+}
+
+func (r *bitReader) readBit() (byte, error) {
+	if r.nbits == 0 {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		r.cur = b
+		r.nbits = 8
+	}
+	r.nbits--
+	return (r.cur >> r.nbits) & 1, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var value uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | uint64(bit)
+	}
+	return value, nil
+}
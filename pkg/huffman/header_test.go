@@ -0,0 +1,733 @@
+package huffman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTreeSerializationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		freq FrequencyTable
+	}{
+		{"single character", FrequencyTable{'a': 5}},
+		{"three characters", FrequencyTable{'a': 3, 'b': 2, 'c': 1}},
+		{"extreme bytes", FrequencyTable{0x00: 7, 0xFF: 1, 0x80: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := BuildHuffmanTree(tt.freq)
+			serialized := appendTree(nil, tree)
+
+			decoded, err := readTree(bytes.NewReader(serialized))
+			if err != nil {
+				t.Fatalf("readTree error: %v", err)
+			}
+
+			expected := GenerateCodeTable(tree)
+			if got := GenerateCodeTable(decoded); !reflect.DeepEqual(expected, got) {
+				t.Errorf("Codes don't match.\nExpected: %v\nGot: %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestCompressTableFormats(t *testing.T) {
+	sparse := make([]byte, 0, 200*4)
+	for i := 0; i < 200; i++ {
+		for j := 0; j <= i%4; j++ {
+			sparse = append(sparse, byte(i))
+		}
+	}
+
+	// A frequency entry takes at least two bytes where a tree leaf takes ten
+	// bits, so the tree wins for a few symbols, but the counts of a large
+	// alphabet code smaller than its tree's leaves
+	tests := []struct {
+		name string
+		data []byte
+		auto TableFormat
+	}{
+		{"small dense alphabet", bytes.Repeat([]byte("abcdabcaba"), 50), TableTree},
+		{"sparse large alphabet", sparse, TableCoded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "input.txt")
+			if err := os.WriteFile(inputPath, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			sizes := make(map[TableFormat]int64)
+			for _, format := range []TableFormat{TableFrequencies, TableTree, TableRanges, TableCoded, TableAuto} {
+				compressedPath := filepath.Join(tmpDir, format.String()+".huf")
+				decompressedPath := filepath.Join(tmpDir, format.String()+".dec")
+
+				if err := CompressFileWithOptions(inputPath, compressedPath, Options{Table: format}); err != nil {
+					t.Fatalf("Compression with %v table failed: %v", format, err)
+				}
+
+				compressed, err := os.ReadFile(compressedPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sizes[format] = int64(len(compressed))
+
+				header, err := ParseHeader(bytes.NewReader(compressed))
+				if err != nil {
+					t.Fatalf("ParseHeader error: %v", err)
+				}
+				want := format
+				if want == TableAuto {
+					want = tt.auto
+				}
+				if header.Table != want {
+					t.Errorf("Expected %v table in header, got %v", want, header.Table)
+				}
+
+				if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+					t.Fatalf("Decompression with %v table failed: %v", format, err)
+				}
+				decompressed, err := os.ReadFile(decompressedPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(tt.data, decompressed) {
+					t.Errorf("Decompressed data doesn't match original for %v table", format)
+				}
+			}
+
+			smallest := min(sizes[TableFrequencies], sizes[TableTree], sizes[TableRanges], sizes[TableCoded])
+			if sizes[TableAuto] != smallest {
+				t.Errorf("Expected auto table to pick the smaller header (%d bytes), got %d bytes", smallest, sizes[TableAuto])
+			}
+		})
+	}
+}
+
+func TestHeaderLen(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+	full := make(FrequencyTable)
+	for i := 0; i < 256; i++ {
+		full[byte(i)] = 1 + rng.Intn(1<<uint(1+i%30))
+	}
+
+	tests := []struct {
+		name string
+		freq FrequencyTable
+	}{
+		{"single symbol", FrequencyTable{'a': 1}},
+		{"small counts", FrequencyTable{'a': 5, 'b': 9, 'c': 127}},
+		{"two-byte counts", FrequencyTable{'a': 128, 'b': 16383, 'c': 16384}},
+		{"large counts", FrequencyTable{0x00: 1 << 40, 0xFF: 3}},
+		{"text", BuildFrequencyTableFromData(blockTestData())},
+		{"all 256", full},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var size int64
+			for _, count := range tt.freq {
+				size += int64(count)
+			}
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, tt.freq, size, 3); err != nil {
+				t.Fatalf("WriteHeader error: %v", err)
+			}
+			if got := HeaderLen(tt.freq); got != buf.Len() {
+				t.Errorf("HeaderLen returned %d, WriteHeader wrote %d bytes", got, buf.Len())
+			}
+		})
+	}
+
+	if got := HeaderLen(nil); got != 0 {
+		t.Errorf("Expected 0 for an empty table, got %d", got)
+	}
+}
+
+func TestParseHeaderRejectsUnknownVersion(t *testing.T) {
+	_, err := ParseHeader(bytes.NewReader([]byte{magicByte, versionFlag | 0x7F, 0}))
+	if err == nil {
+		t.Error("Expected error for unknown format version")
+	}
+}
+
+func TestDecompressLegacyFile(t *testing.T) {
+	// legacy_v0.huf was written by the compressor before headers were versioned
+	compressedPath := filepath.Join("testdata", "legacy_v0.huf")
+	expected, err := os.ReadFile(filepath.Join("testdata", "legacy_v0.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ParseHeader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if header.Version != 0 {
+		t.Errorf("Expected legacy version 0, got %d", header.Version)
+	}
+	if header.OriginalSize != int64(len(expected)) {
+		t.Errorf("Expected original size %d, got %d", len(expected), header.OriginalSize)
+	}
+
+	decompressedPath := filepath.Join(t.TempDir(), "legacy.txt")
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nExpected: %s\nGot: %s", expected, decompressed)
+	}
+}
+
+func TestRecompressLegacyFile(t *testing.T) {
+	expected, err := os.ReadFile(filepath.Join("testdata", "legacy_v0.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	recompressedPath := filepath.Join(tmpDir, "recompressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+
+	if err := Recompress(filepath.Join("testdata", "legacy_v0.huf"), recompressedPath); err != nil {
+		t.Fatalf("Recompress failed: %v", err)
+	}
+
+	recompressed, err := os.ReadFile(recompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ParseHeader(bytes.NewReader(recompressed))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if header.Version != formatVersion {
+		t.Errorf("Expected version %d, got %d", formatVersion, header.Version)
+	}
+
+	if err := DecompressFile(recompressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nExpected: %s\nGot: %s", expected, decompressed)
+	}
+}
+
+func TestCompressPadTo(t *testing.T) {
+	data := bytes.Repeat([]byte("block aligned output "), 40)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CompressFileWithOptions(inputPath, compressedPath, Options{PadTo: 512}); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	info, err := os.Stat(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 || info.Size()%512 != 0 {
+		t.Errorf("Expected size to be a non-zero multiple of 512, got %d", info.Size())
+	}
+
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(data), len(decompressed))
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	var versioned bytes.Buffer
+	if err := WriteHeader(&versioned, FrequencyTable{'a': 3, 'b': 1}, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := os.ReadFile(filepath.Join("testdata", "legacy_v0.huf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"huffman", versioned.Bytes(), "huffman"},
+		{"legacy huffman", legacy, "huffman"},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, "gzip"},
+		{"zip", []byte("PK\x03\x04\x14\x00"), "zip"},
+		{"plain text", []byte("Hello, world!\n"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRangesTable(t *testing.T) {
+	data := bytes.Repeat([]byte("3141592653589793238462643383279502884197"), 20)
+	freq := BuildFrequencyTableFromData(data)
+
+	flat := appendFrequencies(nil, freq)
+	ranges := appendRanges(nil, freq)
+	if len(ranges) >= len(flat) {
+		t.Errorf("Expected ranges table to be smaller than the flat list: %d vs %d bytes", len(ranges), len(flat))
+	}
+
+	decoded, err := readRanges(bytes.NewReader(ranges))
+	if err != nil {
+		t.Fatalf("readRanges error: %v", err)
+	}
+	if !reflect.DeepEqual(freq, decoded) {
+		t.Errorf("Frequency tables don't match.\nExpected: %v\nGot: %v", freq, decoded)
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "digits.txt")
+	compressedPath := filepath.Join(tmpDir, "digits.huf")
+	decompressedPath := filepath.Join(tmpDir, "digits.dec")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFileWithOptions(inputPath, compressedPath, Options{Table: TableRanges}); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nExpected: %s\nGot: %s", data, decompressed)
+	}
+}
+
+func TestOmitSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		noSize bool
+	}{
+		{"derivable", []byte("abracadabra, abracadabra"), true},
+		{"single symbol", bytes.Repeat([]byte("a"), 1000), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var withSize, withoutSize bytes.Buffer
+			if err := Compress(bytes.NewReader(tt.data), &withSize, Options{}); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+			if err := Compress(bytes.NewReader(tt.data), &withoutSize, Options{OmitSize: true}); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+
+			header, err := ParseHeader(bytes.NewReader(withoutSize.Bytes()))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if header.NoSize != tt.noSize {
+				t.Errorf("Expected NoSize=%v, got %v", tt.noSize, header.NoSize)
+			}
+			if tt.noSize && withoutSize.Len() >= withSize.Len() {
+				t.Errorf("Expected omitting the size to shrink the output, got %d >= %d bytes", withoutSize.Len(), withSize.Len())
+			}
+
+			_, decoded, err := readCompressed(bytes.NewReader(withoutSize.Bytes()))
+			if err != nil {
+				t.Fatalf("readCompressed error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded) {
+				t.Errorf("Decoded data doesn't match original.\nOriginal: %q\nDecoded: %q", tt.data, decoded)
+			}
+
+			var streamed bytes.Buffer
+			if err := Decompress(&withoutSize, &streamed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, streamed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original.\nOriginal: %q\nDecompressed: %q", tt.data, streamed.Bytes())
+			}
+		})
+	}
+}
+
+func TestDecodeDataDerivedSize(t *testing.T) {
+	data := []byte("mississippi")
+	tree := BuildHuffmanTree(BuildFrequencyTableFromData(data))
+	codes := GenerateCodeTable(tree)
+	encoded := EncodeData(data, codes)
+
+	totalBits := 0
+	for _, b := range data {
+		totalBits += len(codes[b])
+	}
+	padding := (8 - totalBits%8) % 8
+
+	decoded, err := DecodeData(encoded, tree, -1, padding)
+	if err != nil {
+		t.Fatalf("DecodeData error: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Errorf("Expected %q, got %q", data, decoded)
+	}
+
+	single := BuildHuffmanTree(FrequencyTable{'a': 3})
+	if _, err := DecodeData(nil, single, -1, 0); err == nil {
+		t.Error("Expected an error deriving the size of a single-symbol stream")
+	}
+}
+
+func TestCompressLegacyLimits(t *testing.T) {
+	// A count of 65,536 does not fit the legacy uint16 field
+	data := append(bytes.Repeat([]byte("a"), 65536), 'b')
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &compressed, Options{Legacy: true}); err == nil {
+		t.Error("Expected an error for a count beyond the legacy limit")
+	}
+
+	if err := Compress(bytes.NewReader([]byte("ab")), &compressed, Options{Legacy: true, PadTo: 512}); err == nil {
+		t.Error("Expected an error combining Legacy with PadTo")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data := bytes.Repeat([]byte("checksums are hashed while the file is read "), 500)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := CompressFileResultWithOptions(inputPath, compressedPath, Options{Checksum: true})
+	if err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	if sum := sha256.Sum256(data); result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Streamed SHA-256 %s doesn't match %x", result.SHA256, sum)
+	}
+
+	compressed, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ParseHeader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if want := crc32.ChecksumIEEE(data); !header.Checksummed || header.Checksum != want {
+		t.Fatalf("Expected streamed checksum %#x, got %#x (checksummed %v)", want, header.Checksum, header.Checksummed)
+	}
+
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+
+	// Corrupt the stored checksum
+	stored := binary.BigEndian.AppendUint32(nil, header.Checksum)
+	at := bytes.Index(compressed, stored)
+	compressed[at] ^= 0xFF
+	if err := os.WriteFile(compressedPath, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecompressFile(compressedPath, decompressedPath); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch from DecompressFile, got %v", err)
+	}
+	if err := Decompress(bytes.NewReader(compressed), io.Discard); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch from Decompress, got %v", err)
+	}
+	if err := DecompressToFileMmap(compressedPath, decompressedPath); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch from DecompressToFileMmap, got %v", err)
+	}
+}
+
+func TestDecompressFileChecksumCleanup(t *testing.T) {
+	data := bytes.Repeat([]byte("output is hashed as it is written "), 300)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFileWithOptions(inputPath, compressedPath, Options{Checksum: true}); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	compressed, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goodPath := filepath.Join(tmpDir, "good.txt")
+	if err := DecompressFile(compressedPath, goodPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(goodPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+
+	// Tamper with the stored checksum so the written bytes no longer match it
+	stored := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	compressed[bytes.Index(compressed, stored)] ^= 0x01
+	tamperedPath := filepath.Join(tmpDir, "tampered.huf")
+	if err := os.WriteFile(tamperedPath, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	badPath := filepath.Join(tmpDir, "bad.txt")
+	if err := DecompressFile(tamperedPath, badPath); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(badPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the output of a failed decompression to be removed, got %v", err)
+	}
+}
+
+func TestCodedTable(t *testing.T) {
+	full := make(FrequencyTable)
+	for i := 0; i < 256; i++ {
+		full[byte(i)] = 1 + i%50
+	}
+	// A few symbols far apart with counts whose bytes the fixed model
+	// codes poorly
+	spread := FrequencyTable{0x10: 0xFFFF_FFFF, 0x90: 0xF0F0_F0F0, 0xF0: 0xFEFE_FEFE}
+
+	tests := []struct {
+		name  string
+		freq  FrequencyTable
+		table TableFormat
+	}{
+		{"all 256 symbols", full, TableCoded},
+		{"text", BuildFrequencyTableFromData(blockTestData()), TableCoded},
+		{"spread out", spread, TableFrequencies},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var size int64
+			for _, count := range tt.freq {
+				size += int64(count)
+			}
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, tt.freq, size, 5); err != nil {
+				t.Fatalf("WriteHeader error: %v", err)
+			}
+
+			header, err := ParseHeader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if header.Table != tt.table {
+				t.Errorf("Expected a %v table, got %v", tt.table, header.Table)
+			}
+			if !reflect.DeepEqual(tt.freq, header.Freq) || header.OriginalSize != size || header.PaddingBits != 5 {
+				t.Errorf("Header didn't round-trip: got %v, size %d, padding %d", header.Freq, header.OriginalSize, header.PaddingBits)
+			}
+
+			plain, err := appendHeader(nil, newHeader(tt.freq, nil, size, 5, TableFrequencies))
+			if err != nil {
+				t.Fatalf("appendHeader error: %v", err)
+			}
+			if tt.table == TableCoded && buf.Len() >= len(plain) {
+				t.Errorf("Expected the coded header to be smaller than %d bytes, got %d", len(plain), buf.Len())
+			}
+			if tt.table == TableFrequencies && buf.Len() != len(plain) {
+				t.Errorf("Expected the plain %d-byte header, got %d bytes", len(plain), buf.Len())
+			}
+		})
+	}
+
+	for _, bad := range [][]byte{{0}, {200}, {3, 0xFF}} {
+		if _, err := readCoded(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error reading coded table %x", bad)
+		}
+	}
+}
+
+func TestNibblesTable(t *testing.T) {
+	data := []byte("abcdabcaba")
+	freq := BuildFrequencyTableFromData(data)
+
+	flat := appendFrequencies(nil, freq)
+	nibbles, err := appendNibbles(nil, freq)
+	if err != nil {
+		t.Fatalf("appendNibbles error: %v", err)
+	}
+	if len(nibbles) >= len(flat) {
+		t.Errorf("Expected nibble table to be smaller than the flat list: %d vs %d bytes", len(nibbles), len(flat))
+	}
+
+	// Odd and even symbol counts end on either half of the last byte
+	all := make(FrequencyTable)
+	for i := 0; i < 16; i++ {
+		all[byte(0xF0+i)] = i
+	}
+	for _, table := range []FrequencyTable{freq, {'x': 15}, {'a': 1, 'c': 0, 'p': 7}, all} {
+		packed, err := appendNibbles(nil, table)
+		if err != nil {
+			t.Fatalf("appendNibbles(%v) error: %v", table, err)
+		}
+		decoded, err := readNibbles(bytes.NewReader(packed))
+		if err != nil {
+			t.Fatalf("readNibbles error: %v", err)
+		}
+		if !reflect.DeepEqual(table, decoded) {
+			t.Errorf("Frequency tables don't match.\nExpected: %v\nGot: %v", table, decoded)
+		}
+	}
+
+	for _, table := range []FrequencyTable{{'a': 16}, {'a': 1, 'q': 1}} {
+		if _, err := appendNibbles(nil, table); err == nil {
+			t.Errorf("Expected an error packing %v", table)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "tiny.txt")
+	compressedPath := filepath.Join(tmpDir, "tiny.huf")
+	decompressedPath := filepath.Join(tmpDir, "tiny.dec")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFileWithOptions(inputPath, compressedPath, Options{Table: TableNibbles}); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nExpected: %s\nGot: %s", data, decompressed)
+	}
+
+	// Eight symbols counted a few times each pack into 7 bytes, less than
+	// any other table, so TableAuto picks nibbles
+	eight := []byte("abcdefghabcdeabca")
+	sizes := make(map[TableFormat]int)
+	for _, format := range append([]TableFormat{TableAuto}, tableFormats...) {
+		var compressed bytes.Buffer
+		if err := Compress(bytes.NewReader(eight), &compressed, Options{Table: format}); err != nil {
+			t.Fatalf("Compress with %v table error: %v", format, err)
+		}
+		sizes[format] = compressed.Len()
+		if format != TableAuto {
+			continue
+		}
+		header, err := ParseHeader(bytes.NewReader(compressed.Bytes()))
+		if err != nil {
+			t.Fatalf("ParseHeader error: %v", err)
+		}
+		if header.Table != TableNibbles {
+			t.Errorf("Expected auto to pick the nibbles table, got %v", header.Table)
+		}
+	}
+	for _, format := range tableFormats {
+		if format != TableNibbles && sizes[format] <= sizes[TableNibbles] {
+			t.Errorf("Expected the nibbles table to be smallest, %v takes %d bytes to its %d", format, sizes[format], sizes[TableNibbles])
+		}
+	}
+}
+
+func TestParseHeaderDeclaredSizesTooLarge(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"bad magic", []byte{0x00, 0x81, 0x00}},
+		{"frequency table", []byte{magicByte, 0x81, 0x00, byte(TableFrequencies), 10, 0, 0xFF, 'a', 1, 'b', 1}},
+		{"legacy table", []byte{magicByte, 0x00, 0x00, 0x00, 0x0A, 0x00, 200, 'a', 0x00, 0x01}},
+		{"symbol runs", []byte{magicByte, 0x81, 0x00, byte(TableRanges), 10, 0, 100, 'a', 1}},
+		{"symbol counts", []byte{magicByte, 0x81, 0x00, byte(TableRanges), 10, 0, 0, 0x00, 0xFF, 1}},
+		{"case runs", []byte{magicByte, 0x81, 0x40, byte(TableFrequencies), 10, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 1}},
+		{"block index", []byte{magicByte, 0x81, 0x04, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01, 1, 1}},
+		{"deltas", []byte{magicByte, 0x81, 0x00, byte(TableDelta), 10, 0, byte(EnglishTextModel), 100, 'a', 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseHeader(bytes.NewReader(tt.header)); !errors.Is(err, ErrInvalidFormat) {
+				t.Errorf("Expected ErrInvalidFormat, got %v", err)
+			}
+
+			// The same header in a file is checked against the file size
+			path := filepath.Join(t.TempDir(), "header.huf")
+			if err := os.WriteFile(path, tt.header, 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if _, err := ParseHeader(file); !errors.Is(err, ErrInvalidFormat) {
+				t.Errorf("Expected ErrInvalidFormat from a file, got %v", err)
+			}
+
+			// Without a known length the header still fails, just later
+			if _, err := ParseHeader(plainReader{bytes.NewReader(tt.header)}); err == nil {
+				t.Error("Expected an error from a reader of unknown length")
+			}
+		})
+	}
+}
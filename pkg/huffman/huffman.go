@@ -1,30 +1,145 @@
 package huffman
 
 import (
-	"bufio"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // Node represents a node in the Huffman tree.
-type Node struct {
-	Char  byte
-	Freq  int
-	Seq   int // Sequence number for tiebreaking in tree building
-	Left  *Node
-	Right *Node
-}
+type Node = NodeG[byte]
 
 // FrequencyTable stores character frequencies.
 type FrequencyTable map[byte]int
 
+// UnusedBytes returns the byte values absent from the table or counted zero
+// times, in ascending order, for choosing a sentinel such as an escape byte.
+// The slice is empty when all 256 values are used.
+func (f FrequencyTable) UnusedBytes() []byte {
+	unused := make([]byte, 0, 256-min(len(f), 256))
+	for i := 0; i < 256; i++ {
+		if f[byte(i)] == 0 {
+			unused = append(unused, byte(i))
+		}
+	}
+	return unused
+}
+
 // CodeTable stores Huffman codes for each character.
 type CodeTable map[byte]string
 
+// CodeEntry is a single symbol and its code from a CodeTable.
+type CodeEntry struct {
+	Symbol byte
+	Code   string
+}
+
+// Sorted returns the table's entries in ascending symbol order, for display and
+// serialization that must not depend on map iteration order
+func (c CodeTable) Sorted() []CodeEntry {
+	entries := make([]CodeEntry, 0, len(c))
+	for i := 0; i < 256; i++ {
+		if code, ok := c[byte(i)]; ok {
+			entries = append(entries, CodeEntry{Symbol: byte(i), Code: code})
+		}
+	}
+	return entries
+}
+
+// FromEntries builds a CodeTable from a list of entries. Later entries for the
+// same symbol replace earlier ones.
+func FromEntries(entries []CodeEntry) CodeTable {
+	codes := make(CodeTable, len(entries))
+	for _, entry := range entries {
+		codes[entry.Symbol] = entry.Code
+	}
+	return codes
+}
+
+// KraftSum returns the sum of 2^-len(code) over the table. A complete prefix
+// code, as generated for two or more symbols, sums to exactly 1. The only
+// table below 1 is the single-symbol special case, whose lone code "0" sums to
+// 0.5. A sum above 1 means the codes cannot be prefix-free.
+func (c CodeTable) KraftSum() float64 {
+	sum := 0.0
+	for _, code := range c {
+		sum += math.Ldexp(1, -len(code))
+	}
+	return sum
+}
+
+// IsOptimal reports whether codes is a minimum-redundancy code for freq: one
+// whose weighted path length, the total number of bits it spends on the
+// counted symbols, equals that of an optimal Huffman code. The optimum is
+// recomputed with the two-queue method, independently of BuildHuffmanTree.
+// Every symbol in freq must have a code, and no symbol's code may be a prefix
+// of another's. A single symbol needs a one-bit code, as GenerateCodeTable
+// gives it.
+func IsOptimal(freq FrequencyTable, codes CodeTable) bool {
+	weights := make([]int, 0, len(freq))
+	used := make([]string, 0, len(freq))
+	actual := 0
+	for char, count := range freq {
+		code, ok := codes[char]
+		if !ok || code == "" {
+			return false
+		}
+		weights = append(weights, count)
+		used = append(used, code)
+		actual += count * len(code)
+	}
+	if len(weights) == 0 {
+		return true
+	}
+	if !prefixFree(used) {
+		return false
+	}
+	if len(weights) == 1 {
+		return actual == weights[0]
+	}
+
+	// Merging the two lightest weights costs their sum; merged weights come
+	// out in ascending order, so two sorted queues replace a heap
+	sort.Ints(weights)
+	var merged []int
+	optimal := 0
+	pop := func() int {
+		if len(merged) == 0 || (len(weights) > 0 && weights[0] <= merged[0]) {
+			w := weights[0]
+			weights = weights[1:]
+			return w
+		}
+		w := merged[0]
+		merged = merged[1:]
+		return w
+	}
+	for len(weights)+len(merged) > 1 {
+		sum := pop() + pop()
+		optimal += sum
+		merged = append(merged, sum)
+	}
+
+	return actual == optimal
+}
+
+// prefixFree reports whether no code in codes is a prefix of another, or
+// equal to it. It sorts codes.
+func prefixFree(codes []string) bool {
+	// A code that prefixes any later code in sorted order prefixes the next
+	sort.Strings(codes)
+	for i := 1; i < len(codes); i++ {
+		if strings.HasPrefix(codes[i], codes[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
 // BuildFrequencyTable reads a file and counts character occurrences
 func BuildFrequencyTable(filename string) (FrequencyTable, error) {
 	file, err := os.Open(filename)
@@ -38,20 +153,23 @@ func BuildFrequencyTable(filename string) (FrequencyTable, error) {
 		}
 	}(file)
 
-	freq := make(FrequencyTable)
-	reader := bufio.NewReader(file)
+	// Read straight from the file in large chunks; a bufio.Reader in between
+	// would only add a copy
+	var counts byteCounts
+	buf := make([]byte, 64*1024)
 
 	for {
-		b, err := reader.ReadByte()
+		n, err := file.Read(buf)
+		counts.add(buf[:n])
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
-		freq[b]++
 	}
 
+	freq := counts.table()
 	if len(freq) == 0 {
 		return nil, fmt.Errorf("empty file")
 	}
@@ -59,156 +177,253 @@ func BuildFrequencyTable(filename string) (FrequencyTable, error) {
 	return freq, nil
 }
 
-// BuildFrequencyTableFromData BuildFrequencyTableFrom builds a frequency table from a byte slice
-func BuildFrequencyTableFromData(data []byte) FrequencyTable {
-	freq := make(FrequencyTable)
-	for _, b := range data {
-		freq[b]++
+// sampleBlockSize is the size of the blocks read by BuildFrequencyTableSampled
+const sampleBlockSize = 4096
+
+// BuildFrequencyTableSampled approximates a file's frequency table by counting
+// only every sampleEveryN-th block of the file. The skipped blocks are never
+// read, which makes it much cheaper than BuildFrequencyTable on large files at
+// the cost of a slightly less optimal tree. Symbols that only occur in skipped
+// blocks are missing from the result, so the table must be completed before it
+// is used to encode the whole file.
+func BuildFrequencyTableSampled(path string, sampleEveryN int) (FrequencyTable, error) {
+	if sampleEveryN < 1 {
+		return nil, fmt.Errorf("invalid sample interval %d", sampleEveryN)
 	}
-	return freq
-}
 
-// BuildHuffmanTree constructs the Huffman tree from a frequency table
-func BuildHuffmanTree(freq FrequencyTable) *Node {
-	if len(freq) == 0 {
-		return nil
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close file: %v", err)
+		}
+	}(file)
 
-	// Special case: single character
-	if len(freq) == 1 {
-		for char, count := range freq {
-			return &Node{
-				Char:  char,
-				Freq:  count,
-				Seq:   0,
-				Left:  nil,
-				Right: nil,
-			}
+	var counts byteCounts
+	buf := make([]byte, sampleBlockSize)
+	stride := int64(sampleEveryN) * sampleBlockSize
+
+	for offset := int64(0); ; offset += stride {
+		n, err := file.ReadAt(buf, offset)
+		counts.add(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
 	}
 
-	// Create initial nodes sorted by character for deterministic ordering
-	// This ensures that regardless of map iteration order, we always get the same tree
-	nodes := make([]*Node, 0, len(freq))
-	chars := make([]byte, 0, len(freq))
-	for char := range freq {
-		chars = append(chars, char)
+	freq := counts.table()
+	if len(freq) == 0 {
+		return nil, fmt.Errorf("empty file")
 	}
-	// Simple bubble sort for small character sets (0-255)
-	for i := 0; i < len(chars); i++ {
-		for j := i + 1; j < len(chars); j++ {
-			if chars[j] < chars[i] {
-				chars[i], chars[j] = chars[j], chars[i]
-			}
-		}
+
+	return freq, nil
+}
+
+// sampleFrequencies counts the same blocks of data that
+// BuildFrequencyTableSampled reads from a file holding data
+func sampleFrequencies(data []byte, sampleEveryN int) FrequencyTable {
+	var counts byteCounts
+	stride := sampleEveryN * sampleBlockSize
+	for offset := 0; offset < len(data); offset += stride {
+		counts.add(data[offset:min(offset+sampleBlockSize, len(data))])
 	}
+	return counts.table()
+}
 
-	seq := 0
-	for _, char := range chars {
-		nodes = append(nodes, &Node{
-			Char: char,
-			Freq: freq[char],
-			Seq:  seq,
-		})
-		seq++
+// addMissingSymbols gives every byte of data that has no count in freq a
+// count of one, so an approximate table can still encode all of data
+func addMissingSymbols(freq FrequencyTable, data []byte) {
+	var seen [256]bool
+	for _, b := range data {
+		seen[b] = true
+	}
+	for i, ok := range seen {
+		if _, counted := freq[byte(i)]; ok && !counted {
+			freq[byte(i)] = 1
+		}
 	}
+}
 
-	// Build tree by repeatedly combining two lowest frequency nodes
-	for len(nodes) > 1 {
-		// Find two nodes with a minimum frequency
-		min1Idx, min2Idx := findTwoMinimum(nodes)
+// BuildFrequencyTableFromData BuildFrequencyTableFrom builds a frequency table from a byte slice
+func BuildFrequencyTableFromData(data []byte) FrequencyTable {
+	var counts byteCounts
+	counts.add(data)
+	return counts.table()
+}
 
-		// Create parent node
-		parent := &Node{
-			Freq:  nodes[min1Idx].Freq + nodes[min2Idx].Freq,
-			Seq:   seq,
-			Left:  nodes[min1Idx],
-			Right: nodes[min2Idx],
-		}
-		seq++
+// byteCounts counts byte values. Indexing an array is much faster than
+// updating a map, so the counting loops use it and convert to a
+// FrequencyTable once at the end.
+type byteCounts [256]int
 
-		// Remove the two minimum nodes and add a parent
-		nodes = removeNodes(nodes, min1Idx, min2Idx)
-		nodes = append(nodes, parent)
+// add counts the bytes of data
+func (c *byteCounts) add(data []byte) {
+	for _, b := range data {
+		c[b]++
 	}
-
-	return nodes[0]
 }
 
-func findTwoMinimum(nodes []*Node) (int, int) {
-	min1, min2 := 0, 1
-	if nodes[min1].Freq > nodes[min2].Freq ||
-		(nodes[min1].Freq == nodes[min2].Freq && nodes[min1].Seq > nodes[min2].Seq) {
-		min1, min2 = min2, min1
-	}
-
-	for i := 2; i < len(nodes); i++ {
-		if nodes[i].Freq < nodes[min1].Freq ||
-			(nodes[i].Freq == nodes[min1].Freq && nodes[i].Seq < nodes[min1].Seq) {
-			min2 = min1
-			min1 = i
-		} else if nodes[i].Freq < nodes[min2].Freq ||
-			(nodes[i].Freq == nodes[min2].Freq && nodes[i].Seq < nodes[min2].Seq) {
-			min2 = i
+// table returns the counts as a FrequencyTable without the absent symbols
+func (c *byteCounts) table() FrequencyTable {
+	n := 0
+	for _, count := range c {
+		if count > 0 {
+			n++
 		}
 	}
 
-	return min1, min2
+	// Sizing the map up front saves the allocations of growing it
+	freq := make(FrequencyTable, n)
+	for i, count := range c {
+		if count > 0 {
+			freq[byte(i)] = count
+		}
+	}
+	return freq
 }
 
-func removeNodes(nodes []*Node, idx1, idx2 int) []*Node {
-	if idx1 > idx2 {
-		idx1, idx2 = idx2, idx1
+// maxQuantizedCount is the largest count QuantizeFrequencies produces
+const maxQuantizedCount = 255
+
+// QuantizeFrequencies scales the counts of freq so the largest is 255, for a
+// compact header. Each count is rounded to the nearest step and kept at 1 or
+// more, so the relative order of the counts is preserved and the tree is
+// usually the same as for the raw counts. Where rounding does change the tree,
+// data encoded with it is still decoded exactly; only the ratio suffers. A
+// table whose counts already fit is returned as a copy.
+func QuantizeFrequencies(freq FrequencyTable) FrequencyTable {
+	largest := 0
+	for _, count := range freq {
+		largest = max(largest, count)
 	}
-	result := make([]*Node, 0, len(nodes)-2)
-	for i, node := range nodes {
-		if i != idx1 && i != idx2 {
-			result = append(result, node)
+
+	quantized := make(FrequencyTable, len(freq))
+	for char, count := range freq {
+		if largest <= maxQuantizedCount {
+			quantized[char] = count
+			continue
 		}
+		scaled := int(math.Round(float64(count) * maxQuantizedCount / float64(largest)))
+		quantized[char] = max(scaled, 1)
 	}
-	return result
+	return quantized
 }
 
-// GenerateCodeTable creates prefix codes from a Huffman tree
-func GenerateCodeTable(root *Node) CodeTable {
-	codes := make(CodeTable)
-	if root == nil {
-		return codes
+// BuildHuffmanTree constructs the Huffman tree from a frequency table
+func BuildHuffmanTree(freq FrequencyTable) *Node {
+	return BuildHuffmanTreeG[byte](freq)
+}
+
+// BuildHuffmanTreeWith constructs the Huffman tree from a frequency table
+// like BuildHuffmanTree, with less deciding which of two nodes of equal
+// frequency is merged first and becomes the left child, for matching the
+// tie-breaking of another encoder. Leaves are numbered by symbol and merged
+// nodes in order of creation in Seq, and nodes less leaves unordered fall
+// back to the default rule, the lower Seq first. A nil less is the default
+// rule.
+//
+// The comparator changes the codes, and so the compressed bytes, though not
+// the compressed size. Decoders rebuild the tree from the frequencies with
+// the default rule, so a stream coded with any other tree must store it in
+// TableTree format.
+func BuildHuffmanTreeWith(freq FrequencyTable, less func(a, b *Node) bool) *Node {
+	return buildHuffmanTree(freq, less)
+}
+
+// encodeTwoSymbols packs data coded with a two-symbol table, whose codes are
+// "0" and "1", a bit per input byte without looking up each byte's code. It
+// reports false if codes is any other table or data holds a byte outside it.
+func encodeTwoSymbols(data []byte, codes CodeTable) ([]byte, bool) {
+	if len(codes) != 2 {
+		return nil, false
+	}
+	var one byte
+	var known [256]bool
+	for char, code := range codes {
+		switch code {
+		case "1":
+			one = char
+		case "0":
+		default:
+			return nil, false
+		}
+		known[char] = true
 	}
 
-	// Special case: single character
-	if root.Left == nil && root.Right == nil {
-		codes[root.Char] = "0"
-		return codes
+	result := make([]byte, (len(data)+7)/8)
+	for i, b := range data {
+		if !known[b] {
+			return nil, false
+		}
+		if b == one {
+			result[i/8] |= 0x80 >> (i % 8)
+		}
 	}
+	return result, true
+}
 
-	generateCodes(root, "", codes)
-	return codes
+// BranchConvention selects which child of a tree node gets the 0 bit when
+// codes are assigned. BuildHuffmanTree makes the child with the smaller count
+// (or, on a tie, the earlier one) the left child.
+type BranchConvention uint8
+
+const (
+	// SmallerIsZero codes the left, smaller child with 0. It is the
+	// convention of GenerateCodeTable and the one the decoder expects.
+	SmallerIsZero BranchConvention = iota
+	// SmallerIsOne codes the left, smaller child with 1, as in textbooks
+	// that send the least frequent symbol right. The code lengths, and so
+	// the compressed size, are the same under either convention.
+	SmallerIsOne
+)
+
+// GenerateCodeTable creates prefix codes from a Huffman tree
+func GenerateCodeTable(root *Node) CodeTable {
+	return GenerateCodeTableWith(root, SmallerIsZero)
 }
 
-func generateCodes(node *Node, code string, codes CodeTable) {
-	if node == nil {
-		return
-	}
+// GenerateCodeTableWith creates prefix codes from a Huffman tree using the
+// given branch convention. Only SmallerIsZero codes can be decoded with the
+// same tree, so the other conventions are for display and comparison.
+func GenerateCodeTableWith(root *Node, convention BranchConvention) CodeTable {
+	return GenerateCodeTableWithG(root, convention)
+}
 
-	// Leaf node
-	if node.Left == nil && node.Right == nil {
-		codes[node.Char] = code
-		return
-	}
+// BuildCodes builds the Huffman tree for freq and its code table in one call,
+// returning the codes for encoding and the tree for decoding
+func BuildCodes(freq FrequencyTable) (CodeTable, *Node) {
+	tree := BuildHuffmanTree(freq)
+	return GenerateCodeTable(tree), tree
+}
+
+// maxPooledBitBuffer is the largest bit string buffer kept for reuse, so one
+// huge input doesn't pin its buffer for the life of the process
+const maxPooledBitBuffer = 64 << 20
 
-	generateCodes(node.Left, code+"0", codes)
-	generateCodes(node.Right, code+"1", codes)
+// bitBufferPool holds the bit string buffers of EncodeData between calls
+var bitBufferPool = sync.Pool{
+	New: func() any { return new([]byte) },
 }
 
 // EncodeData encodes data using the code table
 func EncodeData(data []byte, codes CodeTable) []byte {
-	// Use strings.Builder for efficient string concatenation
-	var buf strings.Builder
+	if encoded, ok := encodeTwoSymbols(data, codes); ok {
+		return encoded
+	}
+
+	// Spell out the bits in a pooled buffer, reused rather than reallocated
+	// when its capacity suffices
+	pooled := bitBufferPool.Get().(*[]byte)
+	bitString := (*pooled)[:0]
 	for _, b := range data {
-		buf.WriteString(codes[b])
+		bitString = append(bitString, codes[b]...)
 	}
-	bitString := buf.String()
 
 	// Pack bits into bytes
 	byteCount := (len(bitString) + 7) / 8
@@ -222,137 +437,167 @@ func EncodeData(data []byte, codes CodeTable) []byte {
 		}
 	}
 
+	if cap(bitString) <= maxPooledBitBuffer {
+		*pooled = bitString
+		bitBufferPool.Put(pooled)
+	}
+
 	return result
 }
 
-// WriteHeader writes a compression header to an output file
-func WriteHeader(writer io.Writer, freq FrequencyTable, originalSize int64, paddingBits int) error {
-	// Write a magic byte
-	if err := binary.Write(writer, binary.BigEndian, uint8(0x48)); err != nil { // 'H'
-		return err
+// DecodeData decodes compressed data using Huffman tree. A negative
+// originalSize decodes until the payload runs out, which fails for a tree with
+// a single symbol since its codes take no bits.
+func DecodeData(data []byte, root *Node, originalSize int64, paddingBits int) ([]byte, error) {
+	if root == nil {
+		return nil, fmt.Errorf("invalid Huffman tree")
 	}
 
-	// Write the original file size as uint32
-	if err := binary.Write(writer, binary.BigEndian, uint32(originalSize)); err != nil {
-		return err
-	}
+	return newDecoder(data, root, originalSize, paddingBits).readAll()
+}
 
-	// Write padding bits as a separate byte
-	if err := binary.Write(writer, binary.BigEndian, uint8(paddingBits)); err != nil {
-		return err
-	}
+// decoder walks the Huffman tree over a payload, keeping its position so the
+// output can be produced in chunks
+type decoder struct {
+	root      *Node
+	current   *Node
+	data      []byte
+	bit       int // index of the next bit to read
+	totalBits int
+	remaining int64 // bytes still to be produced
+	derived   bool  // the size is unknown, so stop when the bits run out
+	escaped   bool  // the escape symbol's code is followed by a literal byte
+	escape    byte
+	caseMap   *caseMap     // restores the case of a case-folded payload
+	remap     *[256]byte   // maps the bytes of a remapped payload back
+	lookup    *lookupTable // decodes with a table instead of the tree when set
+}
 
-	// Write table size as a full byte (supports 0-255 unique characters)
-	tableSize := uint8(len(freq))
-	if err := binary.Write(writer, binary.BigEndian, tableSize); err != nil {
-		return err
+func newDecoder(data []byte, root *Node, originalSize int64, paddingBits int) *decoder {
+	d := &decoder{
+		root:      root,
+		current:   root,
+		data:      data,
+		totalBits: len(data)*8 - paddingBits,
+		remaining: originalSize,
 	}
-
-	// Write character and frequency for each entry
-	for char, count := range freq {
-		if err := binary.Write(writer, binary.BigEndian, char); err != nil {
-			return err
-		}
-		// Use uint16 for frequency to support counts up to 65,535
-		if err := binary.Write(writer, binary.BigEndian, uint16(count)); err != nil {
-			return err
-		}
+	if originalSize < 0 {
+		d.remaining = math.MaxInt64
+		d.derived = true
 	}
-
-	return nil
+	return d
 }
 
-// ReadHeader reads compression header from an input file
-func ReadHeader(reader io.Reader) (FrequencyTable, int64, int, error) {
-	// Read and verify the magic byte
-	var magic uint8
-	if err := binary.Read(reader, binary.BigEndian, &magic); err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to read magic byte: %w", err)
-	}
-	if magic != 0x48 { // 'H'
-		return nil, 0, 0, fmt.Errorf("invalid file format")
+// read decodes into p and returns the number of bytes written. It returns 0
+// once originalSize bytes have been produced or the payload is exhausted.
+func (d *decoder) read(p []byte) (int, error) {
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
 	}
 
-	// Read the original file size as uint32
-	var originalSize uint32
-	if err := binary.Read(reader, binary.BigEndian, &originalSize); err != nil {
-		return nil, 0, 0, err
+	if d.lookup != nil {
+		return d.readLookup(p)
 	}
 
-	// Read padding bits as a separate byte
-	var paddingBits uint8
-	if err := binary.Read(reader, binary.BigEndian, &paddingBits); err != nil {
-		return nil, 0, 0, err
+	// Special case: single character
+	if d.root.Left == nil && d.root.Right == nil {
+		if d.derived {
+			return 0, fmt.Errorf("cannot derive the size of a single-symbol stream")
+		}
+		for i := range p {
+			p[i] = d.root.Char
+			if d.remap != nil {
+				p[i] = d.remap[p[i]]
+			}
+			if d.caseMap != nil {
+				var ok bool
+				if p[i], ok = d.caseMap.apply(p[i]); !ok {
+					return i, fmt.Errorf("case map ends before the payload")
+				}
+			}
+		}
+		// Each symbol is coded as one bit, consumed without being read
+		d.bit += len(p)
+		d.remaining -= int64(len(p))
+		return len(p), nil
 	}
 
-	// Read table size as a full byte (supports 0-255 unique characters)
-	var tableSize uint8
-	if err := binary.Read(reader, binary.BigEndian, &tableSize); err != nil {
-		return nil, 0, 0, err
-	}
+	n := 0
+	for n < len(p) && d.bit < d.totalBits {
+		byteIdx := d.bit / 8
+		bitIdx := 7 - (d.bit % 8)
+		bit := (d.data[byteIdx] >> bitIdx) & 1
 
-	// Read the frequency table
-	freq := make(FrequencyTable)
-	for i := uint8(0); i < tableSize; i++ {
-		var char byte
-		if err := binary.Read(reader, binary.BigEndian, &char); err != nil {
-			return nil, 0, 0, err
+		if bit == 0 {
+			if d.current.Left == nil {
+				return n, fmt.Errorf("invalid bit sequence: no left child at bit %d", d.bit)
+			}
+			d.current = d.current.Left
+		} else {
+			if d.current.Right == nil {
+				return n, fmt.Errorf("invalid bit sequence: no right child at bit %d", d.bit)
+			}
+			d.current = d.current.Right
 		}
+		d.bit++
 
-		// Read frequency as uint16 (supports counts up to 65,535)
-		var count uint16
-		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
-			return nil, 0, 0, err
+		// Reached leaf node
+		if d.current.Left == nil && d.current.Right == nil {
+			char := d.current.Char
+			if d.escaped && char == d.escape {
+				if d.bit+8 > d.totalBits {
+					return n, fmt.Errorf("invalid bit sequence: payload ends inside an escaped literal")
+				}
+				char = 0
+				for i := 0; i < 8; i++ {
+					char = char<<1 | (d.data[d.bit/8]>>(7-d.bit%8))&1
+					d.bit++
+				}
+			}
+			if d.remap != nil {
+				char = d.remap[char]
+			}
+			if d.caseMap != nil {
+				var ok bool
+				if char, ok = d.caseMap.apply(char); !ok {
+					return n, fmt.Errorf("case map ends before the payload")
+				}
+			}
+			p[n] = char
+			n++
+			d.current = d.root
 		}
-
-		freq[char] = int(count)
 	}
 
-	return freq, int64(originalSize), int(paddingBits), nil
-}
-
-// DecodeData decodes compressed data using Huffman tree
-func DecodeData(data []byte, root *Node, originalSize int64, paddingBits int) ([]byte, error) {
-	if root == nil {
-		return nil, fmt.Errorf("invalid Huffman tree")
+	if d.derived && d.bit >= d.totalBits && d.current != d.root {
+		return n, fmt.Errorf("invalid bit sequence: payload ends inside a code")
 	}
 
-	result := make([]byte, 0, originalSize)
-	current := root
+	d.remaining -= int64(n)
+	return n, nil
+}
 
-	// Special case: single character
-	if root.Left == nil && root.Right == nil {
-		for i := int64(0); i < originalSize; i++ {
-			result = append(result, root.Char)
+// readAll decodes the whole payload
+func (d *decoder) readAll() ([]byte, error) {
+	if !d.derived {
+		result := make([]byte, d.remaining)
+		n, err := d.read(result)
+		if err != nil {
+			return nil, err
 		}
-		return result, nil
+		return result[:n], nil
 	}
 
-	totalBits := len(data)*8 - paddingBits
-
-	for i := 0; i < totalBits && int64(len(result)) < originalSize; i++ {
-		byteIdx := i / 8
-		bitIdx := 7 - (i % 8)
-		bit := (data[byteIdx] >> bitIdx) & 1
-
-		if bit == 0 {
-			if current.Left == nil {
-				return nil, fmt.Errorf("invalid bit sequence: no left child at bit %d", i)
-			}
-			current = current.Left
-		} else {
-			if current.Right == nil {
-				return nil, fmt.Errorf("invalid bit sequence: no right child at bit %d", i)
-			}
-			current = current.Right
+	var result []byte
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := d.read(chunk)
+		result = append(result, chunk[:n]...)
+		if err != nil {
+			return nil, err
 		}
-
-		// Reached leaf node
-		if current.Left == nil && current.Right == nil {
-			result = append(result, current.Char)
-			current = root
+		if n == 0 {
+			return result, nil
 		}
 	}
-
-	return result, nil
 }
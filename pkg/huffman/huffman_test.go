@@ -1,10 +1,21 @@
 package huffman
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/letsmakecakes/huffman/internal/bytediff"
 )
 
 func TestBuildFrequencyTable(t *testing.T) {
@@ -88,7 +99,85 @@ func TestBuildHuffmanTreeSingleChar(t *testing.T) {
 	}
 
 	if tree.Char != 'a' || tree.Freq != 5 {
-		t.Errorf("Expected char 'a with freq 5, got char '%c' with freq %d", tree.Char, tree.Freq)
+		t.Errorf("Expected char 'a' with freq 5, got char '%s' with freq %d", formatByte(tree.Char), tree.Freq)
+	}
+}
+
+func TestBuildHuffmanTreeLargeCounts(t *testing.T) {
+	freq := make(FrequencyTable)
+	for i := 0; i < 256; i++ {
+		freq[byte(i)] = math.MaxInt32 - i
+	}
+	var want int64
+	for _, count := range freq {
+		want += int64(count)
+	}
+
+	tree := BuildHuffmanTree(freq)
+	if tree.Freq != want {
+		t.Errorf("Expected root frequency %d, got %d", want, tree.Freq)
+	}
+	if codes := GenerateCodeTable(tree); len(codes) != 256 {
+		t.Errorf("Expected 256 codes, got %d", len(codes))
+	}
+
+	// Sums past math.MaxInt64 saturate instead of wrapping negative
+	if math.MaxInt < math.MaxInt64 {
+		t.Skip("int is too small to hold counts near math.MaxInt64")
+	}
+	huge := FrequencyTable{'a': math.MaxInt, 'b': math.MaxInt, 'c': 1}
+	tree = BuildHuffmanTree(huge)
+	if tree.Freq != math.MaxInt64 {
+		t.Errorf("Expected a saturated root frequency, got %d", tree.Freq)
+	}
+	if codes := GenerateCodeTable(tree); len(codes) != 3 {
+		t.Errorf("Expected 3 codes, got %d", len(codes))
+	}
+}
+
+func TestBuildHuffmanTreeWith(t *testing.T) {
+	data := []byte("abcdeeffffgggggggg")
+	freq := BuildFrequencyTableFromData(data)
+
+	if !reflect.DeepEqual(BuildHuffmanTreeWith(freq, nil), BuildHuffmanTree(freq)) {
+		t.Error("Expected a nil comparator to build the default tree")
+	}
+
+	comparators := map[string]func(a, b *Node) bool{
+		"latest first":       func(a, b *Node) bool { return a.Seq > b.Seq },
+		"merged nodes first": func(a, b *Node) bool { return a.Left != nil && b.Left == nil },
+	}
+	defaultCodes := GenerateCodeTable(BuildHuffmanTree(freq))
+	for name, less := range comparators {
+		t.Run(name, func(t *testing.T) {
+			tree := BuildHuffmanTreeWith(freq, less)
+			codes := GenerateCodeTable(tree)
+			if reflect.DeepEqual(codes, defaultCodes) {
+				t.Errorf("Expected different codes from the default, got %v", codes)
+			}
+			if !IsOptimal(freq, codes) {
+				t.Errorf("Expected optimal codes, got %v", codes)
+			}
+
+			// The tree must travel with the stream for it to decode
+			var bits int
+			for _, b := range data {
+				bits += len(codes[b])
+			}
+			padding := (8 - bits%8) % 8
+			header, err := appendHeader(nil, newHeader(freq, tree, int64(len(data)), padding, TableTree))
+			if err != nil {
+				t.Fatalf("Failed to write header: %v", err)
+			}
+			stream := append(header, EncodeData(data, codes)...)
+			_, decoded, err := readCompressed(bytes.NewReader(stream))
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !bytes.Equal(data, decoded) {
+				t.Errorf("Decoded data doesn't match original: %s", describeDiff(data, decoded))
+			}
+		})
 	}
 }
 
@@ -133,34 +222,179 @@ func TestGenerateCodeTable(t *testing.T) {
 			}
 
 			// Verify prefix-free property
-			if !isPrefixFree(codes) {
+			if !prefixFree(slices.Collect(maps.Values(codes))) {
 				t.Error("Codes are not prefix-free")
 			}
 		})
 	}
 }
 
-func isPrefixFree(codes CodeTable) bool {
-	codeList := make([]string, 0, len(codes))
-	for _, code := range codes {
-		codeList = append(codeList, code)
+func TestBuildCodes(t *testing.T) {
+	freq := BuildFrequencyTableFromData([]byte("build the codes and the tree in one call"))
+	codes, tree := BuildCodes(freq)
+	if len(codes) != len(freq) {
+		t.Fatalf("Expected %d codes, got %d", len(freq), len(codes))
 	}
 
-	for i := 0; i < len(codeList); i++ {
-		for j := i + 1; j < len(codeList); j++ {
-			if isPrefix(codeList[i], codeList[j]) || isPrefix(codeList[j], codeList[i]) {
-				return false
+	for char, code := range codes {
+		for other, otherCode := range codes {
+			if char != other && strings.HasPrefix(otherCode, code) {
+				t.Errorf("Code %q for %q is a prefix of %q for %q", code, char, otherCode, other)
+			}
+		}
+
+		node := tree
+		for _, bit := range code {
+			if bit == '0' {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+			if node == nil {
+				t.Fatalf("Code %q for %q leaves the tree", code, char)
 			}
 		}
+		if node.Left != nil || node.Right != nil || node.Char != char {
+			t.Errorf("Code %q decodes to a different node than %q", code, char)
+		}
 	}
-	return true
 }
 
-func isPrefix(s1, s2 string) bool {
-	if len(s1) > len(s2) {
-		return false
+func TestGenerateCodeTableWith(t *testing.T) {
+	// The textbook example with counts 5, 9, 12, 13, 16 and 45
+	freq := FrequencyTable{'a': 5, 'b': 9, 'c': 12, 'd': 13, 'e': 16, 'f': 45}
+	tree := BuildHuffmanTree(freq)
+
+	tests := []struct {
+		convention BranchConvention
+		want       CodeTable
+	}{
+		{SmallerIsZero, CodeTable{'a': "1100", 'b': "1101", 'c': "100", 'd': "101", 'e': "111", 'f': "0"}},
+		{SmallerIsOne, CodeTable{'a': "0011", 'b': "0010", 'c': "011", 'd': "010", 'e': "000", 'f': "1"}},
+	}
+
+	for _, tt := range tests {
+		if got := GenerateCodeTableWith(tree, tt.convention); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Convention %d: expected codes %v, got %v", tt.convention, tt.want, got)
+		}
+	}
+
+	if got := GenerateCodeTable(tree); !reflect.DeepEqual(got, tests[0].want) {
+		t.Errorf("GenerateCodeTable doesn't use SmallerIsZero: got %v", got)
+	}
+}
+
+func TestCodeTableSorted(t *testing.T) {
+	freq := BuildFrequencyTableFromData([]byte("the quick brown fox jumps over the lazy dog"))
+	codes := GenerateCodeTable(BuildHuffmanTree(freq))
+
+	entries := codes.Sorted()
+	if len(entries) != len(codes) {
+		t.Fatalf("Expected %d entries, got %d", len(codes), len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].Symbol >= entries[i].Symbol {
+			t.Errorf("Entries not ascending at %d: %s then %s", i, formatByte(entries[i-1].Symbol), formatByte(entries[i].Symbol))
+		}
+	}
+	for _, entry := range entries {
+		if codes[entry.Symbol] != entry.Code {
+			t.Errorf("Entry for %s has code %s, table has %s", formatByte(entry.Symbol), entry.Code, codes[entry.Symbol])
+		}
+	}
+
+	if roundTrip := FromEntries(entries); !reflect.DeepEqual(codes, roundTrip) {
+		t.Errorf("FromEntries doesn't round-trip.\nExpected: %v\nGot: %v", codes, roundTrip)
+	}
+}
+
+func TestCodeTableKraftSum(t *testing.T) {
+	tests := []struct {
+		name     string
+		freq     FrequencyTable
+		expected float64
+	}{
+		{"two characters", FrequencyTable{'a': 1, 'b': 1}, 1},
+		{"three characters", FrequencyTable{'a': 3, 'b': 2, 'c': 1}, 1},
+		{"skewed", FrequencyTable{'a': 1000, 'b': 1, 'c': 1, 'd': 2, 'e': 4, 'f': 8}, 1},
+		{"classic", FrequencyTable{'a': 5, 'b': 9, 'c': 12, 'd': 13, 'e': 16, 'f': 45}, 1},
+		{"english text", BuildFrequencyTableFromData([]byte("the quick brown fox jumps over the lazy dog")), 1},
+		// The single-symbol code "0" leaves half the code space unused
+		{"single character", FrequencyTable{'a': 5}, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := GenerateCodeTable(BuildHuffmanTree(tt.freq))
+			if sum := codes.KraftSum(); math.Abs(sum-tt.expected) > 1e-9 {
+				t.Errorf("Expected Kraft sum %f, got %f", tt.expected, sum)
+			}
+		})
+	}
+}
+
+func TestGenerateCodeTableIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	random := make(FrequencyTable)
+	for i := 0; i < 200; i++ {
+		random[byte(i)] = 1 + rng.Intn(1000)
+	}
+	fibonacci := make(FrequencyTable)
+	a, b := 1, 1
+	for i := 0; i < 20; i++ {
+		fibonacci[byte('a'+i)] = a
+		a, b = b, a+b
+	}
+
+	tests := []struct {
+		name string
+		freq FrequencyTable
+	}{
+		{"single character", FrequencyTable{'a': 5}},
+		{"two characters", FrequencyTable{'a': 1, 'b': 1}},
+		{"classic", FrequencyTable{'a': 5, 'b': 9, 'c': 12, 'd': 13, 'e': 16, 'f': 45}},
+		{"all ties", FrequencyTable{'a': 7, 'b': 7, 'c': 7, 'd': 7, 'e': 7}},
+		{"ties between leaves and merged nodes", FrequencyTable{'a': 1, 'b': 1, 'c': 2, 'd': 2, 'e': 4, 'f': 4}},
+		{"fibonacci", fibonacci},
+		{"random", random},
+		{"english text", BuildFrequencyTableFromData([]byte("the quick brown fox jumps over the lazy dog"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := GenerateCodeTable(BuildHuffmanTree(tt.freq))
+			if !IsOptimal(tt.freq, codes) {
+				t.Errorf("GenerateCodeTable gave a suboptimal table: %v", codes)
+			}
+		})
+	}
+}
+
+func TestIsOptimalRejectsSuboptimal(t *testing.T) {
+	freq := FrequencyTable{'a': 10, 'b': 1, 'c': 1}
+	// A prefix-free code that gives the most frequent symbol a long code
+	codes := CodeTable{'a': "10", 'b': "0", 'c': "11"}
+	if IsOptimal(freq, codes) {
+		t.Error("Expected a suboptimal table to be reported")
+	}
+
+	// The right lengths, but 'b' and 'c' share a code
+	codes = CodeTable{'a': "0", 'b': "10", 'c': "10"}
+	if IsOptimal(freq, codes) {
+		t.Error("Expected a table with a repeated code to be reported")
+	}
+
+	// Lengths that add up to the optimum, but 'a' prefixes both other codes
+	freq = FrequencyTable{'a': 3, 'b': 1, 'c': 1, 'd': 1}
+	codes = CodeTable{'a': "1", 'b': "10", 'c': "110", 'd': "111"}
+	if IsOptimal(freq, codes) {
+		t.Error("Expected a table that isn't prefix-free to be reported")
+	}
+
+	delete(codes, 'c')
+	if IsOptimal(freq, codes) {
+		t.Error("Expected a table missing a symbol to be reported")
 	}
-	return s2[:len(s1)] == s1
 }
 
 func TestEncodeDecodeData(t *testing.T) {
@@ -199,7 +433,7 @@ func TestEncodeDecodeData(t *testing.T) {
 			}
 
 			if !bytes.Equal(data, decoded) {
-				t.Errorf("Decoded data doesn't match original.\nOriginal: %s\nDecoded: %s", data, decoded)
+				t.Errorf("Decoded data doesn't match original: %s", describeDiff(data, decoded))
 			}
 		})
 	}
@@ -311,7 +545,80 @@ func TestCompressDecompressRoundTrip(t *testing.T) {
 	}
 
 	if !bytes.Equal(testData, decompressed) {
-		t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(testData), len(decompressed))
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(testData, decompressed))
+	}
+}
+
+func TestBuildFrequencyTableSampled(t *testing.T) {
+	// Skewed distribution over 64 symbols, plus one symbol that only occurs
+	// near the end so the sample is likely to miss it
+	rng := rand.New(rand.NewSource(7))
+	testData := make([]byte, 2<<20)
+	for i := range testData {
+		testData[i] = byte('0' + int(rng.ExpFloat64()*8)%64)
+	}
+	testData[len(testData)-10] = 0xFF
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.bin")
+	if err := os.WriteFile(inputPath, testData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BuildFrequencyTableSampled(inputPath, 0); err == nil {
+		t.Error("Expected error for zero sample interval")
+	}
+
+	sizes := make(map[int]int64)
+	for _, every := range []int{1, 16} {
+		compressedPath := filepath.Join(tmpDir, "compressed.huf")
+		decompressedPath := filepath.Join(tmpDir, "decompressed.bin")
+
+		if err := CompressFileWithOptions(inputPath, compressedPath, Options{SampleEvery: every}); err != nil {
+			t.Fatalf("Compression with SampleEvery=%d failed: %v", every, err)
+		}
+		info, err := os.Stat(compressedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[every] = info.Size()
+
+		if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+			t.Fatalf("Decompression with SampleEvery=%d failed: %v", every, err)
+		}
+		decompressed, err := os.ReadFile(decompressedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(testData, decompressed) {
+			t.Errorf("Decompressed data doesn't match original with SampleEvery=%d: %s", every, describeDiff(testData, decompressed))
+		}
+	}
+
+	t.Logf("Full table: %d bytes, sampled table: %d bytes", sizes[1], sizes[16])
+	if float64(sizes[16]) > float64(sizes[1])*1.01 {
+		t.Errorf("Sampled table lost more than 1%%: full %d bytes, sampled %d bytes", sizes[1], sizes[16])
+	}
+}
+
+func TestFormatByte(t *testing.T) {
+	tests := []struct {
+		input    byte
+		expected string
+	}{
+		{0x00, `\0`},
+		{0x09, `\t`},
+		{0x0A, `\n`},
+		{0x0D, `\r`},
+		{0x41, "A"},
+		{0x7F, `\x7f`},
+		{0xFF, `\xff`},
+	}
+
+	for _, tt := range tests {
+		if got := formatByte(tt.input); got != tt.expected {
+			t.Errorf("formatByte(0x%02X): expected %q, got %q", tt.input, tt.expected, got)
+		}
 	}
 }
 
@@ -324,6 +631,107 @@ func BenchmarkBuildFrequencyTable(b *testing.B) {
 	}
 }
 
+// buildFrequencyTableMap counts with a map directly, as
+// BuildFrequencyTableFromData did before it counted into an array
+func buildFrequencyTableMap(data []byte) FrequencyTable {
+	freq := make(FrequencyTable)
+	for _, b := range data {
+		freq[b]++
+	}
+	return freq
+}
+
+func TestBuildFrequencyTableArrayMatchesMap(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("hello world"),
+		random,
+	}
+	for _, data := range inputs {
+		if got, want := BuildFrequencyTableFromData(data), buildFrequencyTableMap(data); !reflect.DeepEqual(got, want) {
+			t.Errorf("Array-built table %v differs from map-built table %v", got, want)
+		}
+	}
+}
+
+// BenchmarkFrequencyCounting compares counting into a map with counting into
+// an array on a large input; run with -benchmem to see the allocations
+func BenchmarkFrequencyCounting(b *testing.B) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.Run("map", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buildFrequencyTableMap(data)
+		}
+	})
+	b.Run("array", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			BuildFrequencyTableFromData(data)
+		}
+	})
+}
+
+// buildFrequencyTableByteReads counts a file one ReadByte call at a time, as
+// BuildFrequencyTable did before it read in chunks
+func buildFrequencyTableByteReads(path string) (FrequencyTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	freq := make(FrequencyTable)
+	reader := bufio.NewReader(file)
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return freq, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		freq[b]++
+	}
+}
+
+// BenchmarkBuildFrequencyTableFile compares reading a 50 MB file in chunks with
+// reading it a byte at a time
+func BenchmarkBuildFrequencyTableFile(b *testing.B) {
+	data := make([]byte, 50<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	path := filepath.Join(b.TempDir(), "large.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("chunked", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := BuildFrequencyTable(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("bytewise", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := buildFrequencyTableByteReads(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func BenchmarkBuildHuffmanTree(b *testing.B) {
 	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 100)
 	freq := BuildFrequencyTableFromData(data)
@@ -349,3 +757,662 @@ func BenchmarkEncodeData(b *testing.B) {
 		}
 	}
 }
+
+// encodeDataBuilder packs bits like EncodeData but builds the bit string in a
+// fresh strings.Builder on every call, as EncodeData did before pooling
+func encodeDataBuilder(data []byte, codes CodeTable) []byte {
+	var buf strings.Builder
+	for _, b := range data {
+		buf.WriteString(codes[b])
+	}
+	bitString := buf.String()
+
+	result := make([]byte, (len(bitString)+7)/8)
+	for i := 0; i < len(bitString); i++ {
+		if bitString[i] == '1' {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+// BenchmarkEncodeDataRepeated encodes the same input over and over, as a
+// server would, to show the allocations the pooled bit buffer saves
+func BenchmarkEncodeDataRepeated(b *testing.B) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 1000)
+	codes := GenerateCodeTable(BuildHuffmanTree(BuildFrequencyTableFromData(data)))
+	if !bytes.Equal(EncodeData(data, codes), encodeDataBuilder(data, codes)) {
+		b.Fatal("EncodeData and the builder reference disagree")
+	}
+
+	b.Run("builder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			encodeDataBuilder(data, codes)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			EncodeData(data, codes)
+		}
+	})
+}
+
+func TestTwoSymbols(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	data := make([]byte, 1001)
+	for i := range data {
+		data[i] = "ab"[rng.Intn(2)]
+	}
+
+	freq := BuildFrequencyTableFromData(data)
+	codes, tree := BuildCodes(freq)
+	if len(codes) != 2 || codes['a'] == codes['b'] || len(codes['a']) != 1 || len(codes['b']) != 1 {
+		t.Fatalf("Expected codes \"0\" and \"1\", got %v", codes)
+	}
+
+	encoded := EncodeData(data, codes)
+	if want := encodeDataBuilder(data, codes); !bytes.Equal(want, encoded) {
+		t.Errorf("Fast path output differs from the general encoder")
+	}
+	if len(encoded) != (len(data)+7)/8 {
+		t.Errorf("Expected %d bytes, got %d", (len(data)+7)/8, len(encoded))
+	}
+	decoded, err := DecodeData(encoded, tree, int64(len(data)), (8-len(data)%8)%8)
+	if err != nil {
+		t.Fatalf("DecodeData error: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Errorf("Round trip mismatch: %s", describeDiff(data, decoded))
+	}
+
+	// Bytes outside the table fall back to the general encoder, which skips them
+	withUnknown := []byte("abzab")
+	if got, want := EncodeData(withUnknown, codes), encodeDataBuilder(withUnknown, codes); !bytes.Equal(want, got) {
+		t.Errorf("Expected %08b for input with an unknown byte, got %08b", want, got)
+	}
+
+	var buf bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &buf, Options{}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := Decompress(&buf, &out); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("Compress round trip mismatch: %s", describeDiff(data, out.Bytes()))
+	}
+}
+
+// BenchmarkEncodeTwoSymbols encodes a binary alphabet, which takes the
+// two-symbol fast path
+func BenchmarkEncodeTwoSymbols(b *testing.B) {
+	rng := rand.New(rand.NewSource(12))
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = "01"[rng.Intn(2)]
+	}
+	codes, _ := BuildCodes(BuildFrequencyTableFromData(data))
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EncodeData(data, codes)
+	}
+}
+
+func TestTwoLeafSingleSymbol(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		opts   Options
+		leaves int
+	}{
+		{"special case", Options{}, 1},
+		{"two leaves", Options{TwoLeafSingleSymbol: true}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.name+".huf")
+			decompressedPath := filepath.Join(tmpDir, tt.name+".txt")
+			if err := CompressFileWithOptions(inputPath, compressedPath, tt.opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			compressed, err := os.ReadFile(compressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, err := ParseHeader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if codes := GenerateCodeTable(header.Root()); len(codes) != tt.leaves {
+				t.Errorf("Expected %d leaves, got %d", tt.leaves, len(codes))
+			}
+
+			if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+				t.Fatalf("Decompression failed: %v", err)
+			}
+			decompressed, err := os.ReadFile(decompressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, decompressed) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+			}
+		})
+	}
+}
+
+func TestTwoLeafSingleSymbolTables(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"frequencies", Options{Table: TableFrequencies}},
+		{"tree", Options{Table: TableTree}},
+		{"ranges", Options{Table: TableRanges}},
+		{"nibbles", Options{Table: TableNibbles}},
+		{"coded", Options{Table: TableCoded}},
+		{"delta", Options{DeltaBase: EnglishTextModel}},
+		{"quantized", Options{Quantize: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.TwoLeafSingleSymbol = true
+			// Few enough bytes for a nibble table
+			for _, n := range []int{1, 12} {
+				data := bytes.Repeat([]byte("x"), n)
+				var compressed, decompressed bytes.Buffer
+				if err := Compress(bytes.NewReader(data), &compressed, tt.opts); err != nil {
+					t.Fatalf("Compress error for %d bytes: %v", n, err)
+				}
+				if err := Decompress(&compressed, &decompressed); err != nil {
+					t.Fatalf("Decompress error for %d bytes: %v", n, err)
+				}
+				if !bytes.Equal(data, decompressed.Bytes()) {
+					t.Errorf("Decompressed %d bytes don't match original: %s", n, describeDiff(data, decompressed.Bytes()))
+				}
+			}
+		})
+	}
+}
+
+func TestDirectoryInput(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(t.TempDir(), "output")
+
+	if err := CompressFile(dir, outputPath); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("Expected ErrIsDirectory from CompressFile, got %v", err)
+	}
+	if err := DecompressFile(dir, outputPath); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("Expected ErrIsDirectory from DecompressFile, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file to be created, got %v", err)
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	data := []byte("the input must survive being named as the output")
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The same file through a different path
+	otherPath := filepath.Join(tmpDir, "link.txt")
+	if err := os.Link(inputPath, otherPath); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	if err := CompressFile(inputPath, otherPath); !errors.Is(err, ErrSameFile) {
+		t.Errorf("Expected ErrSameFile from CompressFile, got %v", err)
+	}
+	if err := DecompressFile(inputPath, inputPath); !errors.Is(err, ErrSameFile) {
+		t.Errorf("Expected ErrSameFile from DecompressFile, got %v", err)
+	}
+
+	got, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, got) {
+		t.Errorf("Input was modified: %s", describeDiff(data, got))
+	}
+}
+
+func TestPlannedSizeMatchesOutput(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(9)).Read(random)
+	text := bytes.Repeat([]byte("Predicted Sizes Must Match The Written File. "), 40)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"tree table", Options{Table: TableTree}},
+		{"padded", Options{PadTo: 512}},
+		{"omit size", Options{OmitSize: true}},
+		{"top k", Options{TopK: 8}},
+		{"fold case", Options{FoldCase: true}},
+		{"checksum", Options{Checksum: true}},
+		{"delta", Options{DeltaBase: EnglishTextModel}},
+		{"trailer", Options{Trailer: true}},
+	}
+
+	for _, tt := range tests {
+		for _, data := range [][]byte{random, text, []byte("z")} {
+			plan, err := planCompressed(data, BuildFrequencyTableFromData(data), tt.opts, 0)
+			if err != nil {
+				t.Fatalf("%s: planCompressed error: %v", tt.name, err)
+			}
+			var buf bytes.Buffer
+			if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), tt.opts); err != nil {
+				t.Fatalf("%s: writeCompressed error: %v", tt.name, err)
+			}
+			if plan.size() != int64(buf.Len()) {
+				t.Errorf("%s: predicted %d bytes for a %d byte input, wrote %d", tt.name, plan.size(), len(data), buf.Len())
+			}
+		}
+	}
+}
+
+func TestStoreIfLarger(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(10)).Read(random)
+	text := bytes.Repeat([]byte("text compresses well enough to keep "), 40)
+
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		stored bool
+	}{
+		{"random", random, true},
+		{"text", text, false},
+		// Coding takes a byte more than the input but less than the stored
+		// header and input together
+		{"short", []byte("abababbaabbab"), false},
+	} {
+		var buf bytes.Buffer
+		if err := writeCompressed(&buf, tt.data, BuildFrequencyTableFromData(tt.data), Options{StoreIfLarger: true}); err != nil {
+			t.Fatalf("%s: writeCompressed error: %v", tt.name, err)
+		}
+		var stored, coded bytes.Buffer
+		if err := writeCompressed(&stored, tt.data, nil, Options{Store: true}); err != nil {
+			t.Fatalf("%s: writeCompressed error: %v", tt.name, err)
+		}
+		if err := writeCompressed(&coded, tt.data, BuildFrequencyTableFromData(tt.data), Options{}); err != nil {
+			t.Fatalf("%s: writeCompressed error: %v", tt.name, err)
+		}
+		if want := min(stored.Len(), coded.Len()); buf.Len() != want {
+			t.Errorf("%s: expected the smaller stream of %d bytes, got %d", tt.name, want, buf.Len())
+		}
+		header, err := ParseHeader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: ParseHeader error: %v", tt.name, err)
+		}
+		if header.Stored != tt.stored {
+			t.Errorf("%s: expected stored %v, got %v", tt.name, tt.stored, header.Stored)
+		}
+
+		var decoded bytes.Buffer
+		if err := Decompress(bytes.NewReader(buf.Bytes()), &decoded); err != nil {
+			t.Fatalf("%s: Decompress error: %v", tt.name, err)
+		}
+		if !bytes.Equal(tt.data, decoded.Bytes()) {
+			t.Errorf("%s: round trip mismatch: %s", tt.name, describeDiff(tt.data, decoded.Bytes()))
+		}
+	}
+}
+
+func TestCompressFileReadsInputOnce(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte('a' + int(rng.ExpFloat64()*4)%26)
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opens := 0
+	openInput = func(name string) (*os.File, error) {
+		opens++
+		return os.Open(name)
+	}
+	defer func() { openInput = os.Open }()
+
+	for _, every := range []int{0, 4} {
+		outputPath := filepath.Join(tmpDir, "output.huf")
+		opens = 0
+		if err := CompressFileWithOptions(inputPath, outputPath, Options{SampleEvery: every}); err != nil {
+			t.Fatalf("Compression with SampleEvery=%d failed: %v", every, err)
+		}
+		if opens != 1 {
+			t.Errorf("SampleEvery=%d: expected the input to be opened once, got %d", every, opens)
+		}
+
+		// The output matches what counting the file separately produces
+		var freq FrequencyTable
+		var err error
+		if every > 1 {
+			freq, err = BuildFrequencyTableSampled(inputPath, every)
+			addMissingSymbols(freq, data)
+		} else {
+			freq, err = BuildFrequencyTable(inputPath)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want bytes.Buffer
+		if err := writeCompressed(&want, data, freq, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want.Bytes(), got) {
+			t.Errorf("SampleEvery=%d: output differs from a two-pass compression: %s", every, describeDiff(want.Bytes(), got))
+		}
+	}
+}
+
+func TestCompressFileSpill(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte('a' + int(rng.ExpFloat64()*4)%26)
+	}
+	data[5000] = 0xff // outside the blocks SampleEvery: 4 counts
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opens := 0
+	openInput = func(name string) (*os.File, error) {
+		opens++
+		return os.Open(name)
+	}
+	defer func(threshold int64, chunk int) {
+		openInput, spillThreshold, spillChunk = os.Open, threshold, chunk
+	}(spillThreshold, spillChunk)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"sampled", Options{SampleEvery: 4}},
+		{"checksum and trailer", Options{Checksum: true, Trailer: true}},
+		{"padded", Options{PadTo: 4096, Table: TableFrequencies}},
+		{"delta", Options{DeltaBase: EnglishTextModel}},
+		{"quantized legacy", Options{Quantize: true, Legacy: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inMemoryPath := filepath.Join(tmpDir, tt.name+".mem.huf")
+			spilledPath := filepath.Join(tmpDir, tt.name+".spill.huf")
+
+			spillThreshold = math.MaxInt64
+			want, err := CompressFileResultWithOptions(inputPath, inMemoryPath, tt.opts)
+			if err != nil {
+				t.Fatalf("In-memory compression failed: %v", err)
+			}
+
+			// An odd chunk size puts chunk ends mid-byte and mid-block
+			spillThreshold, spillChunk = 0, 4099
+			opens = 0
+			var done, total int64
+			opts := tt.opts
+			opts.Progress = func(d, tot int64) { done, total = d, tot }
+			got, err := CompressFileResultWithOptions(inputPath, spilledPath, opts)
+			if err != nil {
+				t.Fatalf("Spilled compression failed: %v", err)
+			}
+			if opens != 1 {
+				t.Errorf("Expected the input to be opened once, got %d", opens)
+			}
+			if done != total || total != 2*int64(len(data)) {
+				t.Errorf("Last progress was %d of %d, want %d of %d", done, total, 2*len(data), 2*len(data))
+			}
+			if got.CompressedSize != want.CompressedSize || got.DistinctSymbols != want.DistinctSymbols || got.SHA256 != want.SHA256 || got.TheoreticalMinBytes != want.TheoreticalMinBytes {
+				t.Errorf("Result = %+v, want %+v", got, want)
+			}
+
+			wantBytes, err := os.ReadFile(inMemoryPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotBytes, err := os.ReadFile(spilledPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(wantBytes, gotBytes) {
+				t.Errorf("Spilled output differs from in-memory output: %s", describeDiff(wantBytes, gotBytes))
+			}
+		})
+	}
+
+	// Without a temporary directory the spill fails, unless the options
+	// keep the input in memory
+	spillThreshold = 0
+	t.Setenv("TMPDIR", filepath.Join(tmpDir, "missing"))
+	if err := CompressFileWithOptions(inputPath, filepath.Join(tmpDir, "nowhere.huf"), Options{}); err == nil {
+		t.Error("Expected the spill to fail without a temporary directory")
+	}
+	if err := CompressFileWithOptions(inputPath, filepath.Join(tmpDir, "folded.huf"), Options{FoldCase: true}); err != nil {
+		t.Errorf("FoldCase compression failed: %v", err)
+	}
+}
+
+func TestVerifyAfterCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("verified right after it is written "), 100)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	outputPath := filepath.Join(tmpDir, "output.huf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CompressFileWithOptions(inputPath, outputPath, Options{VerifyAfterCompress: true}); err != nil {
+		t.Fatalf("Verified compression failed: %v", err)
+	}
+	verified, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Expected the verified output to be kept: %v", err)
+	}
+
+	// Inject a fault into the decoded data
+	roundTripFault = func(decoded []byte) []byte {
+		decoded[len(decoded)/2] ^= 1
+		return decoded
+	}
+	t.Cleanup(func() { roundTripFault = nil })
+
+	newPath := filepath.Join(tmpDir, "new.huf")
+	if err := CompressFileWithOptions(inputPath, newPath, Options{VerifyAfterCompress: true}); !errors.Is(err, ErrRoundTripFailed) {
+		t.Errorf("Expected ErrRoundTripFailed, got %v", err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the output to be removed, got %v", err)
+	}
+
+	// The file already at the output path is left as it was
+	if err := CompressFileWithOptions(inputPath, outputPath, Options{VerifyAfterCompress: true}); !errors.Is(err, ErrRoundTripFailed) {
+		t.Errorf("Expected ErrRoundTripFailed, got %v", err)
+	}
+	if kept, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(verified, kept) {
+		t.Errorf("Expected the earlier output to be kept, got %v", err)
+	}
+	if entries, err := os.ReadDir(tmpDir); err != nil || len(entries) != 2 {
+		t.Errorf("Expected only the input and output to be left, got %v (%v)", entries, err)
+	}
+}
+
+func TestCompressFileRemovesOutputOnError(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	outputPath := filepath.Join(tmpDir, "output.huf")
+	if err := os.WriteFile(inputPath, blockTestData(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The counts of the text don't fit in a nibble table, which only fails
+	// once the output has been created
+	if err := CompressFileWithOptions(inputPath, outputPath, Options{Table: TableNibbles}); err == nil {
+		t.Fatal("Expected compression with a nibble table to fail")
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the output to be removed, got %v", err)
+	}
+}
+
+func TestDecompressFileReplacesOutput(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	truncatedPath := filepath.Join(tmpDir, "truncated.huf")
+	outputPath := filepath.Join(tmpDir, "output.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	compressed, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(truncatedPath, compressed[:len(compressed)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old := []byte("the caller's file")
+	if err := os.WriteFile(outputPath, old, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecompressFile(truncatedPath, outputPath); err == nil {
+		t.Fatal("Expected an error decompressing a truncated file")
+	}
+	if kept, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(old, kept) {
+		t.Errorf("Expected a failed decompression to leave the existing file, got %q (%v)", kept, err)
+	}
+
+	if err := DecompressFile(compressedPath, outputPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the replaced file to keep its mode 0600, got %v", info.Mode().Perm())
+	}
+	if entries, err := os.ReadDir(tmpDir); err != nil || len(entries) != 4 {
+		t.Errorf("Expected no temporary files to be left, got %v (%v)", entries, err)
+	}
+}
+
+// describeDiff reports where got first differs from want, for test failure
+// messages
+var describeDiff = bytediff.Describe
+
+func TestQuantizeFrequencies(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	skewed := make([]byte, 200000)
+	for i := range skewed {
+		skewed[i] = byte('a' + int(rng.ExpFloat64()*3)%20)
+	}
+
+	var dyadic []byte
+	for i, char := range []byte("abcdefgh") {
+		dyadic = append(dyadic, bytes.Repeat([]byte{char}, 64000>>i)...)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		sameCodes bool
+		want      FrequencyTable // the quantized counts, if checked
+	}{
+		{"small counts", []byte("abracadabra"), true, FrequencyTable{'a': 5, 'b': 2, 'c': 1, 'd': 1, 'r': 2}},
+		{"dyadic", dyadic, true, FrequencyTable{'a': 255, 'b': 128, 'c': 64, 'd': 32, 'e': 16, 'f': 8, 'g': 4, 'h': 2}},
+		{"english text", bytes.Repeat([]byte("It was the best of times, it was the worst of times. "), 2000), false, nil},
+		{"skewed", skewed, false, nil},
+	}
+
+	// encodedBits returns the payload size of data under codes
+	encodedBits := func(data []byte, codes CodeTable) int {
+		bits := 0
+		for _, b := range data {
+			bits += len(codes[b])
+		}
+		return bits
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freq := BuildFrequencyTableFromData(tt.data)
+			quantized := QuantizeFrequencies(freq)
+
+			if len(quantized) != len(freq) {
+				t.Fatalf("Expected %d symbols, got %d", len(freq), len(quantized))
+			}
+			if tt.want != nil && !reflect.DeepEqual(tt.want, quantized) {
+				t.Errorf("Expected quantized counts %v, got %v", tt.want, quantized)
+			}
+			for char, count := range quantized {
+				if count < 1 || count > 255 {
+					t.Errorf("Quantized count %d for %s is out of range", count, formatByte(char))
+				}
+			}
+
+			raw := GenerateCodeTable(BuildHuffmanTree(freq))
+			scaled := GenerateCodeTable(BuildHuffmanTree(quantized))
+			if tt.sameCodes && !reflect.DeepEqual(raw, scaled) {
+				t.Errorf("Codes differ after quantization.\nRaw: %v\nQuantized: %v", raw, scaled)
+			}
+			// Rounding may break ties differently, but must not cost much
+			if rawBits, scaledBits := encodedBits(tt.data, raw), encodedBits(tt.data, scaled); float64(scaledBits) > float64(rawBits)*1.01 {
+				t.Errorf("Quantized codes take %d bits, more than 1%% over %d", scaledBits, rawBits)
+			}
+
+			var compressed, decompressed bytes.Buffer
+			if err := Compress(bytes.NewReader(tt.data), &compressed, Options{Quantize: true}); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+			if err := Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decompressed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decompressed.Bytes()))
+			}
+		})
+	}
+}
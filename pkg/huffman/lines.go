@@ -0,0 +1,164 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// CompressLines compresses line-delimited data, such as a log file, so that
+// single lines can be read back with GetLine without decoding the rest. One
+// tree is built over the whole of data and each line, with its newline, is
+// coded as its own byte-aligned record. The header indexes the records:
+//
+//	[Magic:1][Version:1][Flags:uvarint][LineCount:uvarint][Index:LineCount×(Length:uvarint, RecordSize:uvarint)][Table:1][Model][Records]
+//
+// The result decodes in full with Decompress like any other stream.
+func CompressLines(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty input")
+	}
+
+	freq := BuildFrequencyTableFromData(data)
+	if len(freq) == 1 {
+		freq = addUnusedSymbol(freq)
+	}
+	codes, tree := BuildCodes(freq)
+	if tree == nil {
+		return nil, fmt.Errorf("failed to build huffman tree")
+	}
+
+	header := newHeader(freq, tree, int64(len(data)), 0, TableAuto)
+	header.Lines = []BlockInfo{}
+	var records []byte
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		record := EncodeData(data[:end], codes)
+		header.Lines = append(header.Lines, BlockInfo{
+			OriginalSize:   int64(end),
+			CompressedSize: int64(len(record)),
+		})
+		records = append(records, record...)
+		data = data[end:]
+	}
+
+	out, err := appendHeader(nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return append(out, records...), nil
+}
+
+// GetLine returns line lineNum, counting from 1, of a file written by
+// CompressLines, without its newline. Only that line's record is read and
+// decoded.
+func GetLine(archivePath string, lineNum int) ([]byte, error) {
+	if err := checkNotDirectory(archivePath); err != nil {
+		return nil, err
+	}
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Lines == nil {
+		return nil, fmt.Errorf("file is not a line archive")
+	}
+	if lineNum < 1 || lineNum > len(header.Lines) {
+		return nil, fmt.Errorf("line %d out of range [1, %d]", lineNum, len(header.Lines))
+	}
+
+	var offset int64
+	for _, line := range header.Lines[:lineNum-1] {
+		offset += line.CompressedSize
+	}
+	if _, err := input.Seek(offset, io.SeekCurrent); err != nil {
+		return nil, fmt.Errorf("failed to seek to line %d: %w", lineNum, err)
+	}
+
+	line, err := readLine(input, header.Root(), header.Lines[lineNum-1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode line %d: %w", lineNum, err)
+	}
+	return bytes.TrimSuffix(line, []byte("\n")), nil
+}
+
+// decodeLines decodes every record of a line archive from r to w
+func decodeLines(r io.Reader, h *Header, w io.Writer) error {
+	tree := h.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+	for i, line := range h.Lines {
+		decoded, err := readLine(r, tree, line)
+		if err != nil {
+			return fmt.Errorf("failed to decode line %d: %w", i+1, err)
+		}
+		if _, err := w.Write(decoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLine reads and decodes the next record of a line archive from r
+func readLine(r io.Reader, tree *Node, line BlockInfo) ([]byte, error) {
+	record, err := io.ReadAll(io.LimitReader(r, line.CompressedSize))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(record)) != line.CompressedSize {
+		return nil, fmt.Errorf("record truncated: got %d of %d bytes", len(record), line.CompressedSize)
+	}
+
+	decoded, err := newDecoder(record, tree, line.OriginalSize, 0).readAll()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) != line.OriginalSize {
+		return nil, fmt.Errorf("record decoded to %d bytes, index records %d", len(decoded), line.OriginalSize)
+	}
+	return decoded, nil
+}
+
+// readLineIndex parses the index and model of a line archive
+func readLineIndex(br byteReadReader, version int) (*Header, error) {
+	h, err := readBlockIndex(br, version)
+	if err != nil {
+		return nil, err
+	}
+	h.Lines, h.Blocks = h.Blocks, nil
+
+	table, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	h.Table = TableFormat(table)
+	if err := readTable(br, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// appendLineIndex serializes the index and model of a line archive
+func appendLineIndex(buf []byte, h *Header) ([]byte, error) {
+	buf = appendBlockIndex(buf, h.Lines)
+	buf = append(buf, byte(h.Table))
+	return appendTable(buf, h)
+}
@@ -0,0 +1,122 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressLinesGetLine(t *testing.T) {
+	var data []byte
+	for i := 0; i < 200; i++ {
+		data = fmt.Appendf(data, "2026-10-16T12:%02d:%02d INFO request %d served in %dms\n", i/60, i%60, i, i*7%300)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"log", data},
+		{"no trailing newline", []byte("first\nsecond\nthird")},
+		{"empty lines", []byte("a\n\n\nb\n")},
+		{"single symbol", []byte("\n\n\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := CompressLines(tt.data)
+			if err != nil {
+				t.Fatalf("CompressLines error: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "lines.huf")
+			if err := os.WriteFile(path, compressed, 0644); err != nil {
+				t.Fatalf("Failed to write archive: %v", err)
+			}
+
+			lines := bytes.SplitAfter(tt.data, []byte("\n"))
+			if len(lines[len(lines)-1]) == 0 {
+				lines = lines[:len(lines)-1]
+			}
+			for _, num := range []int{1, len(lines) / 2, len(lines)} {
+				if num < 1 {
+					continue
+				}
+				want := bytes.TrimSuffix(lines[num-1], []byte("\n"))
+				got, err := GetLine(path, num)
+				if err != nil {
+					t.Fatalf("GetLine(%d) error: %v", num, err)
+				}
+				if !bytes.Equal(want, got) {
+					t.Errorf("Line %d: expected %q, got %q", num, want, got)
+				}
+			}
+			if _, err := GetLine(path, len(lines)+1); err == nil {
+				t.Error("Expected an error for a line past the end")
+			}
+			if _, err := GetLine(path, 0); err == nil {
+				t.Error("Expected an error for line 0")
+			}
+
+			var decoded bytes.Buffer
+			if err := Decompress(bytes.NewReader(compressed), &decoded); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decoded.Bytes()))
+			}
+		})
+	}
+}
+
+func TestNewReaderLines(t *testing.T) {
+	data := []byte("first line\nsecond\n\nfourth, after an empty one\nlast without a newline")
+	compressed, err := CompressLines(data)
+	if err != nil {
+		t.Fatalf("CompressLines error: %v", err)
+	}
+
+	zr, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("NewReader error: %v", err)
+	}
+	all, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("ReadAll error: %v", err)
+	}
+	if !bytes.Equal(data, all) {
+		t.Errorf("Read data doesn't match original: %s", describeDiff(data, all))
+	}
+
+	// Seek into the middle of a line and across lines
+	for _, offset := range []int64{0, 3, 18, 19, 40} {
+		if _, err := zr.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d) error: %v", offset, err)
+		}
+		got := make([]byte, 12)
+		n, err := io.ReadFull(zr, got)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("Read at %d error: %v", offset, err)
+		}
+		want := data[offset:min(offset+12, int64(len(data)))]
+		if !bytes.Equal(want, got[:n]) {
+			t.Errorf("Read at %d = %q, want %q", offset, got[:n], want)
+		}
+	}
+}
+
+func TestGetLineNotLineArchive(t *testing.T) {
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader([]byte("one\ntwo\n")), &compressed, Options{}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "plain.huf")
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := GetLine(path, 1); err == nil {
+		t.Error("Expected an error for a file that isn't a line archive")
+	}
+}
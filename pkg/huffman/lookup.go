@@ -0,0 +1,137 @@
+package huffman
+
+import "fmt"
+
+// maxLookupBits is the most bits a lookup table is indexed with. A table has
+// 1<<maxLookupBits entries at most; longer codes continue in a subtable.
+const maxLookupBits = 16
+
+// lookupEntry is the symbol whose code is a prefix of a table index and the
+// length of that code within the table. An entry with a next table marks an
+// index that is only the start of longer codes, which continue there. A
+// length of 0 and no next table marks an index no code matches.
+type lookupEntry struct {
+	symbol byte
+	length uint8
+	next   *lookupTable
+}
+
+// lookupTable decodes a code in one step by indexing with the next bits bits
+// of the payload, whatever the code's length, or in one step per table for
+// codes longer than maxLookupBits
+type lookupTable struct {
+	bits    int
+	entries []lookupEntry
+}
+
+// newLookupTable builds the lookup table for the codes of the tree at root,
+// where a 0 bit leads left. Codes longer than maxLookupBits are split across
+// a chain of subtables of maxLookupBits bits each.
+func newLookupTable(root *Node) *lookupTable {
+	depth := min(treeDepth(root), maxLookupBits)
+	t := &lookupTable{bits: depth, entries: make([]lookupEntry, 1<<depth)}
+	var fill func(node *Node, code, length int)
+	fill = func(node *Node, code, length int) {
+		if node == nil {
+			return
+		}
+		if node.Left == nil && node.Right == nil {
+			// Every index starting with the code decodes to this symbol
+			start := code << (depth - length)
+			end := (code + 1) << (depth - length)
+			for i := start; i < end; i++ {
+				t.entries[i] = lookupEntry{symbol: node.Char, length: uint8(length)}
+			}
+			return
+		}
+		if length == depth {
+			t.entries[code] = lookupEntry{next: newLookupTable(node)}
+			return
+		}
+		fill(node.Left, code<<1, length+1)
+		fill(node.Right, code<<1|1, length+1)
+	}
+	fill(root, 0, 0)
+	return t
+}
+
+// treeDepth returns the length of the longest code in the tree at root
+func treeDepth(root *Node) int {
+	if root == nil || (root.Left == nil && root.Right == nil) {
+		return 0
+	}
+	return 1 + max(treeDepth(root.Left), treeDepth(root.Right))
+}
+
+// useLookup switches d from walking the tree to decoding with a lookup table.
+// A single-symbol tree needs neither and is left as it is.
+func (d *decoder) useLookup() {
+	if d.root.Left == nil && d.root.Right == nil {
+		return
+	}
+	d.lookup = newLookupTable(d.root)
+}
+
+// peek returns the next n bits of the payload, for n up to 16, without
+// consuming them. Bits past the end of the payload read as zero.
+func (d *decoder) peek(n int) int {
+	i := d.bit / 8
+	var window uint32
+	for j := 0; j < 3; j++ {
+		window <<= 8
+		if i+j < len(d.data) {
+			window |= uint32(d.data[i+j])
+		}
+	}
+	return int(window>>(24-d.bit%8-n)) & (1<<n - 1)
+}
+
+// readLookup is read for a decoder with a lookup table. Each symbol costs one
+// peek and one table index however long its code is, up to maxLookupBits,
+// which makes the time per symbol more uniform than a tree walk. Longer codes
+// take one more of each per subtable.
+func (d *decoder) readLookup(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && d.bit < d.totalBits {
+		t := d.lookup
+		entry := t.entries[d.peek(t.bits)]
+		for entry.next != nil {
+			if d.bit+t.bits > d.totalBits {
+				return n, fmt.Errorf("invalid bit sequence: payload ends inside a code")
+			}
+			d.bit += t.bits
+			t = entry.next
+			entry = t.entries[d.peek(t.bits)]
+		}
+		if entry.length == 0 {
+			return n, fmt.Errorf("invalid bit sequence: no code at bit %d", d.bit)
+		}
+		if d.bit+int(entry.length) > d.totalBits {
+			return n, fmt.Errorf("invalid bit sequence: payload ends inside a code")
+		}
+		d.bit += int(entry.length)
+
+		char := entry.symbol
+		if d.escaped && char == d.escape {
+			if d.bit+8 > d.totalBits {
+				return n, fmt.Errorf("invalid bit sequence: payload ends inside an escaped literal")
+			}
+			char = byte(d.peek(8))
+			d.bit += 8
+		}
+		if d.remap != nil {
+			char = d.remap[char]
+		}
+		if d.caseMap != nil {
+			var ok bool
+			if char, ok = d.caseMap.apply(char); !ok {
+				return n, fmt.Errorf("case map ends before the payload")
+			}
+		}
+		p[n] = char
+		n++
+	}
+
+	d.remaining -= int64(n)
+	return n, nil
+}
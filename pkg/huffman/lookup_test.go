@@ -0,0 +1,158 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUniformTimingMatchesTreeWalk(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(11)).Read(random)
+	text := blockTestData()
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+	}{
+		{"text", text, Options{}},
+		{"random", random, Options{}},
+		{"tree table", text, Options{Table: TableTree}},
+		{"escaped", text, Options{TopK: 5}},
+		{"fold case", []byte(strings.Repeat("Uniform TIMING test ", 40)), Options{FoldCase: true}},
+		{"derived size", text, Options{OmitSize: true}},
+		{"checksum", text, Options{Checksum: true}},
+		{"single symbol", bytes.Repeat([]byte("u"), 100), Options{}},
+		{"stored", text, Options{Store: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			if err := writeCompressed(&compressed, tt.data, BuildFrequencyTableFromData(tt.data), tt.opts); err != nil {
+				t.Fatalf("writeCompressed error: %v", err)
+			}
+
+			var walked, looked bytes.Buffer
+			if err := decompress(bytes.NewReader(compressed.Bytes()), &walked, DecompressOptions{}); err != nil {
+				t.Fatalf("Tree walk error: %v", err)
+			}
+			if err := decompress(bytes.NewReader(compressed.Bytes()), &looked, DecompressOptions{UniformTiming: true}); err != nil {
+				t.Fatalf("Lookup error: %v", err)
+			}
+			if !bytes.Equal(walked.Bytes(), looked.Bytes()) {
+				t.Errorf("Lookup output differs from tree walk: %s", describeDiff(walked.Bytes(), looked.Bytes()))
+			}
+			if !bytes.Equal(tt.data, looked.Bytes()) {
+				t.Errorf("Lookup output doesn't match original: %s", describeDiff(tt.data, looked.Bytes()))
+			}
+		})
+	}
+}
+
+func TestUniformTimingFile(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	outputPath := filepath.Join(tmpDir, "output.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("CompressFile error: %v", err)
+	}
+
+	if err := DecompressFileWithOptions(compressedPath, outputPath, DecompressOptions{UniformTiming: true}); err != nil {
+		t.Fatalf("DecompressFileWithOptions error: %v", err)
+	}
+	decompressed, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+}
+
+func TestUniformTimingDeepTree(t *testing.T) {
+	// Fibonacci counts give a tree with a code as long as the alphabet
+	freq := make(FrequencyTable)
+	a, b := 1, 1
+	for i := 0; i < 20; i++ {
+		freq[byte('a'+i)] = a
+		a, b = b, a+b
+	}
+	var data []byte
+	for char, count := range freq {
+		data = append(data, bytes.Repeat([]byte{char}, count)...)
+	}
+
+	var compressed bytes.Buffer
+	if err := writeCompressed(&compressed, data, freq, Options{}); err != nil {
+		t.Fatalf("writeCompressed error: %v", err)
+	}
+	if depth := treeDepth(BuildHuffmanTree(freq)); depth <= maxLookupBits {
+		t.Fatalf("Longest code is %d bits, want more than %d", depth, maxLookupBits)
+	}
+	var out bytes.Buffer
+	if err := decompress(bytes.NewReader(compressed.Bytes()), &out, DecompressOptions{UniformTiming: true}); err != nil {
+		t.Fatalf("decompress error: %v", err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, out.Bytes()))
+	}
+}
+
+// BenchmarkDecodeTimingVariance decodes payloads made only of the shortest
+// code and only of the longest code. The gap between the two is the timing
+// variation the symbols leak; it is much smaller for the lookup decoder.
+func BenchmarkDecodeTimingVariance(b *testing.B) {
+	// Counts that halve give codes of every length from 1 to 12
+	freq := make(FrequencyTable)
+	for i := 0; i < 13; i++ {
+		freq[byte('a'+i)] = 1 << (12 - i)
+	}
+	tree := BuildHuffmanTree(freq)
+	codes := GenerateCodeTable(tree)
+
+	shortest, longest := byte('a'), byte('a')
+	for char, code := range codes {
+		if len(code) < len(codes[shortest]) {
+			shortest = char
+		}
+		if len(code) > len(codes[longest]) {
+			longest = char
+		}
+	}
+
+	const symbols = 64 * 1024
+	for _, mode := range []struct {
+		name   string
+		lookup bool
+	}{{"walk", false}, {"lookup", true}} {
+		for _, char := range []byte{shortest, longest} {
+			data := bytes.Repeat([]byte{char}, symbols)
+			encoded := EncodeData(data, codes)
+			padding := int((8 - encodedBits(data, codes, -1)%8) % 8)
+			b.Run(fmt.Sprintf("%s/%d-bit", mode.name, len(codes[char])), func(b *testing.B) {
+				out := make([]byte, symbols)
+				b.SetBytes(symbols)
+				for i := 0; i < b.N; i++ {
+					dec := newDecoder(encoded, tree, symbols, padding)
+					if mode.lookup {
+						dec.useLookup()
+					}
+					if _, err := dec.read(out); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
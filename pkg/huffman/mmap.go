@@ -0,0 +1,192 @@
+package huffman
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+)
+
+// mmapChunkSize is how many bytes are decoded into the mapping per step
+const mmapChunkSize = 1 << 20
+
+// errMmapUnsupported is returned by mmapFile on platforms without mmap
+var errMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// DecompressToFileMmap decompresses a Huffman encoded file by memory-mapping
+// the output and decoding straight into the mapping, so the decoded data is
+// never held in a separate buffer. If the output cannot be mapped it falls back
+// to streaming the decoded bytes through a small buffer.
+func DecompressToFileMmap(inputPath, outputPath string) error {
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if header.Encrypted {
+		return ErrEncrypted
+	}
+	if header.ExternalCodes {
+		return ErrExternalCodes
+	}
+	if header.Blocks != nil || header.Lines != nil {
+		// Blocks and lines are small enough to decode one at a time without
+		// a mapping
+		output, err := os.Create(outputPath)
+		if err != nil {
+			return outputError(outputPath, err)
+		}
+		defer func(output *os.File) {
+			err := output.Close()
+			if err != nil {
+				log.Printf("failed to close output file: %v", err)
+			}
+		}(output)
+		if header.Lines != nil {
+			return decodeLines(input, header, output)
+		}
+		return decodeBlocks(input, header, output)
+	}
+
+	encodedData, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	encodedData, err = splitTrailer(header, encodedData)
+	if err != nil {
+		return fmt.Errorf("failed to read trailer: %w", err)
+	}
+
+	if header.Stored {
+		if err := os.WriteFile(outputPath, encodedData, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		return nil
+	}
+
+	tree := header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+	originalSize := header.OriginalSize
+
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return outputError(outputPath, err)
+	}
+	defer func(output *os.File) {
+		err := output.Close()
+		if err != nil {
+			log.Printf("failed to close output file: %v", err)
+		}
+	}(output)
+
+	dec := header.newDecoder(encodedData, tree)
+
+	if originalSize > 0 {
+		if err := output.Truncate(originalSize); err != nil {
+			return fmt.Errorf("failed to size output file: %w", err)
+		}
+
+		mapping, unmap, err := mmapFile(output, originalSize)
+		if err == nil {
+			written, decodeErr := decodeIntoMapping(dec, mapping)
+			if decodeErr == nil && header.Checksummed && crc32.ChecksumIEEE(mapping[:written]) != header.Checksum {
+				decodeErr = ErrChecksumMismatch
+			}
+			if err := unmap(); err != nil && decodeErr == nil {
+				decodeErr = fmt.Errorf("failed to unmap output file: %w", err)
+			}
+			if decodeErr != nil {
+				return fmt.Errorf("failed to decode data: %w", decodeErr)
+			}
+			if written != originalSize {
+				return fmt.Errorf("failed to decode data: got %d of %d bytes", written, originalSize)
+			}
+			return nil
+		}
+
+		// Mapping failed, so discard the preallocated size and stream instead
+		if err := output.Truncate(0); err != nil {
+			return fmt.Errorf("failed to reset output file: %w", err)
+		}
+	}
+
+	crc := crc32.NewIEEE()
+	written, err := decodeToWriter(dec, io.MultiWriter(output, crc))
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	if !header.NoSize && written != originalSize {
+		return fmt.Errorf("failed to decode data: got %d of %d bytes", written, originalSize)
+	}
+	if header.Checksummed && crc.Sum32() != header.Checksum {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// decodeIntoMapping decodes into the mapped output one chunk at a time
+func decodeIntoMapping(dec *decoder, mapping []byte) (int64, error) {
+	var written int64
+	for written < int64(len(mapping)) {
+		end := written + mmapChunkSize
+		if end > int64(len(mapping)) {
+			end = int64(len(mapping))
+		}
+
+		n, err := dec.read(mapping[written:end])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return written, nil
+}
+
+// decodeToWriter streams the decoded bytes to w through a fixed-size buffer
+func decodeToWriter(dec *decoder, w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 64*1024)
+
+	var written int64
+	for {
+		n, err := dec.read(buf)
+		if n > 0 {
+			if _, err := bw.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	return written, bw.Flush()
+}
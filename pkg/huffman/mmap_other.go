@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package huffman
+
+import "os"
+
+// mmapFile always fails here, so callers fall back to streaming
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errMmapUnsupported
+}
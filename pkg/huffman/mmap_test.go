@@ -0,0 +1,94 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressToFileMmap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	testData := make([]byte, 1<<20)
+	for i := range testData {
+		testData[i] = byte(32 + rng.Intn(64))
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+
+	if err := os.WriteFile(inputPath, testData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	if err := DecompressToFileMmap(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(testData, decompressed) {
+		t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(testData), len(decompressed))
+	}
+}
+
+func TestDecodeToWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 3000)
+	freq := BuildFrequencyTableFromData(data)
+	tree := BuildHuffmanTree(freq)
+	codes := GenerateCodeTable(tree)
+	encoded := EncodeData(data, codes)
+
+	totalBits := 0
+	for _, b := range data {
+		totalBits += len(codes[b])
+	}
+	paddingBits := (8 - (totalBits % 8)) % 8
+
+	var buf bytes.Buffer
+	written, err := decodeToWriter(newDecoder(encoded, tree, int64(len(data)), paddingBits), &buf)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+
+	if written != int64(len(data)) || !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("Streamed output doesn't match original. Expected %d bytes, got %d", len(data), written)
+	}
+}
+
+func TestDecompressToFileMmapStored(t *testing.T) {
+	data := []byte("stored streams are copied straight to the output")
+
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(data), &compressed, Options{Store: true, PadTo: 64}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	compressedPath := filepath.Join(tmpDir, "stored.huf")
+	decompressedPath := filepath.Join(tmpDir, "stored.txt")
+	if err := os.WriteFile(compressedPath, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DecompressToFileMmap(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Expected %q, got %q", data, decompressed)
+	}
+}
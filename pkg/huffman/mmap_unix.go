@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package huffman
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of f for reading and writing. The
+// returned function flushes and releases the mapping.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	mapping, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mapping, func() error { return syscall.Munmap(mapping) }, nil
+}
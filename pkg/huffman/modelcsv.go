@@ -0,0 +1,68 @@
+package huffman
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LoadFrequencyTableCSV reads a model from lines of "bytevalue,count", such as
+// one prepared by hand or exported from a notebook, for use with
+// NewModelWriter. The byte value is decimal or hex with a 0x prefix, and a tab
+// may separate the fields instead of a comma. Blank lines and lines starting
+// with # are skipped. Each byte value may appear once.
+func LoadFrequencyTableCSV(r io.Reader) (FrequencyTable, error) {
+	freq := make(FrequencyTable)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		row := strings.TrimSpace(scanner.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(row, func(c rune) bool { return c == ',' || c == '\t' })
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected bytevalue,count, got %q", line, row)
+		}
+		// FieldsFunc drops empty fields, so ",97,5" or "97,,5" would pass as
+		// two fields; a third separator means one of them was empty
+		if strings.IndexAny(row, ",\t") != strings.LastIndexAny(row, ",\t") {
+			return nil, fmt.Errorf("line %d: empty field in %q", line, row)
+		}
+
+		value, err := parseByteValue(strings.TrimSpace(fields[0]))
+		if err != nil || value > math.MaxUint8 {
+			return nil, fmt.Errorf("line %d: invalid byte value %q", line, fields[0])
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: invalid count %q", line, fields[1])
+		}
+
+		char := byte(value)
+		if _, ok := freq[char]; ok {
+			return nil, fmt.Errorf("line %d: duplicate byte value %d", line, char)
+		}
+		freq[char] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read frequency table: %w", err)
+	}
+
+	if len(freq) == 0 {
+		return nil, fmt.Errorf("empty frequency table")
+	}
+	return freq, nil
+}
+
+// parseByteValue parses a decimal number, or a hex one with a 0x prefix. A
+// leading zero doesn't switch to octal.
+func parseByteValue(s string) (uint64, error) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		return strconv.ParseUint(hex, 16, 64)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
@@ -0,0 +1,70 @@
+package huffman
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFrequencyTableCSV(t *testing.T) {
+	input := "# byte,count\n097,5\n0x62,3\n\n  0x0A\t1  \n"
+	freq, err := LoadFrequencyTableCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("LoadFrequencyTableCSV error: %v", err)
+	}
+	want := FrequencyTable{'a': 5, 'b': 3, '\n': 1}
+	if !reflect.DeepEqual(want, freq) {
+		t.Errorf("Expected %v, got %v", want, freq)
+	}
+
+	// The loaded model drives a Writer
+	var buf bytes.Buffer
+	w, err := NewModelWriter(&buf, freq)
+	if err != nil {
+		t.Fatalf("NewModelWriter error: %v", err)
+	}
+	data := []byte("abba\naab\n")
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := Decompress(&buf, &out); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("Round trip mismatch: %s", describeDiff(data, out.Bytes()))
+	}
+}
+
+func TestLoadFrequencyTableCSVErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"bad count", "97,5\n98,lots\n", "line 2: invalid count"},
+		{"negative count", "97,-1\n", "line 1: invalid count"},
+		{"byte out of range", "256,1\n", "line 1: invalid byte value"},
+		{"hex out of range", "0x1FF,1\n", "line 1: invalid byte value"},
+		{"missing field", "97\n", "line 1: expected bytevalue,count"},
+		{"empty count", "97,5\n98,,3\n", "line 2: empty field"},
+		{"empty byte value", ",98,3\n", "line 1: empty field"},
+		{"trailing separator", "98,3,\n", "line 1: empty field"},
+		{"comma and tab", "98,\t3\n", "line 1: empty field"},
+		{"duplicate", "97,1\n0x61,2\n", "line 2: duplicate byte value"},
+		{"empty", "# nothing\n", "empty frequency table"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFrequencyTableCSV(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxNibble is the largest count, and the largest symbol offset, that fits in
+// a nibble
+const maxNibble = 15
+
+// appendNibbles serializes a tiny model as the lowest symbol, a 16-bit map of
+// the symbols present as offsets from it, then one 4-bit count per symbol in
+// ascending order, high nibble first. It only applies to at most 16 symbols
+// within 16 consecutive byte values, each counted at most 15 times, which
+// covers the alphabets of very small files.
+func appendNibbles(buf []byte, freq FrequencyTable) ([]byte, error) {
+	if len(freq) == 0 || len(freq) > maxNibble+1 {
+		return nil, fmt.Errorf("invalid frequency table size %d for nibble table", len(freq))
+	}
+
+	base := -1
+	for i := 0; i < 256; i++ {
+		if _, ok := freq[byte(i)]; ok {
+			base = i
+			break
+		}
+	}
+
+	var present uint16
+	var counts []byte
+	for char, count := range freq {
+		offset := int(char) - base
+		if offset > maxNibble {
+			return nil, fmt.Errorf("symbols span more than %d values", maxNibble+1)
+		}
+		if count < 0 || count > maxNibble {
+			return nil, fmt.Errorf("frequency %d does not fit in a nibble", count)
+		}
+		present |= 1 << offset
+	}
+	for offset := 0; offset <= maxNibble; offset++ {
+		if present&(1<<offset) != 0 {
+			counts = append(counts, byte(freq[byte(base+offset)]))
+		}
+	}
+
+	buf = append(buf, byte(base))
+	buf = binary.BigEndian.AppendUint16(buf, present)
+	for i := 0; i < len(counts); i += 2 {
+		b := counts[i] << 4
+		if i+1 < len(counts) {
+			b |= counts[i+1]
+		}
+		buf = append(buf, b)
+	}
+	return buf, nil
+}
+
+// readNibbles reads a model written by appendNibbles
+func readNibbles(br io.ByteReader) (FrequencyTable, error) {
+	var head [3]byte
+	for i := range head {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		head[i] = b
+	}
+	base := int(head[0])
+	present := binary.BigEndian.Uint16(head[1:])
+	if present == 0 {
+		return nil, fmt.Errorf("empty nibble table")
+	}
+
+	var symbols []byte
+	for offset := 0; offset <= maxNibble; offset++ {
+		if present&(1<<offset) == 0 {
+			continue
+		}
+		if base+offset > 255 {
+			return nil, fmt.Errorf("symbol 0x%02x+%d out of range", base, offset)
+		}
+		symbols = append(symbols, byte(base+offset))
+	}
+
+	if err := need(br, uint64(len(symbols)+1)/2, 1, "nibble count bytes"); err != nil {
+		return nil, err
+	}
+	freq := make(FrequencyTable, len(symbols))
+	var b byte
+	for i, char := range symbols {
+		if i%2 == 0 {
+			var err error
+			if b, err = br.ReadByte(); err != nil {
+				return nil, err
+			}
+			freq[char] = int(b >> 4)
+		} else {
+			freq[char] = int(b & 0x0F)
+		}
+	}
+	return freq, nil
+}
@@ -0,0 +1,160 @@
+package huffman
+
+import "hash"
+
+// Options configures CompressFileWithOptions. The zero value gives the same
+// output as CompressFile.
+type Options struct {
+	// Table selects how the Huffman model is stored in the header. The zero
+	// value, TableAuto, stores whichever encoding is smaller.
+	Table TableFormat
+
+	// PadTo appends zero bytes so the output size is a multiple of PadTo,
+	// for storage that prefers block-aligned files. Values of 0 and 1
+	// disable padding. The padding is skipped when decompressing.
+	PadTo int
+
+	// SampleEvery builds the model from every SampleEvery-th block of the
+	// input instead of every byte, as BuildFrequencyTableSampled does, which
+	// saves counting time. Values of 0 and 1 count the whole input. Only the
+	// counting is sampled: CompressFileWithOptions still reads the whole
+	// input, since every byte is encoded and a byte the sample missed must
+	// be added to the model before the header is written.
+	SampleEvery int
+
+	// Store writes the input uncompressed behind a header, for data that
+	// Huffman coding would only expand.
+	Store bool
+
+	// StoreIfLarger works out the exact size of the coded output before
+	// writing anything and writes a stored stream instead if the coded one
+	// would be larger than the stored one, header and padding included. It
+	// cannot be combined with Legacy or Checksum.
+	StoreIfLarger bool
+
+	// OmitSize leaves the original size out of the header; the decoder stops
+	// when the payload runs out. Input with a single distinct byte value
+	// still stores its size, since its codes take no bits.
+	OmitSize bool
+
+	// Legacy writes the unversioned layout read by earlier releases, for
+	// interoperability with them. It only holds inputs under 2GB with at
+	// most 255 distinct byte values, each occurring fewer than 65,536 times,
+	// and cannot be combined with Store, PadTo or OmitSize.
+	Legacy bool
+
+	// TopK limits the model to the TopK most frequent symbols plus an escape
+	// symbol for the rest; see BuildFrequencyTableTopK. Zero keeps every
+	// symbol.
+	TopK int
+
+	// Quantize stores counts scaled down to at most 255 by
+	// QuantizeFrequencies, and codes the data with the tree they give. This
+	// keeps the header small for large inputs, and lets the legacy format hold
+	// them.
+	Quantize bool
+
+	// DeltaBase stores the model as differences from a built-in base model,
+	// which makes for a much smaller header when the input resembles it. The
+	// counts are quantized as with Quantize to match the scale of the base.
+	// It selects TableDelta, so Table must be left at TableAuto.
+	DeltaBase BaseModel
+
+	// FoldCase codes ASCII letters in lowercase and stores which of them
+	// were uppercase as run lengths in the header. It can improve the ratio
+	// of text whose capitals cluster, and costs header space where they
+	// don't. The original case is restored exactly when decompressing.
+	FoldCase bool
+
+	// Remap codes the input's byte values by rank, most frequent first, so
+	// the model covers the contiguous range from 0 and its table is
+	// smaller, and stores the symbols in rank order in the header to map
+	// the output back. The list costs a byte per symbol, so the header only
+	// shrinks overall for scattered alphabets. It cannot be combined with
+	// Legacy, TopK, DeltaBase or FoldCase.
+	Remap bool
+
+	// Checksum stores a CRC-32 of the input in the header, which
+	// decompression checks the output against, returning
+	// ErrChecksumMismatch if they differ. It cannot be combined with
+	// Legacy, Store or StoreIfLarger.
+	Checksum bool
+
+	// Trailer ends the output with a fixed-size info trailer holding the
+	// format version, original size and CRC-32 of the input, which
+	// ReadTrailer reads by seeking to the end of the file. It cannot be
+	// combined with Legacy, Store, StoreIfLarger or PadTo.
+	Trailer bool
+
+	// VerifyAfterCompress decompresses the output in memory once it is
+	// written and compares it with the input. On a mismatch the output is
+	// removed, leaving any file that was already there, and
+	// ErrRoundTripFailed returned. It only applies to files.
+	VerifyAfterCompress bool
+
+	// RecordPayloadLength stores the length of the payload in the header
+	// when the stored model doesn't give it, as with a tree table, so
+	// QuickVerify can check the payload's length exactly rather than
+	// against a loose bound that misses a truncation of a few bytes. It
+	// costs a few header bytes, which TableAuto takes into account, and
+	// releases without QuickVerify can't read the output. It cannot be
+	// combined with Legacy.
+	RecordPayloadLength bool
+
+	// TwoLeafSingleSymbol codes input with a single distinct byte value with
+	// a two-leaf tree, adding a second symbol with a count of zero, instead
+	// of the special case where the lone symbol takes no bits. Decoding then
+	// follows the generic path, at the cost of a header entry and one bit per
+	// input byte.
+	TwoLeafSingleSymbol bool
+
+	// HashFunc, when set, makes a Writer from NewWriterWithOptions hash the
+	// uncompressed input as it is written, for Writer.Sum, so the original's
+	// hash doesn't need a second read of the source. Other functions ignore
+	// it.
+	HashFunc func() hash.Hash
+
+	// Progress, when set, is called as CompressFileWithOptions and
+	// CompressFileResultWithOptions work through the input. The file is
+	// read once and encoded once, so total is twice its size: done runs to
+	// the size while reading and on to total while encoding. done never
+	// decreases and the last call has done equal to total. An input whose
+	// size isn't known up front, such as a pipe or device, is reported with
+	// a total of -1 until it has been read. Other functions ignore it.
+	Progress func(done, total int64)
+
+	// Diagnostics, when set, collects the non-fatal issues of compressing a
+	// file, such as an input file that failed to close or output that is
+	// barely smaller than the input, instead of logging them.
+	Diagnostics *Diagnostics
+}
+
+// DecompressOptions configures DecompressFileWithOptions. The zero value
+// gives the same output as DecompressFile.
+type DecompressOptions struct {
+	// Sparse seeks past blocks of zeros in the output instead of writing
+	// them, leaving holes on filesystems that support sparse files. The file
+	// reads back the same either way.
+	Sparse bool
+
+	// UniformTiming decodes each code with a single lookup in a table of
+	// every code instead of walking the tree a bit at a time, so the work
+	// per symbol doesn't depend on the length of its code. This is
+	// best-effort hardening for decompressing secrets: it reduces the
+	// timing variation an observer could learn the data from but doesn't
+	// eliminate it, since memory access times and escaped literals still
+	// vary. Codes longer than 16 bits take one more lookup per 16 bits.
+	// The blocks of a block archive are decoded with the tree walk.
+	UniformTiming bool
+
+	// Strict fails with ErrTrailingData if anything but padding follows the
+	// last code of the payload, or the last record of a block or line
+	// archive, instead of ignoring it. Appended bytes otherwise go unnoticed
+	// once the recorded size has been decoded.
+	Strict bool
+
+	// Diagnostics, when set, collects the non-fatal issues of
+	// DecompressFileWithOptions, such as a file that failed to close or a
+	// partial output that couldn't be removed, instead of logging them.
+	Diagnostics *Diagnostics
+}
@@ -0,0 +1,73 @@
+package huffman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// outputFile is an output being written by an operation that may fail
+// partway. A new file is created at its path and removed on failure. A
+// regular file already at the path is left alone until the output is
+// complete: the output goes to a temporary file beside it, renamed over it on
+// success and removed on failure, so a failed call never destroys what the
+// caller had. Anything else already at the path, such as a device, is
+// truncated and written in place.
+type outputFile struct {
+	*os.File
+	path string
+	// remove reports whether the file written is removed on failure
+	remove bool
+	// rename reports whether the file written replaces path on success
+	rename bool
+}
+
+// createOutput opens the output file for path as described by outputFile
+func createOutput(path string) (*outputFile, error) {
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return nil, outputError(path, err)
+		}
+		return &outputFile{File: file, path: path, remove: true}, nil
+	case !info.Mode().IsRegular():
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, outputError(path, err)
+		}
+		return &outputFile{File: file, path: path}, nil
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, outputError(path, err)
+	}
+	out := &outputFile{File: file, path: path, remove: true, rename: true}
+	if err := file.Chmod(info.Mode().Perm()); err != nil {
+		return nil, out.finish(fmt.Errorf("failed to set output file mode: %w", err), nil)
+	}
+	return out, nil
+}
+
+// finish closes the output after an operation that ended with err. On success
+// the output takes its place at its path; on failure it is removed if it was
+// created for the call. It returns err, or the error closing or renaming the
+// output. diag collects a failure to remove it.
+func (o *outputFile) finish(err error, diag *Diagnostics) error {
+	if closeErr := o.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close output file: %w", closeErr)
+	}
+	if err == nil && o.rename {
+		if renameErr := os.Rename(o.Name(), o.path); renameErr != nil {
+			err = fmt.Errorf("failed to replace output file: %w", renameErr)
+		}
+	}
+	if err != nil && o.remove {
+		if removeErr := os.Remove(o.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+			diag.report(DiagRemoveError, "failed to remove output file: %v", removeErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package huffman
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOutputPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions don't restrict file creation on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	if err := os.WriteFile(inputPath, []byte("written to a read-only directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	readOnly := filepath.Join(tmpDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnly, 0755) })
+	// Privileged users such as root can write there anyway
+	if probe, err := os.Create(filepath.Join(readOnly, "probe")); err == nil {
+		probe.Close()
+		t.Skip("the read-only directory is writable by this user")
+	}
+
+	tests := []struct {
+		name string
+		run  func(outputPath string) error
+	}{
+		{"compress", func(outputPath string) error { return CompressFile(inputPath, outputPath) }},
+		{"decompress", func(outputPath string) error { return DecompressFile(compressedPath, outputPath) }},
+		{"sparse decompress", func(outputPath string) error {
+			return DecompressFileWithOptions(compressedPath, outputPath, DecompressOptions{Sparse: true})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(filepath.Join(readOnly, "output"))
+			if !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("Expected ErrPermissionDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOutputError(t *testing.T) {
+	err := outputError("out.huf", &fs.PathError{Op: "open", Path: "out.huf", Err: fs.ErrPermission})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Expected ErrPermissionDenied, got %v", err)
+	}
+	err = outputError("out.huf", &fs.PathError{Op: "open", Path: "out.huf", Err: fs.ErrNotExist})
+	if errors.Is(err, ErrPermissionDenied) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the original error for a missing directory, got %v", err)
+	}
+}
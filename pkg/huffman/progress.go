@@ -0,0 +1,107 @@
+package huffman
+
+import "io"
+
+// progressReader calls cb with the running byte count after every Read
+type progressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+	cb    func(read, total int64)
+}
+
+// NewProgressReader wraps r so that cb is called after each Read with the
+// cumulative number of bytes read and total, which the caller supplies, for
+// example from the input file's size; pass -1 if it is unknown. Wrap the
+// input to Compress or Decompress to report progress without changing them.
+func NewProgressReader(r io.Reader, total int64, cb func(read, total int64)) io.Reader {
+	return &progressReader{r: r, total: total, cb: cb}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+	p.cb(p.read, p.total)
+	return n, err
+}
+
+// progressChunk is the number of input bytes encoded between Options.Progress
+// calls
+const progressChunk = 64 * 1024
+
+// compressProgress maps the reading and encoding passes of a file
+// compression onto one count for Options.Progress, out of twice the file size.
+// The total is -1 while reading an input whose size isn't known up front.
+type compressProgress struct {
+	cb    func(done, total int64)
+	total int64
+	done  int64
+}
+
+// report passes done on to the callback, held to a known total and skipped
+// unless it is past the last value reported. A nil compressProgress reports
+// nothing.
+func (p *compressProgress) report(done int64) {
+	if p == nil {
+		return
+	}
+	if p.total >= 0 {
+		done = min(done, p.total)
+	}
+	if done <= p.done {
+		return
+	}
+	p.done = done
+	p.cb(done, p.total)
+}
+
+// reader wraps r, the size-byte input, to report the reading pass, setting
+// the total to twice size. A size of 0, as a pipe or device reports, leaves
+// the total unknown until read sets it. A nil compressProgress returns r as
+// it is.
+func (p *compressProgress) reader(r io.Reader, size int64) io.Reader {
+	if p == nil {
+		return r
+	}
+	p.total = 2 * size
+	if size <= 0 {
+		p.total = -1
+	}
+	return NewProgressReader(r, size, func(read, _ int64) {
+		p.report(read)
+	})
+}
+
+// read ends the reading pass of size bytes, setting the total if it wasn't
+// known and reporting the whole input read
+func (p *compressProgress) read(size int64) {
+	if p == nil {
+		return
+	}
+	if p.total < 0 {
+		// Report the read bytes again, now out of a known total
+		p.total = 2 * size
+		p.done = 0
+	}
+	p.report(size)
+}
+
+// encoded returns the callback for the encoding pass of size bytes read in
+// the first, or nil if there is nothing to report to
+func (p *compressProgress) encoded(size int64) func(encoded int64) {
+	if p == nil {
+		return nil
+	}
+	return func(encoded int64) {
+		p.report(size + encoded)
+	}
+}
+
+// finish reports the whole operation done, whether or not the file changed
+// size between the stat and the read or was stored without encoding
+func (p *compressProgress) finish() {
+	if p == nil {
+		return
+	}
+	p.report(p.total)
+}
@@ -0,0 +1,160 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestProgressReader(t *testing.T) {
+	data := blockTestData()
+
+	var calls int
+	var last, lastTotal int64
+	r := NewProgressReader(iotest.HalfReader(bytes.NewReader(data)), int64(len(data)), func(read, total int64) {
+		if read < last {
+			t.Errorf("Progress went backwards from %d to %d", last, read)
+		}
+		calls++
+		last, lastTotal = read, total
+	})
+
+	var compressed bytes.Buffer
+	if err := Compress(r, &compressed, Options{}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+
+	if last != int64(len(data)) {
+		t.Errorf("Expected final progress %d, got %d", len(data), last)
+	}
+	if lastTotal != int64(len(data)) {
+		t.Errorf("Expected total %d, got %d", len(data), lastTotal)
+	}
+	if calls < 2 {
+		t.Errorf("Expected a callback per Read, got %d calls", calls)
+	}
+
+	var decompressed bytes.Buffer
+	if err := Decompress(&compressed, &decompressed); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if !bytes.Equal(data, decompressed.Bytes()) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed.Bytes()))
+	}
+}
+
+func TestCompressFileProgress(t *testing.T) {
+	data := bytes.Repeat(blockTestData(), 20)
+	size := int64(len(data))
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"escaped", Options{TopK: 8}},
+		{"stored", Options{Store: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "input.txt")
+			if err := os.WriteFile(inputPath, data, 0644); err != nil {
+				t.Fatalf("Failed to write input: %v", err)
+			}
+
+			var done []int64
+			opts := tt.opts
+			opts.Progress = func(d, total int64) {
+				if total != 2*size {
+					t.Errorf("Expected total %d, got %d", 2*size, total)
+				}
+				if len(done) > 0 && d < done[len(done)-1] {
+					t.Errorf("Progress went backwards from %d to %d", done[len(done)-1], d)
+				}
+				done = append(done, d)
+			}
+			withProgress := filepath.Join(dir, "progress.huff")
+			if err := CompressFileWithOptions(inputPath, withProgress, opts); err != nil {
+				t.Fatalf("CompressFileWithOptions error: %v", err)
+			}
+
+			if len(done) == 0 || done[len(done)-1] != 2*size {
+				t.Fatalf("Expected progress to end at %d, got %v", 2*size, done)
+			}
+			if !tt.opts.Store {
+				encoding := 0
+				for _, d := range done {
+					if d > size && d < 2*size {
+						encoding++
+					}
+				}
+				if encoding == 0 {
+					t.Errorf("Expected progress reports during encoding, got %v", done)
+				}
+			}
+
+			// The callback must not change the output
+			without := filepath.Join(dir, "plain.huff")
+			if err := CompressFileWithOptions(inputPath, without, tt.opts); err != nil {
+				t.Fatalf("CompressFileWithOptions error: %v", err)
+			}
+			got, _ := os.ReadFile(withProgress)
+			want, _ := os.ReadFile(without)
+			if !bytes.Equal(got, want) {
+				t.Errorf("Output with Progress differs: %s", describeDiff(want, got))
+			}
+		})
+	}
+}
+
+func TestCompressFileProgressUnknownSize(t *testing.T) {
+	data := bytes.Repeat(blockTestData(), 20)
+	size := int64(len(data))
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	// A pipe, like a device, stats with a size of 0
+	openInput = func(string) (*os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			w.Write(data)
+			w.Close()
+		}()
+		return r, nil
+	}
+	defer func() { openInput = os.Open }()
+
+	type call struct{ done, total int64 }
+	var calls []call
+	opts := Options{Progress: func(done, total int64) {
+		calls = append(calls, call{done, total})
+	}}
+	if err := CompressFileWithOptions(inputPath, filepath.Join(dir, "output.huf"), opts); err != nil {
+		t.Fatalf("CompressFileWithOptions error: %v", err)
+	}
+
+	if len(calls) == 0 || calls[len(calls)-1] != (call{2 * size, 2 * size}) {
+		t.Fatalf("Expected progress to end at %d of %d, got %v", 2*size, 2*size, calls)
+	}
+	for i, c := range calls {
+		if c.total != -1 && c.total != 2*size {
+			t.Errorf("Call %d: expected total -1 or %d, got %d", i, 2*size, c.total)
+		}
+		if c.total == -1 && i > 0 && calls[i-1].total != -1 {
+			t.Errorf("Call %d: total became unknown again after %v", i, calls[i-1])
+		}
+		if i > 0 && c.done < calls[i-1].done {
+			t.Errorf("Progress went backwards from %d to %d", calls[i-1].done, c.done)
+		}
+	}
+}
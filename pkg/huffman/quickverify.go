@@ -0,0 +1,220 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// ErrPayloadSize is returned by QuickVerify when the payload's length doesn't
+// fit the size and model in the header, as when the file was truncated
+var ErrPayloadSize = errors.New("huffman: payload length does not match the header")
+
+// QuickVerify checks that the compressed file at path looks complete without
+// decoding it: that the header parses, that any trailers are present and
+// well-formed, and that the payload's length fits what the header declares.
+// It neither decodes the payload nor compares a stored checksum, so it is a
+// fast pre-flight for scanning many files rather than proof that one
+// decompresses; use Decompress for that.
+//
+// The length of a block or line archive must match its index exactly, and so
+// must a single stream's, from the payload length its header records or the
+// symbol counts of its model. Streams whose header records neither, as with
+// a tree table unless compressed with Options.RecordPayloadLength, and
+// streams written by NewModelWriter only get a loose bound: the shortest and
+// longest code times the original size, which misses a truncation of a few
+// bytes. Stored, encrypted and size-less streams only have their header
+// checked.
+func QuickVerify(path string) error {
+	if err := checkNotDirectory(path); err != nil {
+		return err
+	}
+
+	input, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	info, err := input.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat input file: %w", err)
+	}
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.Encrypted {
+		return nil
+	}
+	payloadStart, err := input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to find payload: %w", err)
+	}
+
+	length, err := payloadLength(input, header, payloadStart, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to read trailer: %w", err)
+	}
+
+	switch {
+	case header.Blocks != nil, header.Lines != nil:
+		index := header.Blocks
+		if index == nil {
+			index = header.Lines
+		}
+		var want int64
+		for _, entry := range index {
+			want += entry.CompressedSize
+		}
+		if length != want {
+			return fmt.Errorf("%s: %w: %d bytes, index records %d", path, ErrPayloadSize, length, want)
+		}
+		return nil
+	case header.Stored, header.NoSize:
+		return nil
+	}
+
+	// Every symbol takes at least a bit, which also keeps the products
+	// below in range
+	bits := length*8 - int64(header.PaddingBits)
+	if bits < header.OriginalSize {
+		return fmt.Errorf("%s: %w: %d bits can't hold %d bytes", path, ErrPayloadSize, max(bits, 0), header.OriginalSize)
+	}
+	minBits, maxBits, err := payloadBits(header)
+	if err != nil {
+		return err
+	}
+	if bits < minBits || bits > maxBits {
+		if minBits == maxBits {
+			return fmt.Errorf("%s: %w: %d bits, header implies %d", path, ErrPayloadSize, bits, minBits)
+		}
+		return fmt.Errorf("%s: %w: %d bits, header implies %d to %d", path, ErrPayloadSize, bits, minBits, maxBits)
+	}
+	return nil
+}
+
+// payloadLength returns the length of the payload from payloadStart to
+// fileSize in f once the trailers h declares are stripped. Only the trailers
+// are read, from the end of the file; a size trailer fills in h's size and
+// padding like splitTrailer.
+func payloadLength(f io.ReaderAt, h *Header, payloadStart, fileSize int64) (int64, error) {
+	payloadLen := fileSize - payloadStart
+	tailLen := int64(infoTrailerSize + 4 + trailerSize)
+	if h.Aligned {
+		// The alignment length sits just before any info trailer
+		end := fileSize
+		if h.InfoTrailer {
+			end -= infoTrailerSize
+		}
+		var padLen [4]byte
+		if end-4 >= payloadStart {
+			if _, err := f.ReadAt(padLen[:], end-4); err != nil {
+				return 0, err
+			}
+		}
+		tailLen = infoTrailerSize + int64(binary.BigEndian.Uint32(padLen[:])) + trailerSize
+	}
+	tailLen = min(tailLen, payloadLen)
+
+	tail := make([]byte, tailLen)
+	if _, err := f.ReadAt(tail, fileSize-tailLen); err != nil {
+		return 0, err
+	}
+	rest, err := splitTrailer(h, tail)
+	if err != nil {
+		return 0, err
+	}
+	return payloadLen - (tailLen - int64(len(rest))), nil
+}
+
+// payloadBits returns the least and greatest number of bits the payload
+// described by h can take
+func payloadBits(h *Header) (int64, int64, error) {
+	if h.PayloadBits > 0 {
+		return h.PayloadBits, h.PayloadBits, nil
+	}
+	if h.ExternalCodes {
+		return h.OriginalSize, math.MaxInt64, nil
+	}
+	if exact, ok := h.modelBits(); ok {
+		return exact, exact, nil
+	}
+
+	root := h.Root()
+	if root == nil {
+		return 0, 0, fmt.Errorf("failed to build huffman tree")
+	}
+	shortest, longest := int64(math.MaxInt64), int64(0)
+	for char, code := range GenerateCodeTable(root) {
+		cost := int64(len(code))
+		if h.Escaped && char == h.Escape {
+			cost += 8
+		}
+		shortest = min(shortest, cost)
+		longest = max(longest, cost)
+	}
+	return shortest * h.OriginalSize, longest * h.OriginalSize, nil
+}
+
+// modelBits returns the length in bits of the payload h describes as its
+// stored counts give it. It reports false when the header stores no counts,
+// as with a tree table, or when they don't add up to the original size, as
+// with a sampled, quantized or base model.
+func (h *Header) modelBits() (int64, bool) {
+	if h.Table == TableTree || h.Freq == nil {
+		return 0, false
+	}
+	root := h.Root()
+	if root == nil {
+		return 0, false
+	}
+
+	codes := GenerateCodeTable(root)
+	var total, bits int64
+	for char, count := range h.Freq {
+		cost := int64(len(codes[char]))
+		if h.Escaped && char == h.Escape {
+			cost += 8
+		}
+		total += int64(count)
+		bits += int64(count) * cost
+	}
+	return bits, total == h.OriginalSize
+}
+
+// recordPayloadBits sets PayloadBits to bits, the length of the payload, when
+// a reader couldn't work it out from the model, so the stream can be checked
+// exactly by QuickVerify. With auto set it first picks the table format that
+// makes the whole header shortest, as the recorded length costs bytes with
+// some formats and not others.
+func (h *Header) recordPayloadBits(bits int64, auto bool) {
+	if h.NoSize {
+		return
+	}
+	if auto {
+		best := -1
+		for _, format := range tableFormats {
+			trial := *h
+			trial.Table = format
+			trial.recordPayloadBits(bits, false)
+			buf, err := appendHeader(nil, &trial)
+			if err == nil && (best < 0 || len(buf) < best) {
+				best, h.Table = len(buf), format
+			}
+		}
+	}
+	if exact, ok := h.modelBits(); ok && exact == bits {
+		return
+	}
+	h.PayloadBits = bits
+}
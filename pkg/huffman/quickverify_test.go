@@ -0,0 +1,186 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuickVerify(t *testing.T) {
+	data := blockTestData()
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"frequencies", Options{Table: TableFrequencies}},
+		{"tree", Options{Table: TableTree}},
+		{"escaped", Options{TopK: 8}},
+		{"checksum", Options{Checksum: true}},
+		{"info trailer", Options{Trailer: true}},
+		{"aligned", Options{PadTo: 4096}},
+		{"stored", Options{Store: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), tt.opts); err != nil {
+				t.Fatalf("writeCompressed error: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "good.huf")
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := QuickVerify(path); err != nil {
+				t.Errorf("QuickVerify error on a good file: %v", err)
+			}
+		})
+	}
+
+	t.Run("block archive", func(t *testing.T) {
+		path := writeBlockArchive(t, data, ParallelOptions{BlockSize: 1024})
+		if err := QuickVerify(path); err != nil {
+			t.Errorf("QuickVerify error on a good file: %v", err)
+		}
+	})
+}
+
+func TestQuickVerifyTruncated(t *testing.T) {
+	data := blockTestData()
+	random := make([]byte, 9000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tmpDir := t.TempDir()
+	compressFile := func(name string, input []byte, opts Options) []byte {
+		inputPath := filepath.Join(tmpDir, name+".txt")
+		outputPath := filepath.Join(tmpDir, name+".huf")
+		if err := os.WriteFile(inputPath, input, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := CompressFileWithOptions(inputPath, outputPath, opts); err != nil {
+			t.Fatalf("CompressFileWithOptions error: %v", err)
+		}
+		compressed, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compressed
+	}
+	single := func(opts Options) []byte {
+		var buf bytes.Buffer
+		if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), opts); err != nil {
+			t.Fatalf("writeCompressed error: %v", err)
+		}
+		return buf.Bytes()
+	}
+	archive, err := os.ReadFile(writeBlockArchive(t, data, ParallelOptions{BlockSize: 1024}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cutting a single byte must be caught whatever the model: with
+	// RecordPayloadLength, tree tables and inexact counts record the payload
+	// length instead
+	tests := []struct {
+		name       string
+		compressed []byte
+		cut        int
+	}{
+		{"default", compressFile("default", data, Options{RecordPayloadLength: true}), 1},
+		{"frequencies", single(Options{Table: TableFrequencies}), 1},
+		{"tree", single(Options{Table: TableTree, RecordPayloadLength: true}), 1},
+		{"half the payload", single(Options{}), len(data) / 4},
+		{"escaped", compressFile("escaped", data, Options{TopK: 8, RecordPayloadLength: true}), 1},
+		{"quantized", compressFile("quantized", data, Options{Quantize: true, RecordPayloadLength: true}), 1},
+		{"sampled", compressFile("sampled", data, Options{SampleEvery: 4, RecordPayloadLength: true}), 1},
+		{"case-folded", compressFile("folded", data, Options{FoldCase: true, RecordPayloadLength: true}), 1},
+		{"remapped", compressFile("remapped", data, Options{Remap: true, RecordPayloadLength: true}), 1},
+		{"random", compressFile("random", random, Options{RecordPayloadLength: true}), 1},
+		{"block archive", archive, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "truncated.huf")
+			if err := os.WriteFile(path, tt.compressed[:len(tt.compressed)-tt.cut], 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := QuickVerify(path); !errors.Is(err, ErrPayloadSize) {
+				t.Errorf("Expected ErrPayloadSize, got %v", err)
+			}
+		})
+	}
+
+	// A missing trailer is caught while reading it
+	path := filepath.Join(t.TempDir(), "trailer.huf")
+	compressed := single(Options{Trailer: true})
+	if err := os.WriteFile(path, compressed[:len(compressed)-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := QuickVerify(path); err == nil {
+		t.Error("Expected an error for a truncated trailer")
+	}
+}
+
+func TestRecordPayloadLength(t *testing.T) {
+	compress := func(data []byte, opts Options) []byte {
+		var buf bytes.Buffer
+		if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), opts); err != nil {
+			return nil
+		}
+		return buf.Bytes()
+	}
+
+	// Without the option the header stays readable by earlier releases
+	header, err := ParseHeader(bytes.NewReader(compress(blockTestData(), Options{Table: TableTree})))
+	if err != nil {
+		t.Fatalf("ParseHeader error: %v", err)
+	}
+	if header.PayloadBits != 0 {
+		t.Errorf("Expected no payload length by default, got %d bits", header.PayloadBits)
+	}
+
+	// TableAuto picks the shortest output once the length is recorded. For
+	// the short input the tree table is smallest on its own, but a
+	// frequency list needs no recorded length.
+	for _, data := range [][]byte{blockTestData(), []byte(strings.Repeat("abbab", 10))} {
+		auto := compress(data, Options{RecordPayloadLength: true})
+		for _, table := range tableFormats {
+			forced := compress(data, Options{Table: table, RecordPayloadLength: true})
+			if forced != nil && len(forced) < len(auto) {
+				t.Errorf("%d-byte input: TableAuto wrote %d bytes, %v only %d", len(data), len(auto), table, len(forced))
+			}
+		}
+	}
+
+	if _, err := planCompressed([]byte("x"), FrequencyTable{'x': 1}, Options{Legacy: true, RecordPayloadLength: true}, 0); err == nil {
+		t.Error("Expected an error combining RecordPayloadLength with Legacy")
+	}
+}
+
+func TestQuickVerifySkipsChecksum(t *testing.T) {
+	data := blockTestData()
+	var buf bytes.Buffer
+	if err := writeCompressed(&buf, data, BuildFrequencyTableFromData(data), Options{Checksum: true}); err != nil {
+		t.Fatalf("writeCompressed error: %v", err)
+	}
+	compressed := buf.Bytes()
+	compressed[len(compressed)-2] ^= 0xFF
+
+	path := filepath.Join(t.TempDir(), "corrupt.huf")
+	if err := os.WriteFile(path, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := QuickVerify(path); err != nil {
+		t.Errorf("Expected QuickVerify to pass a corrupt payload of the right length, got %v", err)
+	}
+	if err := DecompressFile(path, filepath.Join(t.TempDir(), "out")); err == nil {
+		t.Error("Expected DecompressFile to catch the corruption")
+	}
+}
@@ -0,0 +1,88 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// DecompressLimited decompresses a file to w at no more than bytesPerSec on
+// average, for slow or metered sinks such as a network connection. Output
+// passes through a token bucket holding a tenth of a second's worth of bytes,
+// so short bursts go straight through and the decoder sleeps, rather than
+// spins, while the bucket refills.
+func DecompressLimited(inputPath string, w io.Writer, bytesPerSec int) error {
+	if bytesPerSec <= 0 {
+		return fmt.Errorf("invalid rate %d bytes per second", bytesPerSec)
+	}
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	return decompress(input, newRateWriter(w, bytesPerSec), DecompressOptions{})
+}
+
+// rateWriter limits the rate of writes to w with a token bucket
+type rateWriter struct {
+	w      io.Writer
+	rate   float64 // tokens added per second
+	burst  int     // bucket capacity, and the largest write passed on at once
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+}
+
+// newRateWriter returns a rateWriter with a full bucket
+func newRateWriter(w io.Writer, bytesPerSec int) *rateWriter {
+	burst := max(bytesPerSec/10, 1)
+	return &rateWriter{
+		w:      w,
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (rw *rateWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), rw.burst)]
+		rw.take(len(chunk))
+		n, err := rw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// take removes n tokens from the bucket, sleeping until enough have
+// accumulated
+func (rw *rateWriter) take(n int) {
+	now := time.Now()
+	rw.tokens = min(float64(rw.burst), rw.tokens+now.Sub(rw.last).Seconds()*rw.rate)
+	rw.last = now
+
+	if deficit := float64(n) - rw.tokens; deficit > 0 {
+		time.Sleep(time.Duration(deficit / rw.rate * float64(time.Second)))
+		rw.tokens = 0
+		rw.last = time.Now()
+		return
+	}
+	rw.tokens -= float64(n)
+}
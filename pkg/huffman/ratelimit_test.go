@@ -0,0 +1,43 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecompressLimited(t *testing.T) {
+	data := bytes.Repeat([]byte("rate limited output "), 1500)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("CompressFile error: %v", err)
+	}
+
+	// The bucket starts with a tenth of a second's worth of bytes, and the
+	// rest must wait for it to refill
+	const rate = 100000
+	minimum := time.Duration(float64(len(data)-rate/10) / rate * float64(time.Second))
+
+	var out bytes.Buffer
+	start := time.Now()
+	if err := DecompressLimited(compressedPath, &out, rate); err != nil {
+		t.Fatalf("DecompressLimited error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < minimum {
+		t.Errorf("Expected decompressing %d bytes at %d B/s to take at least %v, took %v", len(data), rate, minimum, elapsed)
+	}
+	if !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, out.Bytes()))
+	}
+
+	if err := DecompressLimited(compressedPath, &out, 0); err == nil {
+		t.Error("Expected an error for a zero rate")
+	}
+}
@@ -0,0 +1,121 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// CompressFixedRecords compresses an array of fixed-width records, such as
+// telemetry structs, column-first: byte i of every record is gathered into
+// column i, and each column is coded with its own model. A single model would
+// gain nothing from the transposition, since Huffman coding ignores the order
+// of the bytes, but a column holding one byte of one field is usually far
+// more skewed than the input as a whole. The output is a block archive with
+// one block per column, flagged as a record archive with the record size
+// after the index. The length of data must be a multiple of recordSize. The
+// output decodes with DecompressFixedRecords, or with Decompress and the
+// other whole-file decoders, which transpose the columns back.
+func CompressFixedRecords(data []byte, recordSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty input")
+	}
+	if recordSize <= 0 {
+		return nil, fmt.Errorf("invalid record size %d", recordSize)
+	}
+	if len(data)%recordSize != 0 {
+		return nil, fmt.Errorf("input length %d is not a multiple of the record size %d", len(data), recordSize)
+	}
+
+	records := len(data) / recordSize
+	columns := transposeRecords(data, recordSize)
+	header := &Header{Version: formatVersion, OriginalSize: int64(len(data)), RecordSize: recordSize}
+	var blocks bytes.Buffer
+	for c := 0; c < recordSize; c++ {
+		column := columns[c*records : (c+1)*records]
+		start := blocks.Len()
+		if err := writeCompressed(&blocks, column, BuildFrequencyTableFromData(column), Options{}); err != nil {
+			return nil, fmt.Errorf("failed to compress column %d: %w", c, err)
+		}
+		header.Blocks = append(header.Blocks, BlockInfo{
+			OriginalSize:   int64(records),
+			CompressedSize: int64(blocks.Len() - start),
+		})
+	}
+
+	out, err := appendHeader(nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return append(out, blocks.Bytes()...), nil
+}
+
+// DecompressFixedRecords decodes data written by CompressFixedRecords. Other
+// block archives are rejected.
+func DecompressFixedRecords(compressed []byte) ([]byte, error) {
+	r := bytes.NewReader(compressed)
+	header, err := ParseHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header.RecordSize == 0 {
+		return nil, fmt.Errorf("data is not a record archive")
+	}
+
+	var out bytes.Buffer
+	if err := decodeBlocks(r, header, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decodeRecords decodes the columns of a record archive from r and writes
+// the records they make up to w
+func decodeRecords(r io.Reader, h *Header, w io.Writer) error {
+	var columns bytes.Buffer
+	for i, block := range h.Blocks {
+		decoded, err := readBlock(r, block)
+		if err != nil {
+			return fmt.Errorf("failed to decode column %d: %w", i, err)
+		}
+		columns.Write(decoded)
+	}
+
+	// Transposing the columns back is the transpose with the record count as
+	// the record size
+	_, err := w.Write(transposeRecords(columns.Bytes(), int(h.Blocks[0].OriginalSize)))
+	return err
+}
+
+// readRecordSize parses the record size of a record archive, which must match
+// its blocks: one column of equal length per byte of a record
+func readRecordSize(br io.ByteReader, blocks []BlockInfo) (int, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 || size != uint64(len(blocks)) {
+		return 0, fmt.Errorf("record size %d doesn't match %d columns", size, len(blocks))
+	}
+	for c, block := range blocks {
+		if block.OriginalSize != blocks[0].OriginalSize || block.OriginalSize == 0 {
+			return 0, fmt.Errorf("column %d has %d records, column 0 has %d", c, block.OriginalSize, blocks[0].OriginalSize)
+		}
+	}
+	return int(size), nil
+}
+
+// transposeRecords returns data, as rows of recordSize bytes, in column-major
+// order
+func transposeRecords(data []byte, recordSize int) []byte {
+	records := len(data) / recordSize
+	out := make([]byte, len(data))
+	for r := 0; r < records; r++ {
+		row := data[r*recordSize : (r+1)*recordSize]
+		for c, b := range row {
+			out[c*records+r] = b
+		}
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// telemetryRecords returns n 16-byte records of a timestamp, a sensor ID, a
+// slowly drifting reading and a status byte
+func telemetryRecords(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	var data []byte
+	reading := int32(20000)
+	for i := 0; i < n; i++ {
+		reading += int32(rng.Intn(21) - 10)
+		data = binary.BigEndian.AppendUint64(data, uint64(1_700_000_000+i))
+		data = binary.BigEndian.AppendUint16(data, uint16(rng.Intn(4)))
+		data = binary.BigEndian.AppendUint32(data, uint32(reading))
+		data = append(data, byte(rng.Intn(2)), 0)
+	}
+	return data
+}
+
+func TestFixedRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		recordSize int
+	}{
+		{"telemetry", telemetryRecords(2000), 16},
+		{"one record", telemetryRecords(1), 16},
+		{"one-byte records", []byte("abcabcabc"), 1},
+		{"one column", []byte("abcabcabc"), 9},
+		{"text", blockTestData()[:9999], 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := CompressFixedRecords(tt.data, tt.recordSize)
+			if err != nil {
+				t.Fatalf("CompressFixedRecords failed: %v", err)
+			}
+			decompressed, err := DecompressFixedRecords(compressed)
+			if err != nil {
+				t.Fatalf("DecompressFixedRecords failed: %v", err)
+			}
+			if !bytes.Equal(tt.data, decompressed) {
+				t.Errorf("Round trip doesn't match original: %s", describeDiff(tt.data, decompressed))
+			}
+		})
+	}
+
+	// Column-first coding should beat coding the records as they are
+	data := telemetryRecords(2000)
+	columns, err := CompressFixedRecords(data, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows bytes.Buffer
+	if err := writeCompressed(&rows, data, BuildFrequencyTableFromData(data), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d bytes column-first, %d as is, from %d", len(columns), rows.Len(), len(data))
+	if len(columns) >= rows.Len()*3/4 {
+		t.Errorf("Expected column-first to be much smaller, got %d bytes against %d", len(columns), rows.Len())
+	}
+
+	if _, err := CompressFixedRecords(data[:100], 16); err == nil {
+		t.Error("Expected an error for a length that isn't a multiple of the record size")
+	}
+	if _, err := CompressFixedRecords(data, 0); err == nil {
+		t.Error("Expected an error for a record size of 0")
+	}
+}
+
+func TestFixedRecordsGenericDecoders(t *testing.T) {
+	data := telemetryRecords(50)
+	compressed, err := CompressFixedRecords(data, 16)
+	if err != nil {
+		t.Fatalf("CompressFixedRecords failed: %v", err)
+	}
+	tmpDir := t.TempDir()
+	compressedPath := filepath.Join(tmpDir, "records.huf")
+	if err := os.WriteFile(compressedPath, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The whole-file decoders must give back the records, not the columns
+	decoders := []struct {
+		name   string
+		decode func() ([]byte, error)
+	}{
+		{"DecompressFile", func() ([]byte, error) {
+			outputPath := filepath.Join(tmpDir, "records.out")
+			if err := DecompressFile(compressedPath, outputPath); err != nil {
+				return nil, err
+			}
+			return os.ReadFile(outputPath)
+		}},
+		{"Decompress", func() ([]byte, error) {
+			var out bytes.Buffer
+			err := Decompress(bytes.NewReader(compressed), &out)
+			return out.Bytes(), err
+		}},
+		{"DecompressEntry", func() ([]byte, error) {
+			var out bytes.Buffer
+			err := DecompressEntry(bytes.NewReader(compressed), &out)
+			return out.Bytes(), err
+		}},
+		{"DecompressParallelTo", func() ([]byte, error) {
+			var out bytes.Buffer
+			err := DecompressParallelTo(compressedPath, &out, 4)
+			return out.Bytes(), err
+		}},
+	}
+	for _, d := range decoders {
+		t.Run(d.name, func(t *testing.T) {
+			got, err := d.decode()
+			if err != nil {
+				t.Fatalf("%s error: %v", d.name, err)
+			}
+			if !bytes.Equal(data, got) {
+				t.Errorf("%s output doesn't match the records: %s", d.name, describeDiff(data, got))
+			}
+		})
+	}
+
+	var head bytes.Buffer
+	if err := DecompressHead(compressedPath, 20, &head); err != nil {
+		t.Fatalf("DecompressHead error: %v", err)
+	}
+	if !bytes.Equal(data[:20], head.Bytes()) {
+		t.Errorf("DecompressHead output doesn't match: %s", describeDiff(data[:20], head.Bytes()))
+	}
+
+	// Block-level readers would hand out columns
+	if _, err := NewReader(bytes.NewReader(compressed)); err == nil {
+		t.Error("Expected NewReader to reject a record archive")
+	}
+	if _, err := OpenArchive(bytes.NewReader(compressed), int64(len(compressed))); err == nil {
+		t.Error("Expected OpenArchive to reject a record archive")
+	}
+}
+
+func TestDecompressFixedRecordsRejectsBlockArchives(t *testing.T) {
+	// Equal-sized blocks look like columns but aren't marked as records
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	archive, err := os.ReadFile(writeBlockArchive(t, data, ParallelOptions{BlockSize: 256}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecompressFixedRecords(archive); err == nil {
+		t.Error("Expected an error for a block archive without a record size")
+	}
+}
@@ -0,0 +1,69 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// remapBytes ranks the symbols of freq by count, most frequent first, and
+// replaces each byte of data with its rank, so the coded alphabet is the
+// contiguous range from 0. It returns the remapped data and counts, and the
+// symbols in rank order, which is the header's Remap.
+func remapBytes(data []byte, freq FrequencyTable) ([]byte, FrequencyTable, []byte) {
+	symbols := make([]byte, 0, len(freq))
+	for char := range freq {
+		symbols = append(symbols, char)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if freq[symbols[i]] != freq[symbols[j]] {
+			return freq[symbols[i]] > freq[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+
+	var rank [256]byte
+	remapped := make(FrequencyTable, len(freq))
+	for i, char := range symbols {
+		rank[char] = byte(i)
+		remapped[byte(i)] = freq[char]
+	}
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = rank[b]
+	}
+	return out, remapped, symbols
+}
+
+// remapTable returns the table a decoder maps coded bytes back through: the
+// symbols of remap for the ranks they cover, and identity for the rest, which
+// a valid stream never codes
+func remapTable(remap []byte) *[256]byte {
+	var table [256]byte
+	for i := range table {
+		table[i] = byte(i)
+	}
+	copy(table[:], remap)
+	return &table
+}
+
+// readRemap parses the symbol count and symbols of a remapped header
+func readRemap(br byteReadReader) ([]byte, error) {
+	count, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	remap := make([]byte, int(count)+1)
+	if _, err := io.ReadFull(br, remap); err != nil {
+		return nil, err
+	}
+
+	var seen [256]bool
+	for _, char := range remap {
+		if seen[char] {
+			return nil, fmt.Errorf("remapped symbol %s appears twice", formatByte(char))
+		}
+		seen[char] = true
+	}
+	return remap, nil
+}
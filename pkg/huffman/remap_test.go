@@ -0,0 +1,84 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestRemap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	// A few byte values spread over the whole range
+	scattered := make([]byte, 4096)
+	for i := range scattered {
+		scattered[i] = byte(rng.Intn(12)*rng.Intn(12)) * 37
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+	}{
+		{"text", blockTestData(), Options{}},
+		{"scattered", scattered, Options{}},
+		{"single symbol", bytes.Repeat([]byte{'z'}, 100), Options{}},
+		{"single symbol two leaves", bytes.Repeat([]byte{'z'}, 100), Options{TwoLeafSingleSymbol: true}},
+		{"checksum", blockTestData(), Options{Checksum: true}},
+		{"tree table", scattered, Options{Table: TableTree}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freq := BuildFrequencyTableFromData(tt.data)
+			var plain bytes.Buffer
+			if err := writeCompressed(&plain, tt.data, freq, tt.opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+			opts := tt.opts
+			opts.Remap = true
+			var remapped bytes.Buffer
+			if err := writeCompressed(&remapped, tt.data, freq, opts); err != nil {
+				t.Fatalf("Compression with Remap failed: %v", err)
+			}
+			t.Logf("%d bytes without remapping, %d with", plain.Len(), remapped.Len())
+
+			header, err := ParseHeader(bytes.NewReader(remapped.Bytes()))
+			if err != nil {
+				t.Fatalf("ParseHeader failed: %v", err)
+			}
+			if len(header.Remap) != len(freq) {
+				t.Errorf("Expected %d remapped symbols, got %d", len(freq), len(header.Remap))
+			}
+
+			for _, uniform := range []bool{false, true} {
+				var out bytes.Buffer
+				err := decompress(bytes.NewReader(remapped.Bytes()), &out, DecompressOptions{UniformTiming: uniform})
+				if err != nil {
+					t.Fatalf("Decompression failed: %v", err)
+				}
+				if !bytes.Equal(tt.data, out.Bytes()) {
+					t.Errorf("Output doesn't match original: %s", describeDiff(tt.data, out.Bytes()))
+				}
+			}
+		})
+	}
+
+	// Remapping makes a scattered alphabet contiguous, which the symbol
+	// runs table stores in one run
+	var plain, remapped bytes.Buffer
+	freq := BuildFrequencyTableFromData(scattered)
+	if err := writeCompressed(&plain, scattered, freq, Options{Table: TableRanges}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCompressed(&remapped, scattered, freq, Options{Table: TableRanges, Remap: true}); err != nil {
+		t.Fatal(err)
+	}
+	if remapped.Len() >= plain.Len() {
+		t.Errorf("Expected remapping to shrink the scattered stream, got %d bytes against %d", remapped.Len(), plain.Len())
+	}
+
+	if err := writeCompressed(&plain, scattered, freq, Options{Remap: true, FoldCase: true}); err == nil {
+		t.Error("Expected an error combining Remap with FoldCase")
+	}
+}
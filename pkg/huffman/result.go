@@ -0,0 +1,85 @@
+package huffman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Result describes a finished compression
+type Result struct {
+	// OriginalSize is the size of the input in bytes
+	OriginalSize int64
+	// CompressedSize is the size of the output in bytes, header included
+	CompressedSize int64
+	// Ratio is CompressedSize divided by OriginalSize
+	Ratio float64
+	// DistinctSymbols is the number of different byte values in the input
+	DistinctSymbols int
+	// TheoreticalMinBytes is the entropy floor of the payload for the model
+	// the input was coded with; see TheoreticalMinBytes
+	TheoreticalMinBytes float64
+	// Duration is how long the compression took
+	Duration time.Duration
+
+	// InputPath and OutputPath are the files compressed from and to
+	InputPath  string
+	OutputPath string
+	// FormatVersion is the version of the format written, 0 for legacy
+	FormatVersion int
+	// SHA256 is the hex SHA-256 digest of the input
+	SHA256 string
+}
+
+// CompressFileResult compresses a file like CompressFile and reports the sizes
+// involved, so callers don't have to stat the files afterwards
+func CompressFileResult(inputPath, outputPath string) (Result, error) {
+	return CompressFileResultWithOptions(inputPath, outputPath, Options{})
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// manifest is the JSON form of a Result written by WriteManifest
+type manifest struct {
+	InputPath       string  `json:"input_path"`
+	OutputPath      string  `json:"output_path"`
+	OriginalSize    int64   `json:"original_size"`
+	CompressedSize  int64   `json:"compressed_size"`
+	Ratio           float64 `json:"ratio"`
+	DistinctSymbols int     `json:"distinct_symbols"`
+	FormatVersion   int     `json:"format_version"`
+	SHA256          string  `json:"sha256"`
+}
+
+// WriteManifest writes result as an indented JSON manifest, so a pipeline can
+// record what it compressed and verify the output later
+func WriteManifest(w io.Writer, result Result) error {
+	data, err := json.MarshalIndent(manifest{
+		InputPath:       result.InputPath,
+		OutputPath:      result.OutputPath,
+		OriginalSize:    result.OriginalSize,
+		CompressedSize:  result.CompressedSize,
+		Ratio:           result.Ratio,
+		DistinctSymbols: result.DistinctSymbols,
+		FormatVersion:   result.FormatVersion,
+		SHA256:          result.SHA256,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
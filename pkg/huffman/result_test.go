@@ -0,0 +1,94 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressFileResult(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	outputPath := filepath.Join(tmpDir, "output.huf")
+
+	data := []byte("this is an example of a huffman tree")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	result, err := CompressFileResult(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("CompressFileResult error: %v", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output file: %v", err)
+	}
+
+	distinct := make(map[byte]bool)
+	for _, b := range data {
+		distinct[b] = true
+	}
+
+	if result.OriginalSize != int64(len(data)) {
+		t.Errorf("Expected OriginalSize %d, got %d", len(data), result.OriginalSize)
+	}
+	if result.CompressedSize != info.Size() {
+		t.Errorf("Expected CompressedSize %d, got %d", info.Size(), result.CompressedSize)
+	}
+	if want := float64(info.Size()) / float64(len(data)); result.Ratio != want {
+		t.Errorf("Expected Ratio %f, got %f", want, result.Ratio)
+	}
+	if result.DistinctSymbols != len(distinct) {
+		t.Errorf("Expected DistinctSymbols %d, got %d", len(distinct), result.DistinctSymbols)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Expected a positive Duration, got %v", result.Duration)
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	outputPath := filepath.Join(tmpDir, "output.huf")
+	if err := os.WriteFile(inputPath, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	result, err := CompressFileResult(inputPath, outputPath)
+	if err != nil {
+		t.Fatalf("CompressFileResult error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, result); err != nil {
+		t.Fatalf("WriteManifest error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	expected := map[string]any{
+		"input_path":       inputPath,
+		"output_path":      outputPath,
+		"original_size":    float64(5),
+		"compressed_size":  float64(result.CompressedSize),
+		"ratio":            result.Ratio,
+		"distinct_symbols": float64(4),
+		"format_version":   float64(1),
+		"sha256":           "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	for key, want := range expected {
+		if got[key] != want {
+			t.Errorf("Expected %s = %v, got %v", key, want, got[key])
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d fields, got %d: %v", len(expected), len(got), got)
+	}
+}
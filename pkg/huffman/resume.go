@@ -0,0 +1,272 @@
+package huffman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+)
+
+// checkpointEvery is the number of output bytes DecompressResume writes
+// between checkpoints
+var checkpointEvery int64 = 1 << 20
+
+// checkpointHook lets tests interrupt DecompressResume after a checkpoint is
+// written by returning an error
+var checkpointHook func() error
+
+// checkpoint records how far DecompressResume got: the decoder's position in
+// the payload and in the tree, and how much output it had written by then
+type checkpoint struct {
+	// InputSize guards against resuming with a different input file
+	InputSize int64 `json:"input_size"`
+	// BitOffset is the index of the next payload bit to decode
+	BitOffset int64 `json:"bit_offset"`
+	// Written is the number of output bytes the bits before BitOffset
+	// decoded to
+	Written int64 `json:"written"`
+	// Path leads from the root of the tree to the node the decoder was at,
+	// as '0' for left and '1' for right. It is empty between codes.
+	Path string `json:"path"`
+}
+
+// DecompressResume decompresses inputPath to outputPath like DecompressFile,
+// recording a checkpoint in checkpointPath every megabyte of output. If
+// checkpointPath already holds a checkpoint from an interrupted run, the
+// output is cut back to the length it records and decoding resumes from the
+// recorded bit of the payload, without decoding what came before. The
+// checkpoint is removed once the output is complete.
+//
+// Only single Huffman streams can be resumed; block and line archives,
+// stored, case-folded, encrypted and externally coded streams can't.
+func DecompressResume(inputPath, outputPath, checkpointPath string) error {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	info, err := input.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat input file: %w", err)
+	}
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	switch {
+	case header.Encrypted:
+		return ErrEncrypted
+	case header.Blocks != nil, header.Lines != nil, header.Stored, header.ExternalCodes, header.CaseRuns != nil:
+		return fmt.Errorf("only single Huffman streams can be resumed")
+	}
+	tree := header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+	payloadStart, err := input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to find payload: %w", err)
+	}
+
+	cp, err := readCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+	if cp != nil && cp.InputSize != info.Size() {
+		return fmt.Errorf("checkpoint was recorded for a %d-byte input, not %d bytes", cp.InputSize, info.Size())
+	}
+
+	var output *os.File
+	if cp == nil {
+		cp = &checkpoint{InputSize: info.Size()}
+		output, err = os.Create(outputPath)
+	} else {
+		output, err = os.OpenFile(outputPath, os.O_RDWR, 0)
+	}
+	if err != nil {
+		return outputError(outputPath, err)
+	}
+	defer func(output *os.File) {
+		err := output.Close()
+		if err != nil {
+			log.Printf("failed to close output file: %v", err)
+		}
+	}(output)
+
+	// Bytes written after the checkpoint are decoded again
+	crc := crc32.NewIEEE()
+	if cp.Written > 0 {
+		if n, err := io.CopyN(crc, output, cp.Written); err != nil {
+			return fmt.Errorf("output has %d of the %d bytes the checkpoint records", n, cp.Written)
+		}
+		if err := output.Truncate(cp.Written); err != nil {
+			return fmt.Errorf("failed to truncate output file: %w", err)
+		}
+	}
+
+	// The payload is read from the byte holding the checkpointed bit
+	base := cp.BitOffset / 8 * 8
+	if _, err := input.Seek(payloadStart+base/8, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to checkpoint: %w", err)
+	}
+	payload, err := io.ReadAll(input)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	payload, err = splitTrailer(header, payload)
+	if err != nil {
+		return fmt.Errorf("failed to read trailer: %w", err)
+	}
+
+	dec := header.newDecoder(payload, tree)
+	dec.bit = int(cp.BitOffset % 8)
+	if !header.NoSize {
+		if cp.Written > header.OriginalSize {
+			return fmt.Errorf("checkpoint is past the end of the output")
+		}
+		dec.remaining = header.OriginalSize - cp.Written
+	}
+	if err := dec.followPath(cp.Path); err != nil {
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	buf := make([]byte, min(64*1024, checkpointEvery))
+	written := cp.Written
+	next := written + checkpointEvery
+	for {
+		n, err := dec.read(buf)
+		if n > 0 {
+			if _, err := output.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			crc.Write(buf[:n])
+			written += int64(n)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode data: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+
+		if written >= next {
+			// The checkpoint must not get ahead of the output on disk
+			if err := output.Sync(); err != nil {
+				return fmt.Errorf("failed to sync output file: %w", err)
+			}
+			cp.BitOffset = base + int64(dec.bit)
+			cp.Written = written
+			cp.Path = dec.nodePath()
+			if err := writeCheckpoint(checkpointPath, cp); err != nil {
+				return err
+			}
+			if checkpointHook != nil {
+				if err := checkpointHook(); err != nil {
+					return err
+				}
+			}
+			next = written + checkpointEvery
+		}
+	}
+
+	if !header.NoSize && written != header.OriginalSize {
+		return fmt.Errorf("failed to decode data: got %d of %d bytes", written, header.OriginalSize)
+	}
+	if header.Checksummed && crc.Sum32() != header.Checksum {
+		return ErrChecksumMismatch
+	}
+
+	if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// readCheckpoint reads the checkpoint at path, returning nil if there is none
+func readCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if cp.BitOffset < 0 || cp.Written < 0 {
+		return nil, fmt.Errorf("invalid checkpoint %+v", cp)
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint at path, writing it to a temporary
+// file first so an interruption never leaves half a checkpoint behind
+func writeCheckpoint(path string, cp *checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// nodePath returns the path from the root to the decoder's current node, as
+// recorded in a checkpoint
+func (d *decoder) nodePath() string {
+	var find func(node *Node, path []byte) []byte
+	find = func(node *Node, path []byte) []byte {
+		if node == d.current {
+			return path
+		}
+		if node.Left == nil || node.Right == nil {
+			return nil
+		}
+		if found := find(node.Left, append(path, '0')); found != nil {
+			return found
+		}
+		return find(node.Right, append(path, '1'))
+	}
+	return string(find(d.root, []byte{}))
+}
+
+// followPath moves the decoder to the internal node at the end of path
+func (d *decoder) followPath(path string) error {
+	d.current = d.root
+	for _, step := range path {
+		switch {
+		case step == '0' && d.current.Left != nil:
+			d.current = d.current.Left
+		case step == '1' && d.current.Right != nil:
+			d.current = d.current.Right
+		default:
+			return fmt.Errorf("invalid tree path %q", path)
+		}
+	}
+	if d.current != d.root && d.current.Left == nil && d.current.Right == nil {
+		return fmt.Errorf("tree path %q ends at a leaf", path)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressResume(t *testing.T) {
+	oldEvery, oldHook := checkpointEvery, checkpointHook
+	defer func() { checkpointEvery, checkpointHook = oldEvery, oldHook }()
+	checkpointEvery = 1000
+
+	data := bytes.Repeat(blockTestData(), 20)
+	errInterrupted := errors.New("interrupted")
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"checksum", Options{Checksum: true}},
+		{"size omitted", Options{OmitSize: true}},
+		{"escaped", Options{TopK: 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputPath := filepath.Join(tmpDir, "input.txt")
+			compressedPath := filepath.Join(tmpDir, "input.huf")
+			outputPath := filepath.Join(tmpDir, "output.txt")
+			checkpointPath := filepath.Join(tmpDir, "output.checkpoint")
+			if err := os.WriteFile(inputPath, data, 0644); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+			if err := CompressFileWithOptions(inputPath, compressedPath, tt.opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			// Stop after the third checkpoint, with some output past it
+			checkpoints := 0
+			checkpointHook = func() error {
+				checkpoints++
+				if checkpoints == 3 {
+					return errInterrupted
+				}
+				return nil
+			}
+			if err := DecompressResume(compressedPath, outputPath, checkpointPath); !errors.Is(err, errInterrupted) {
+				t.Fatalf("Expected the interruption, got %v", err)
+			}
+			partial, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read partial output: %v", err)
+			}
+			if len(partial) == 0 || len(partial) >= len(data) {
+				t.Fatalf("Expected partial output, got %d of %d bytes", len(partial), len(data))
+			}
+			// Simulate a write after the checkpoint that the resume must undo
+			if err := os.WriteFile(outputPath, append(partial, "garbage"...), 0644); err != nil {
+				t.Fatalf("Failed to extend partial output: %v", err)
+			}
+
+			checkpointHook = nil
+			if err := DecompressResume(compressedPath, outputPath, checkpointPath); err != nil {
+				t.Fatalf("DecompressResume error: %v", err)
+			}
+			got, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if !bytes.Equal(data, got) {
+				t.Errorf("Resumed output doesn't match original: %s", describeDiff(data, got))
+			}
+			if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+				t.Errorf("Expected the checkpoint to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecoderPathRoundTrip(t *testing.T) {
+	tree := BuildHuffmanTree(BuildFrequencyTableFromData(blockTestData()))
+	for _, path := range []string{"", "0", "1", "01"} {
+		d := newDecoder(nil, tree, 0, 0)
+		if err := d.followPath(path); err != nil {
+			continue
+		}
+		if got := d.nodePath(); got != path {
+			t.Errorf("Expected path %q, got %q", path, got)
+		}
+	}
+	d := newDecoder(nil, tree, 0, 0)
+	if err := d.followPath("0000000000000000000000"); err == nil {
+		t.Error("Expected an error for a path past a leaf")
+	}
+}
@@ -0,0 +1,114 @@
+package huffman
+
+import "fmt"
+
+// RingBuffer is a fixed-capacity circular byte buffer for streaming output on
+// targets that can't hold the whole of it. Bytes are taken from the front
+// with Read, and a write that finds the buffer full first hands everything
+// buffered to the drain callback and empties it.
+type RingBuffer struct {
+	buf   []byte
+	start int // index of the oldest byte
+	n     int // bytes buffered
+	drain func(p []byte) error
+}
+
+// NewRingBuffer returns an empty RingBuffer holding up to capacity bytes.
+// drain receives the buffered bytes in order when the buffer fills or is
+// flushed; when they wrap around the end of the buffer it is called twice.
+// p is only valid until drain returns.
+func NewRingBuffer(capacity int, drain func(p []byte) error) (*RingBuffer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("invalid ring buffer capacity %d", capacity)
+	}
+	if drain == nil {
+		return nil, fmt.Errorf("ring buffer needs a drain function")
+	}
+	return &RingBuffer{buf: make([]byte, capacity), drain: drain}, nil
+}
+
+// Len returns the number of bytes buffered
+func (r *RingBuffer) Len() int {
+	return r.n
+}
+
+// WriteByte appends b, draining the buffer first if it is full
+func (r *RingBuffer) WriteByte(b byte) error {
+	if r.n == len(r.buf) {
+		if err := r.Flush(); err != nil {
+			return err
+		}
+	}
+	r.buf[(r.start+r.n)%len(r.buf)] = b
+	r.n++
+	return nil
+}
+
+// Read takes up to len(p) of the oldest buffered bytes
+func (r *RingBuffer) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && r.n > 0 {
+		chunk := min(len(p)-n, r.n, len(r.buf)-r.start)
+		copy(p[n:], r.buf[r.start:r.start+chunk])
+		n += chunk
+		r.start = (r.start + chunk) % len(r.buf)
+		r.n -= chunk
+	}
+	return n, nil
+}
+
+// Flush hands every buffered byte to the drain function and empties the
+// buffer. The bytes are dropped even if drain fails.
+func (r *RingBuffer) Flush() error {
+	first := min(r.n, len(r.buf)-r.start)
+	head, tail := r.buf[r.start:r.start+first], r.buf[:r.n-first]
+	r.start, r.n = 0, 0
+
+	if len(head) > 0 {
+		if err := r.drain(head); err != nil {
+			return err
+		}
+	}
+	if len(tail) > 0 {
+		return r.drain(tail)
+	}
+	return nil
+}
+
+// EncodeToRing encodes data with codes as EncodeData does, but streams the
+// bytes through ring instead of returning them, so the memory used doesn't
+// grow with the input. The last byte is padded with zero bits, and the ring
+// is flushed once data is encoded. Every byte of data must have a code.
+func EncodeToRing(data []byte, codes CodeTable, ring *RingBuffer) error {
+	var acc byte
+	nacc := 0
+	for i, b := range data {
+		code, ok := codes[b]
+		if !ok {
+			return fmt.Errorf("symbol %s at offset %d is not in the code table", formatByte(b), i)
+		}
+		for j := 0; j < len(code); j++ {
+			acc <<= 1
+			if code[j] == '1' {
+				acc |= 1
+			}
+			nacc++
+			if nacc == 8 {
+				if err := ring.WriteByte(acc); err != nil {
+					return fmt.Errorf("failed to drain ring buffer: %w", err)
+				}
+				acc, nacc = 0, 0
+			}
+		}
+	}
+
+	if nacc > 0 {
+		if err := ring.WriteByte(acc << (8 - nacc)); err != nil {
+			return fmt.Errorf("failed to drain ring buffer: %w", err)
+		}
+	}
+	if err := ring.Flush(); err != nil {
+		return fmt.Errorf("failed to drain ring buffer: %w", err)
+	}
+	return nil
+}
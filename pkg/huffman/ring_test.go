@@ -0,0 +1,105 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncodeToRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		capacity int
+	}{
+		{"text", blockTestData(), 16},
+		{"capacity of one", []byte("this is an example of a huffman tree"), 1},
+		{"larger than output", []byte("abracadabra"), 1024},
+		{"single symbol", bytes.Repeat([]byte("q"), 40), 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := GenerateCodeTable(BuildHuffmanTree(BuildFrequencyTableFromData(tt.data)))
+
+			var out bytes.Buffer
+			drains := 0
+			ring, err := NewRingBuffer(tt.capacity, func(p []byte) error {
+				if len(p) > tt.capacity {
+					t.Errorf("Drained %d bytes from a ring of %d", len(p), tt.capacity)
+				}
+				drains++
+				out.Write(p)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("NewRingBuffer error: %v", err)
+			}
+
+			if err := EncodeToRing(tt.data, codes, ring); err != nil {
+				t.Fatalf("EncodeToRing error: %v", err)
+			}
+			want := EncodeData(tt.data, codes)
+			if !bytes.Equal(want, out.Bytes()) {
+				t.Errorf("Ring output doesn't match EncodeData: %s", describeDiff(want, out.Bytes()))
+			}
+			if ring.Len() != 0 {
+				t.Errorf("Expected an empty ring after encoding, %d bytes left", ring.Len())
+			}
+			if len(want) > 0 && drains < (len(want)+tt.capacity-1)/tt.capacity {
+				t.Errorf("Expected at least %d drains, got %d", (len(want)+tt.capacity-1)/tt.capacity, drains)
+			}
+		})
+	}
+}
+
+func TestRingBufferWraps(t *testing.T) {
+	var drained [][]byte
+	ring, err := NewRingBuffer(4, func(p []byte) error {
+		drained = append(drained, append([]byte(nil), p...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewRingBuffer error: %v", err)
+	}
+
+	for _, b := range []byte("abc") {
+		ring.WriteByte(b)
+	}
+	p := make([]byte, 2)
+	if n, _ := ring.Read(p); n != 2 || string(p) != "ab" {
+		t.Fatalf("Expected to read \"ab\", got %q", p[:n])
+	}
+	for _, b := range []byte("def") {
+		ring.WriteByte(b)
+	}
+	// The buffer now holds "cdef" wrapped around its end
+	if err := ring.WriteByte('g'); err != nil {
+		t.Fatalf("WriteByte error: %v", err)
+	}
+	if got := bytes.Join(drained, nil); string(got) != "cdef" || len(drained) != 2 {
+		t.Errorf("Expected \"cdef\" drained in two parts, got %q", drained)
+	}
+	if ring.Len() != 1 {
+		t.Errorf("Expected one byte buffered, got %d", ring.Len())
+	}
+}
+
+func TestEncodeToRingErrors(t *testing.T) {
+	errFull := errors.New("sink full")
+	ring, err := NewRingBuffer(2, func(p []byte) error { return errFull })
+	if err != nil {
+		t.Fatalf("NewRingBuffer error: %v", err)
+	}
+	data := blockTestData()
+	codes := GenerateCodeTable(BuildHuffmanTree(BuildFrequencyTableFromData(data)))
+	if err := EncodeToRing(data, codes, ring); !errors.Is(err, errFull) {
+		t.Errorf("Expected the drain error, got %v", err)
+	}
+	if err := EncodeToRing([]byte("zzz"), CodeTable{'a': "0"}, ring); err == nil {
+		t.Error("Expected an error for a symbol without a code")
+	}
+	if _, err := NewRingBuffer(0, func([]byte) error { return nil }); err == nil {
+		t.Error("Expected an error for a zero capacity")
+	}
+}
@@ -0,0 +1,112 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+)
+
+// SameContent reports whether two compressed files decompress to the same
+// bytes, for deduplication. It first compares what the headers and info
+// trailers say about the content: differing sizes or checksums mean the
+// content differs, and matching checksums are taken to mean it is the same.
+// Only when the sizes match, or are unknown, and a checksum is missing from
+// either file are both files decompressed and compared. The files may use
+// different formats and options.
+func SameContent(pathA, pathB string) (bool, error) {
+	a, err := readContentSummary(pathA)
+	if err != nil {
+		return false, err
+	}
+	b, err := readContentSummary(pathB)
+	if err != nil {
+		return false, err
+	}
+
+	if a.size >= 0 && b.size >= 0 && a.size != b.size {
+		return false, nil
+	}
+	if a.checksummed && b.checksummed {
+		return a.checksum == b.checksum, nil
+	}
+
+	dataA, err := decompressPath(pathA)
+	if err != nil {
+		return false, err
+	}
+	dataB, err := decompressPath(pathB)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
+
+// contentSummary is what a compressed file says about its content without
+// decoding it. size is -1 when the file doesn't record it.
+type contentSummary struct {
+	size        int64
+	checksummed bool
+	checksum    uint32
+}
+
+// readContentSummary reads the header, and the info trailer if there is one,
+// of the file at path
+func readContentSummary(path string) (contentSummary, error) {
+	if err := checkNotDirectory(path); err != nil {
+		return contentSummary{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return contentSummary{}, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(file)
+
+	header, err := ParseHeader(file)
+	if err != nil {
+		return contentSummary{}, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+
+	summary := contentSummary{size: -1, checksummed: header.Checksummed, checksum: header.Checksum}
+	switch {
+	case header.InfoTrailer:
+		info, err := ReadTrailer(file)
+		if err != nil {
+			return contentSummary{}, fmt.Errorf("failed to read trailer of %s: %w", path, err)
+		}
+		summary.size, summary.checksummed, summary.checksum = info.OriginalSize, true, info.Checksum
+	case header.Blocks != nil:
+		summary.size = 0
+		for _, block := range header.Blocks {
+			summary.size += block.OriginalSize
+		}
+	case !header.Stored && !header.SizeInTrailer && !header.NoSize:
+		summary.size = header.OriginalSize
+	}
+	return summary, nil
+}
+
+// decompressPath decompresses the file at path into memory
+func decompressPath(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(file)
+
+	var buf bytes.Buffer
+	if err := Decompress(file, &buf); err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package huffman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	compress := func(name string, data []byte, opts Options) string {
+		t.Helper()
+		inputPath := filepath.Join(tmpDir, name+".txt")
+		outputPath := filepath.Join(tmpDir, name+".huf")
+		if err := os.WriteFile(inputPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := CompressFileWithOptions(inputPath, outputPath, opts); err != nil {
+			t.Fatalf("CompressFileWithOptions(%s) error: %v", name, err)
+		}
+		return outputPath
+	}
+
+	data := []byte("the same content compressed in different ways")
+	other := []byte("the same length but a different set of words!")
+	plain := compress("plain", data, Options{})
+	again := compress("again", data, Options{})
+	tree := compress("tree", data, Options{Table: TableTree})
+	checked := compress("checked", data, Options{Checksum: true})
+	trailer := compress("trailer", data, Options{Trailer: true})
+	stored := compress("stored", data, Options{Store: true})
+	differs := compress("differs", other, Options{})
+	differsChecked := compress("differs-checked", other, Options{Checksum: true})
+	shorter := compress("shorter", data[:10], Options{})
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{"compressed twice", plain, again, true},
+		{"different table", plain, tree, true},
+		{"checksum and trailer", checked, trailer, true},
+		{"checksum and plain", checked, plain, true},
+		{"stored and coded", stored, tree, true},
+		{"different content", plain, differs, false},
+		{"different checksums", checked, differsChecked, false},
+		{"different sizes", plain, shorter, false},
+		{"stored and different", stored, differs, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same, err := SameContent(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("SameContent error: %v", err)
+			}
+			if same != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, same)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// ScanOverlap is the number of bytes each window Scan passes to match repeats
+// from the end of the window before it, so a pattern of up to ScanOverlap+1
+// bytes is seen whole even when it straddles two windows
+const ScanOverlap = 4096
+
+// scanChunk is the most new bytes Scan adds to a window
+const scanChunk = 64 * 1024
+
+// errScanMatched stops decoding once Scan's match function succeeds
+var errScanMatched = errors.New("huffman: scan matched")
+
+// Scan decompresses the file at inputPath without writing the output
+// anywhere, passing it to match in overlapping windows until match returns
+// true. It returns whether match did and the offset in the decompressed data
+// of the first byte of that window; a caller looking for a pattern can add
+// the pattern's index within the window to get its exact offset. Each window
+// holds up to 64KB of new data after the last ScanOverlap bytes of the one
+// before, and is only valid until match returns.
+func Scan(inputPath string, match func(window []byte) bool) (found bool, offset int64, err error) {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return false, 0, err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	sw := &scanWriter{match: match}
+	err = decompress(input, sw, DecompressOptions{})
+	if errors.Is(err, errScanMatched) {
+		return true, sw.offset, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return false, 0, nil
+}
+
+// scanWriter feeds the data written to it to a match function in overlapping
+// windows
+type scanWriter struct {
+	match  func(window []byte) bool
+	window []byte
+	offset int64 // offset of window[0] in the data
+}
+
+func (sw *scanWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Keep the overlap from the previous window and add new data
+		if keep := min(len(sw.window), ScanOverlap); keep < len(sw.window) {
+			sw.offset += int64(len(sw.window) - keep)
+			sw.window = append(sw.window[:0], sw.window[len(sw.window)-keep:]...)
+		}
+		chunk := p[:min(len(p), scanChunk)]
+		sw.window = append(sw.window, chunk...)
+		p = p[len(chunk):]
+		written += len(chunk)
+
+		if sw.match(sw.window) {
+			return written, errScanMatched
+		}
+	}
+	return written, nil
+}
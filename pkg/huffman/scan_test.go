@@ -0,0 +1,73 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	var data []byte
+	for i := 0; len(data) < 300*1024; i++ {
+		data = append(data, blockTestData()...)
+	}
+	needle := []byte("needle in the haystack")
+	at := len(data) - 100*1024 - len(needle)/2
+	data = append(data[:at:at], append(needle, data[at:]...)...)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		compress func(outputPath string) error
+	}{
+		{"single stream", func(outputPath string) error { return CompressFile(inputPath, outputPath) }},
+		{"block archive", func(outputPath string) error {
+			return CompressParallel(inputPath, outputPath, ParallelOptions{BlockSize: 50 * 1024})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.name+".huf")
+			if err := tt.compress(compressedPath); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			var index int
+			found, offset, err := Scan(compressedPath, func(window []byte) bool {
+				index = bytes.Index(window, needle)
+				return index >= 0
+			})
+			if err != nil {
+				t.Fatalf("Scan error: %v", err)
+			}
+			if !found {
+				t.Fatal("Expected to find the needle")
+			}
+			if got := offset + int64(index); got != int64(at) {
+				t.Errorf("Expected the needle at offset %d, got %d", at, got)
+			}
+
+			windows := 0
+			found, _, err = Scan(compressedPath, func(window []byte) bool {
+				windows++
+				return bytes.Contains(window, []byte("not in the data"))
+			})
+			if err != nil {
+				t.Fatalf("Scan error: %v", err)
+			}
+			if found {
+				t.Error("Expected not to find a pattern that isn't there")
+			}
+			if windows < len(data)/scanChunk {
+				t.Errorf("Expected the whole input to be scanned, got %d windows", windows)
+			}
+		})
+	}
+}
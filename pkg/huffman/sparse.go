@@ -0,0 +1,57 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the size of the zero blocks skipped by writeSparseFile,
+// matching the usual filesystem block size
+const sparseBlockSize = 4096
+
+// writeSparseFile writes data to path, seeking past whole blocks of zeros so
+// the filesystem can leave them unallocated. diag collects a failure to close
+// the file.
+func writeSparseFile(path string, data []byte, diag *Diagnostics) error {
+	output, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return outputError(path, err)
+	}
+	defer func(output *os.File) {
+		err := output.Close()
+		if err != nil {
+			diag.report(DiagCloseError, "failed to close output file: %v", err)
+		}
+	}(output)
+
+	for offset := 0; offset < len(data); offset += sparseBlockSize {
+		block := data[offset:min(offset+sparseBlockSize, len(data))]
+		if isZero(block) {
+			if _, err := output.Seek(int64(len(block)), io.SeekCurrent); err != nil {
+				return fmt.Errorf("failed to seek output file: %w", err)
+			}
+			continue
+		}
+		if _, err := output.Write(block); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+
+	// Seeking doesn't extend the file, so a trailing hole needs a truncate
+	if err := output.Truncate(int64(len(data))); err != nil {
+		return fmt.Errorf("failed to set output file size: %w", err)
+	}
+
+	return nil
+}
+
+// isZero reports whether every byte of b is zero
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package huffman
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressFileSparse(t *testing.T) {
+	// Zero regions in the middle, at an unaligned offset and at the end
+	var data []byte
+	data = append(data, []byte("header text before the hole")...)
+	data = append(data, make([]byte, 1<<20)...)
+	data = append(data, []byte("data between the holes")...)
+	data = append(data, make([]byte, 3*sparseBlockSize+17)...)
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.bin")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.bin")
+
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	if err := DecompressFileWithOptions(compressedPath, decompressedPath, DecompressOptions{Sparse: true}); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Sparse output doesn't match original: %s", describeDiff(data, decompressed))
+	}
+}
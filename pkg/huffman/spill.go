@@ -0,0 +1,185 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spillThreshold is the input size above which CompressFileResultWithOptions
+// spills the input to a temporary file instead of holding it in memory. Tests
+// lower it.
+var spillThreshold int64 = 256 << 20
+
+// spillChunk is the size of the reads and encodes of a spilled input. Tests
+// lower it.
+var spillChunk = 1 << 20
+
+// canSpill reports whether a compression with opts can encode a spilled
+// input. Storing, case folding, remapping, TopK and VerifyAfterCompress all
+// need the whole input in memory.
+func canSpill(opts Options) bool {
+	return !opts.Store && !opts.StoreIfLarger && !opts.FoldCase && !opts.Remap && opts.TopK == 0 && !opts.VerifyAfterCompress
+}
+
+// spilledInput is an input copied to a temporary file as it was read, along
+// with its byte counts. The second pass reads the copy rather than the input,
+// so the input is read once and the data encoded is the data that was
+// counted and hashed even if the input changes in the meantime.
+type spilledInput struct {
+	file   *os.File
+	size   int64
+	counts byteCounts
+	// sampled counts only the blocks Options.SampleEvery picks
+	sampled byteCounts
+}
+
+// spillInput reads r to the end into a temporary file, counting its bytes,
+// and those of every sampleEveryN-th block if sampleEveryN is above 1. The
+// file is left at its start, ready to be encoded.
+func spillInput(r io.Reader, sampleEveryN int, diag *Diagnostics) (*spilledInput, error) {
+	file, err := os.CreateTemp("", "huffman-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	s := &spilledInput{file: file}
+
+	buf := make([]byte, spillChunk)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		chunk := buf[:n]
+		s.counts.add(chunk)
+		if sampleEveryN > 1 {
+			s.sampled.addSampled(chunk, s.size, sampleEveryN)
+		}
+		if _, err := file.Write(chunk); err != nil {
+			s.remove(diag)
+			return nil, fmt.Errorf("failed to write spill file: %w", err)
+		}
+		s.size += int64(n)
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			s.remove(diag)
+			return nil, readErr
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		s.remove(diag)
+		return nil, fmt.Errorf("failed to rewind spill file: %w", err)
+	}
+	return s, nil
+}
+
+// frequencies returns the model for the spilled input as
+// CompressFileResultWithOptions builds it from an input in memory
+func (s *spilledInput) frequencies(sampleEveryN int) FrequencyTable {
+	if sampleEveryN <= 1 {
+		return s.counts.table()
+	}
+	freq := s.sampled.table()
+	for i, count := range s.counts {
+		if _, counted := freq[byte(i)]; count > 0 && !counted {
+			freq[byte(i)] = 1
+		}
+	}
+	return freq
+}
+
+// remove closes and deletes the spill file, reporting failures to diag
+func (s *spilledInput) remove(diag *Diagnostics) {
+	if err := s.file.Close(); err != nil {
+		diag.report(DiagCloseError, "failed to close spill file: %v", err)
+	}
+	if err := os.Remove(s.file.Name()); err != nil {
+		diag.report(DiagRemoveError, "failed to remove spill file: %v", err)
+	}
+}
+
+// addSampled counts the bytes of chunk, which starts offset bytes into the
+// input, that fall in the blocks sampleFrequencies counts
+func (c *byteCounts) addSampled(chunk []byte, offset int64, sampleEveryN int) {
+	stride := int64(sampleEveryN) * sampleBlockSize
+	end := offset + int64(len(chunk))
+	for start := offset - offset%stride; start < end; start += stride {
+		lo, hi := max(start, offset), min(start+sampleBlockSize, end)
+		if lo < hi {
+			c.add(chunk[lo-offset : hi-offset])
+		}
+	}
+}
+
+// writeSpilledFile writes the spilled input compressed with freq to path like
+// writeCompressedFile, encoding it a chunk at a time
+func writeSpilledFile(path string, s *spilledInput, freq FrequencyTable, opts Options, checksum uint32, progress func(encoded int64)) (n int64, err error) {
+	if err := validateOptions(opts); err != nil {
+		return 0, err
+	}
+	plan, err := planCounts(&s.counts, freq, opts, checksum, -1, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := createOutput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = output.finish(err, opts.Diagnostics) }()
+
+	counter := &countingWriter{w: output}
+	if _, err := counter.Write(plan.header); err != nil {
+		return counter.n, fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := encodeChunked(counter, s.file, plan.codes, progress); err != nil {
+		return counter.n, err
+	}
+	if err := plan.writeEnd(counter, s.size, checksum); err != nil {
+		return counter.n, err
+	}
+	return counter.n, nil
+}
+
+// encodeChunked encodes r with codes a spillChunk at a time, writing the
+// whole bytes of the payload to w as they are completed. progress, if not
+// nil, is called with the number of bytes encoded after each chunk.
+func encodeChunked(w io.Writer, r io.Reader, codes CodeTable, progress func(encoded int64)) error {
+	buf := make([]byte, spillChunk)
+	var bw bitWriter
+	var encoded int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		for _, b := range buf[:n] {
+			bw.writeCode(codes[b])
+		}
+		encoded += int64(n)
+
+		// Hold back a partly written last byte for the next chunk
+		whole := len(bw.buf)
+		if bw.nbits != 0 {
+			whole--
+		}
+		if _, err := w.Write(bw.buf[:whole]); err != nil {
+			return fmt.Errorf("failed to write encoded data: %w", err)
+		}
+		bw.buf = append(bw.buf[:0], bw.buf[whole:]...)
+		if progress != nil {
+			progress(encoded)
+		}
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read spill file: %w", readErr)
+		}
+	}
+
+	if _, err := w.Write(bw.buf); err != nil {
+		return fmt.Errorf("failed to write encoded data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// DecompressSplit decompresses an archive into one file per member, naming
+// the file for the member at index with namer. The members of a block archive
+// are its blocks, whose boundaries the index records; any other stream is a
+// single member. Each member is decoded and written before the next is read.
+func DecompressSplit(inputPath string, namer func(index int) string) error {
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	header, err := ParseHeader(input)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	// The blocks of a record archive are columns, not parts of the output
+	if header.Blocks == nil || header.RecordSize > 0 {
+		if _, err := input.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind input file: %w", err)
+		}
+		_, decoded, err := readCompressed(input)
+		if err != nil {
+			return err
+		}
+		return writeMember(namer(0), decoded)
+	}
+
+	for i, block := range header.Blocks {
+		decoded, err := readBlock(input, block)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %d: %w", i, err)
+		}
+		if err := writeMember(namer(i), decoded); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMember writes one decoded member of DecompressSplit to path
+func writeMember(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
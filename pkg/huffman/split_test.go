@@ -0,0 +1,59 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressSplit(t *testing.T) {
+	members := [][]byte{
+		bytes.Repeat([]byte("the first document in the archive\n"), 30),
+		[]byte("a second, shorter document"),
+	}
+
+	// Build a block archive with one block per member
+	header := &Header{Version: formatVersion}
+	var streams bytes.Buffer
+	for _, member := range members {
+		var buf bytes.Buffer
+		if err := writeCompressed(&buf, member, BuildFrequencyTableFromData(member), Options{}); err != nil {
+			t.Fatalf("writeCompressed error: %v", err)
+		}
+		header.Blocks = append(header.Blocks, BlockInfo{OriginalSize: int64(len(member)), CompressedSize: int64(buf.Len())})
+		streams.Write(buf.Bytes())
+	}
+	var archive bytes.Buffer
+	if err := writeHeader(&archive, header); err != nil {
+		t.Fatalf("writeHeader error: %v", err)
+	}
+	archive.Write(streams.Bytes())
+
+	tmpDir := t.TempDir()
+	archivePath := filepath.Join(tmpDir, "archive.huf")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	namer := func(index int) string {
+		return filepath.Join(tmpDir, fmt.Sprintf("member-%d.txt", index))
+	}
+	if err := DecompressSplit(archivePath, namer); err != nil {
+		t.Fatalf("DecompressSplit error: %v", err)
+	}
+
+	for i, member := range members {
+		got, err := os.ReadFile(namer(i))
+		if err != nil {
+			t.Fatalf("Failed to read member %d: %v", i, err)
+		}
+		if !bytes.Equal(member, got) {
+			t.Errorf("Member %d doesn't match: %s", i, describeDiff(member, got))
+		}
+	}
+	if _, err := os.Stat(namer(len(members))); !os.IsNotExist(err) {
+		t.Errorf("Expected only %d members, got %v", len(members), err)
+	}
+}
@@ -0,0 +1,165 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// entropy returns the Shannon entropy of a frequency table in bits per symbol
+func entropy(freq FrequencyTable) float64 {
+	total := 0
+	for _, count := range freq {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	// Sum in symbol order so the result doesn't depend on map iteration
+	h := 0.0
+	for i := 0; i < 256; i++ {
+		count := freq[byte(i)]
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// EstimateSavings estimates the best-case compression ratio (compressed size
+// divided by original size) from the Shannon entropy of the frequency table.
+// It does not build a tree, so it is cheap enough to decide whether compressing
+// is worthwhile at all. The estimate is a lower bound on the payload ratio and
+// ignores header overhead.
+func EstimateSavings(freq FrequencyTable, totalBytes int64) (estimatedRatio float64) {
+	if totalBytes <= 0 {
+		return 0
+	}
+
+	// Allow for rounding error so a dyadic distribution, whose entropy matches
+	// the code length exactly, is not pushed up to the next whole byte
+	payloadBytes := math.Ceil(float64(totalBytes)*entropy(freq)/8 - 1e-9)
+	return payloadBytes / float64(totalBytes)
+}
+
+// TheoreticalMinBytes returns the Shannon limit for totalBytes bytes with the
+// byte distribution of freq: totalBytes times its entropy in bits, in bytes.
+// No code built from freq can make the payload smaller, and Huffman codes
+// come within a bit per byte of it; the header is extra. Pass the table the
+// tree is built from, so the floor matches the codes actually used.
+func TheoreticalMinBytes(freq FrequencyTable, totalBytes int64) float64 {
+	return float64(totalBytes) * entropy(freq) / 8
+}
+
+// RatioTolerance is how far above its baseline CompareRatio lets a ratio go
+// before reporting a regression, in ratio points
+const RatioTolerance = 0.005
+
+// CompareRatio returns the ratio of the size Compress gives data with the
+// default options to the size of data, and whether it is worse than baseline
+// by more than RatioTolerance. It lets tests guard a ratio against
+// regressions without hand-tuned thresholds. An empty input has a ratio of 0.
+func CompareRatio(data []byte, baseline float64) (actual float64, regressed bool) {
+	size, err := EncodedSize(data)
+	if err != nil {
+		return 0, false
+	}
+	actual = float64(size) / float64(len(data))
+	return actual, actual > baseline+RatioTolerance
+}
+
+// Stats summarizes how well Huffman coding suits some data
+type Stats struct {
+	// TotalBytes is the length of the data
+	TotalBytes int64
+	// Frequencies counts each byte value in the data
+	Frequencies FrequencyTable
+	// Entropy is the Shannon entropy in bits per byte, the lower bound for
+	// any code built from these counts
+	Entropy float64
+	// AverageCodeLength is the mean length in bits of the Huffman code of a
+	// byte of the data
+	AverageCodeLength float64
+}
+
+// Analyze computes the statistics of data
+func Analyze(data []byte) Stats {
+	return analyzeFrequencies(BuildFrequencyTableFromData(data), int64(len(data)))
+}
+
+// AnalyzeReader computes the same statistics as Analyze in a single pass over
+// r, without holding the data in memory
+func AnalyzeReader(r io.Reader) (Stats, error) {
+	var counts byteCounts
+	var total int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		counts.add(buf[:n])
+		total += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Stats{}, fmt.Errorf("failed to read input: %w", err)
+		}
+	}
+	return analyzeFrequencies(counts.table(), total), nil
+}
+
+// analyzeFrequencies derives the statistics from the counts of total bytes
+func analyzeFrequencies(freq FrequencyTable, total int64) Stats {
+	stats := Stats{TotalBytes: total, Frequencies: freq, Entropy: entropy(freq)}
+	if total == 0 {
+		return stats
+	}
+
+	codes, _ := BuildCodes(freq)
+	var bits int64
+	for char, count := range freq {
+		bits += int64(count) * int64(len(codes[char]))
+	}
+	stats.AverageCodeLength = float64(bits) / float64(total)
+	return stats
+}
+
+// CodeReportEntry describes the code of one symbol and its share of the
+// compressed size
+type CodeReportEntry struct {
+	Symbol     byte
+	Frequency  int
+	Code       string
+	CodeLength int
+	// ContributedBits is Frequency * CodeLength, the bits the symbol adds
+	// to the payload
+	ContributedBits int64
+}
+
+// CodeReport lists the code of every symbol in freq, the symbols that
+// dominate the compressed size first. Entries with the same ContributedBits
+// are in symbol order.
+func CodeReport(freq FrequencyTable) []CodeReportEntry {
+	codes, _ := BuildCodes(freq)
+	report := make([]CodeReportEntry, 0, len(codes))
+	for char, code := range codes {
+		report = append(report, CodeReportEntry{
+			Symbol:          char,
+			Frequency:       freq[char],
+			Code:            code,
+			CodeLength:      len(code),
+			ContributedBits: int64(freq[char]) * int64(len(code)),
+		})
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].ContributedBits != report[j].ContributedBits {
+			return report[i].ContributedBits > report[j].ContributedBits
+		}
+		return report[i].Symbol < report[j].Symbol
+	})
+	return report
+}
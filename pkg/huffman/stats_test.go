@@ -0,0 +1,190 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEstimateSavings(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"simple", []byte("aaabbc")},
+		{"dyadic", []byte("aaaabbcd")},
+		{"single char", bytes.Repeat([]byte("a"), 100)},
+		{"english text", bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 50)},
+		{"all bytes", func() []byte {
+			data := make([]byte, 0, 256*3)
+			for i := 0; i < 256; i++ {
+				for j := 0; j <= i%3; j++ {
+					data = append(data, byte(i))
+				}
+			}
+			return data
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freq := BuildFrequencyTableFromData(tt.input)
+			estimate := EstimateSavings(freq, int64(len(tt.input)))
+
+			codes := GenerateCodeTable(BuildHuffmanTree(freq))
+			actual := float64(len(EncodeData(tt.input, codes))) / float64(len(tt.input))
+
+			if estimate < 0 || estimate > actual {
+				t.Errorf("Expected estimate in [0, %.4f], got %.4f", actual, estimate)
+			}
+		})
+	}
+}
+
+func TestEstimateSavingsEmpty(t *testing.T) {
+	if ratio := EstimateSavings(FrequencyTable{}, 0); ratio != 0 {
+		t.Errorf("Expected 0 for empty input, got %f", ratio)
+	}
+}
+
+func TestTheoreticalMinBytes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rng.Read(random)
+
+	inputs := map[string][]byte{
+		"text":          blockTestData(),
+		"random":        random,
+		"two symbols":   []byte("abababababababab"),
+		"skewed":        append(bytes.Repeat([]byte{'a'}, 1000), "bcdefg"...),
+		"single symbol": bytes.Repeat([]byte{'z'}, 100),
+	}
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			freq := BuildFrequencyTableFromData(data)
+			var compressed bytes.Buffer
+			if err := writeCompressed(&compressed, data, freq, Options{}); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+			r := bytes.NewReader(compressed.Bytes())
+			if _, err := ParseHeader(r); err != nil {
+				t.Fatalf("ParseHeader failed: %v", err)
+			}
+
+			floor := TheoreticalMinBytes(freq, int64(len(data)))
+			if payload := float64(r.Len()); payload < floor {
+				t.Errorf("Payload of %v bytes is below the entropy floor of %v", payload, floor)
+			}
+			// Huffman codes cost less than a bit per byte more than the floor
+			if limit := floor + float64(len(data))/8 + 1; float64(r.Len()) > limit {
+				t.Errorf("Payload of %d bytes is more than a bit per byte above the floor of %v", r.Len(), floor)
+			}
+		})
+	}
+}
+
+func TestCompareRatio(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 50)
+	size, err := EncodedSize(data)
+	if err != nil {
+		t.Fatalf("EncodedSize error: %v", err)
+	}
+	ratio := float64(size) / float64(len(data))
+
+	tests := []struct {
+		name      string
+		baseline  float64
+		regressed bool
+	}{
+		{"at baseline", ratio, false},
+		{"better than baseline", ratio + 0.1, false},
+		{"within tolerance", ratio - RatioTolerance/2, false},
+		{"past tolerance", ratio - 2*RatioTolerance, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, regressed := CompareRatio(data, tt.baseline)
+			if actual != ratio {
+				t.Errorf("Expected ratio %.4f, got %.4f", ratio, actual)
+			}
+			if regressed != tt.regressed {
+				t.Errorf("Ratio %.4f against baseline %.4f: expected regressed %v, got %v", actual, tt.baseline, tt.regressed, regressed)
+			}
+		})
+	}
+
+	if actual, regressed := CompareRatio(nil, 0.5); actual != 0 || regressed {
+		t.Errorf("Expected ratio 0 without a regression for empty input, got %.4f, %v", actual, regressed)
+	}
+}
+
+func TestAnalyzeReader(t *testing.T) {
+	inputs := []string{
+		"",
+		"a",
+		"abracadabra",
+		strings.Repeat("The quick brown fox jumps over the lazy dog. ", 2000),
+	}
+
+	for _, s := range inputs {
+		want := Analyze([]byte(s))
+
+		got, err := AnalyzeReader(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("AnalyzeReader error: %v", err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("AnalyzeReader(%.20q) = %+v, Analyze gives %+v", s, got, want)
+		}
+
+		got, err = AnalyzeReader(iotest.OneByteReader(strings.NewReader(s)))
+		if err != nil {
+			t.Fatalf("AnalyzeReader error: %v", err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("AnalyzeReader(%.20q) one byte at a time = %+v, Analyze gives %+v", s, got, want)
+		}
+
+		if len(s) > 1 && (want.AverageCodeLength < want.Entropy || want.AverageCodeLength >= want.Entropy+1) {
+			t.Errorf("Average code length %f is not within a bit of entropy %f", want.AverageCodeLength, want.Entropy)
+		}
+	}
+}
+
+func TestCodeReport(t *testing.T) {
+	data := bytes.Repeat([]byte("which symbols dominate the compressed size? "), 40)
+	freq := BuildFrequencyTableFromData(data)
+	codes := GenerateCodeTable(BuildHuffmanTree(freq))
+	encoded := EncodeData(data, codes)
+
+	report := CodeReport(freq)
+	if len(report) != len(freq) {
+		t.Fatalf("Expected %d entries, got %d", len(freq), len(report))
+	}
+
+	var total int64
+	for i, entry := range report {
+		if entry.Frequency != freq[entry.Symbol] || entry.Code != codes[entry.Symbol] || entry.CodeLength != len(entry.Code) {
+			t.Errorf("Entry %+v doesn't match the table", entry)
+		}
+		if i > 0 && entry.ContributedBits > report[i-1].ContributedBits {
+			t.Errorf("Entry %d contributes more bits than entry %d", i, i-1)
+		}
+		total += entry.ContributedBits
+	}
+
+	var want int64
+	for _, b := range data {
+		want += int64(len(codes[b]))
+	}
+	if total != want {
+		t.Errorf("Expected %d contributed bits in total, got %d", want, total)
+	}
+	if n := (total + 7) / 8; n != int64(len(encoded)) {
+		t.Errorf("Contributed bits fill %d bytes, encoded data is %d", n, len(encoded))
+	}
+}
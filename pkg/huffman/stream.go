@@ -0,0 +1,374 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Compress reads r to the end and writes its compressed form to w. Huffman
+// coding needs statistics over the whole input, so nothing is written until r
+// is exhausted. With opts.Store the input is instead copied straight through,
+// using w's ReadFrom method when it has one. Options.SampleEvery only applies
+// to files and is ignored here.
+func Compress(r io.Reader, w io.Writer, opts Options) error {
+	// Check before the stored fast path, which would otherwise drop options
+	// that can't be combined with Store
+	if err := validateOptions(opts); err != nil {
+		return err
+	}
+
+	if opts.Store && opts.PadTo <= 1 {
+		if err := writeHeader(w, &Header{Version: formatVersion, Stored: true}); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		if _, err := copyTo(w, r); err != nil {
+			return fmt.Errorf("failed to copy stored data: %w", err)
+		}
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty input")
+	}
+
+	return writeCompressed(w, data, BuildFrequencyTableFromData(data), opts)
+}
+
+// EncodedSize returns the exact number of bytes Compress writes for data with
+// the default options, without encoding the payload, so an HTTP handler can
+// set Content-Length before it streams the body
+func EncodedSize(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("empty input")
+	}
+	plan, err := planCompressed(data, BuildFrequencyTableFromData(data), Options{}, 0)
+	if err != nil {
+		return 0, err
+	}
+	return plan.size(), nil
+}
+
+// Decompress reads a compressed stream from r and writes the decoded data to
+// w. Stored payloads are copied straight through, using w's ReadFrom method
+// when it has one.
+func Decompress(r io.Reader, w io.Writer) error {
+	return decompress(r, w, DecompressOptions{})
+}
+
+// decompress is Decompress as configured by opts
+func decompress(r io.Reader, w io.Writer, opts DecompressOptions) error {
+	header, err := ParseHeader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if header.Encrypted {
+		return ErrEncrypted
+	}
+	if header.Blocks != nil {
+		if err := decodeBlocks(r, header, w); err != nil {
+			return err
+		}
+		return checkStrictEnd(r, opts)
+	}
+	if header.Lines != nil {
+		if err := decodeLines(r, header, w); err != nil {
+			return err
+		}
+		return checkStrictEnd(r, opts)
+	}
+	if header.Stored && !header.Aligned {
+		if _, err := copyTo(w, r); err != nil {
+			return fmt.Errorf("failed to copy stored data: %w", err)
+		}
+		return nil
+	}
+
+	encodedData, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read encoded data: %w", err)
+	}
+	encodedData, err = splitTrailer(header, encodedData)
+	if err != nil {
+		return fmt.Errorf("failed to read trailer: %w", err)
+	}
+
+	if header.Stored {
+		if _, err := w.Write(encodedData); err != nil {
+			return fmt.Errorf("failed to write stored data: %w", err)
+		}
+		return nil
+	}
+
+	if header.ExternalCodes {
+		return ErrExternalCodes
+	}
+
+	tree := header.Root()
+	if tree == nil {
+		return fmt.Errorf("failed to build huffman tree")
+	}
+
+	crc := crc32.NewIEEE()
+	if header.Checksummed {
+		w = io.MultiWriter(w, crc)
+	}
+
+	dec := header.newDecoder(encodedData, tree)
+	if opts.UniformTiming {
+		dec.useLookup()
+	}
+	written, err := decodeToWriter(dec, w)
+	if err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+	if !header.NoSize && written != header.OriginalSize {
+		return fmt.Errorf("failed to decode data: got %d of %d bytes", written, header.OriginalSize)
+	}
+	if opts.Strict && dec.bit < dec.totalBits {
+		return fmt.Errorf("%w: %d bits after the last code", ErrTrailingData, dec.totalBits-dec.bit)
+	}
+	if header.Checksummed && crc.Sum32() != header.Checksum {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// ErrTrailingData is returned by strict decompression when the input goes on
+// after the end of the payload
+var ErrTrailingData = errors.New("huffman: data after the end of the payload")
+
+// checkStrictEnd returns ErrTrailingData if opts is strict and r has bytes
+// left after the last record of an archive
+func checkStrictEnd(r io.Reader, opts DecompressOptions) error {
+	if !opts.Strict {
+		return nil
+	}
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %d bytes after the last record", ErrTrailingData, n)
+	}
+	return nil
+}
+
+// DefaultPeekSize is the sample size CompressPeek uses when none is given
+const DefaultPeekSize = 64 * 1024
+
+// peekStoreRatio is the estimated ratio above which CompressPeek stores the
+// stream instead of coding it
+const peekStoreRatio = 0.9
+
+// CompressPeek compresses a stream of unknown compressibility in one pass. It
+// buffers the first sampleSize bytes of r and estimates their entropy. If the
+// sample looks incompressible the whole stream is stored; otherwise the sample
+// becomes the model for a streaming NewModelWriter. Every byte value gets at
+// least a count of one in the model, since later data may use symbols the
+// sample did not. The choice is visible in the header as either a stored or a
+// size-in-trailer stream.
+func CompressPeek(r io.Reader, w io.Writer, sampleSize int) error {
+	if sampleSize < 0 {
+		return fmt.Errorf("invalid sample size %d", sampleSize)
+	}
+	if sampleSize == 0 {
+		sampleSize = DefaultPeekSize
+	}
+
+	sample := make([]byte, sampleSize)
+	n, err := io.ReadFull(r, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("empty input")
+	}
+	sample = sample[:n]
+	rest := io.MultiReader(bytes.NewReader(sample), r)
+
+	freq := BuildFrequencyTableFromData(sample)
+	if EstimateSavings(freq, int64(n)) > peekStoreRatio {
+		return Compress(rest, w, Options{Store: true})
+	}
+
+	for i := 0; i < 256; i++ {
+		if _, ok := freq[byte(i)]; !ok {
+			freq[byte(i)] = 1
+		}
+	}
+
+	zw, err := NewModelWriter(w, freq)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, rest); err != nil {
+		return fmt.Errorf("failed to compress input: %w", err)
+	}
+	return zw.Close()
+}
+
+// copyTo copies r to w, letting w read from r directly when it implements
+// io.ReaderFrom and falling back to io.Copy otherwise
+func copyTo(w io.Writer, r io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w, r)
+}
+
+// Writer compresses the data written to it.
+//
+// A Writer from NewWriter needs statistics over the whole input, so it buffers
+// everything and writes the compressed stream on Close. A Writer from
+// NewModelWriter already knows its codes, so it writes the header immediately
+// and passes encoded bytes on as soon as they are complete, letting a reader
+// on the other end of a pipe start decoding before the input is finished.
+type Writer struct {
+	w      io.Writer
+	closed bool
+	hash   hash.Hash // hashes the input when Options.HashFunc is set
+
+	// Buffered mode
+	buf  []byte
+	opts Options
+
+	// Model mode
+	codes   CodeTable
+	out     []byte // completed bytes waiting to be written
+	acc     byte   // partially filled output byte
+	nacc    int    // bits used in acc
+	written int64  // input bytes encoded so far
+}
+
+// NewWriter returns a Writer that compresses everything written to it with a
+// model built from the full input once Close is called.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// NewWriterWithOptions is NewWriter with the stream written on Close as
+// configured by opts. With opts.HashFunc set, the Writer also hashes the
+// uncompressed input as it is written, which Sum returns once it is closed.
+func NewWriterWithOptions(w io.Writer, opts Options) *Writer {
+	zw := &Writer{w: w, opts: opts}
+	if opts.HashFunc != nil {
+		zw.hash = opts.HashFunc()
+	}
+	return zw
+}
+
+// Sum returns the hash of the input written to a Writer with
+// Options.HashFunc, or nil before Close or without a HashFunc
+func (zw *Writer) Sum() []byte {
+	if zw.hash == nil || !zw.closed {
+		return nil
+	}
+	return zw.hash.Sum(nil)
+}
+
+// NewModelWriter returns a Writer that encodes with the tree built from model
+// and streams its output. The header is written before NewModelWriter returns.
+// Every byte later written must have a count in model.
+func NewModelWriter(w io.Writer, model FrequencyTable) (*Writer, error) {
+	tree := BuildHuffmanTree(model)
+	if tree == nil {
+		return nil, fmt.Errorf("failed to build huffman tree")
+	}
+
+	header := newHeader(model, tree, 0, 0, TableAuto)
+	header.SizeInTrailer = true
+	if err := writeHeader(w, header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return &Writer{w: w, codes: GenerateCodeTable(tree)}, nil
+}
+
+// Write compresses p. In model mode the encoded bytes completed by p are
+// written to the underlying writer before Write returns.
+func (zw *Writer) Write(p []byte) (int, error) {
+	if zw.closed {
+		return 0, errors.New("huffman: write to closed Writer")
+	}
+
+	if zw.codes == nil {
+		zw.buf = append(zw.buf, p...)
+		if zw.hash != nil {
+			zw.hash.Write(p)
+		}
+		return len(p), nil
+	}
+
+	for i, b := range p {
+		code, ok := zw.codes[b]
+		if !ok {
+			if err := zw.flush(); err != nil {
+				return i, err
+			}
+			return i, fmt.Errorf("symbol %s is not in the model", formatByte(b))
+		}
+		for j := 0; j < len(code); j++ {
+			zw.acc <<= 1
+			if code[j] == '1' {
+				zw.acc |= 1
+			}
+			zw.nacc++
+			if zw.nacc == 8 {
+				zw.out = append(zw.out, zw.acc)
+				zw.acc, zw.nacc = 0, 0
+			}
+		}
+		zw.written++
+	}
+
+	return len(p), zw.flush()
+}
+
+// flush writes the completed output bytes
+func (zw *Writer) flush() error {
+	if len(zw.out) == 0 {
+		return nil
+	}
+	_, err := zw.w.Write(zw.out)
+	zw.out = zw.out[:0]
+	return err
+}
+
+// Close finishes the stream. It does not close the underlying writer.
+func (zw *Writer) Close() error {
+	if zw.closed {
+		return nil
+	}
+	zw.closed = true
+
+	if zw.codes == nil {
+		if len(zw.buf) == 0 {
+			return fmt.Errorf("empty input")
+		}
+		return writeCompressed(zw.w, zw.buf, BuildFrequencyTableFromData(zw.buf), zw.opts)
+	}
+
+	paddingBits := 0
+	if zw.nacc > 0 {
+		paddingBits = 8 - zw.nacc
+		zw.out = append(zw.out, zw.acc<<paddingBits)
+	}
+
+	var trailer [trailerSize]byte
+	binary.BigEndian.PutUint64(trailer[:], uint64(zw.written))
+	trailer[8] = byte(paddingBits)
+	zw.out = append(zw.out, trailer[:]...)
+
+	return zw.flush()
+}
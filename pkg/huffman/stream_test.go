@@ -0,0 +1,293 @@
+package huffman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestModelWriterStreamsEarly(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 100)
+	model := BuildFrequencyTableFromData(data)
+
+	var out bytes.Buffer
+	zw, err := NewModelWriter(&out, model)
+	if err != nil {
+		t.Fatalf("NewModelWriter error: %v", err)
+	}
+
+	headerLen := out.Len()
+	if headerLen == 0 {
+		t.Fatal("Expected header to be written before any input")
+	}
+
+	half := len(data) / 2
+	if _, err := zw.Write(data[:half]); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if out.Len() <= headerLen {
+		t.Error("Expected encoded bytes to be written before all input was provided")
+	}
+
+	if _, err := zw.Write(data[half:]); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	_, decoded, err := readCompressed(&out)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Errorf("Decoded data doesn't match original.\nOriginal length: %d\nDecoded length: %d", len(data), len(decoded))
+	}
+}
+
+func TestModelWriterRejectsUnknownSymbol(t *testing.T) {
+	var out bytes.Buffer
+	zw, err := NewModelWriter(&out, FrequencyTable{'a': 2, 'b': 1})
+	if err != nil {
+		t.Fatalf("NewModelWriter error: %v", err)
+	}
+
+	n, err := zw.Write([]byte("abz"))
+	if err == nil {
+		t.Error("Expected error for symbol missing from the model")
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 bytes accepted, got %d", n)
+	}
+}
+
+func TestWriterBuffersUntilClose(t *testing.T) {
+	data := []byte("aaaaaaaabbbbccd")
+
+	var out bytes.Buffer
+	zw := NewWriter(&out)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output before Close, got %d bytes", out.Len())
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	_, decoded, err := readCompressed(&out)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Errorf("Decoded data doesn't match original.\nOriginal: %s\nDecoded: %s", data, decoded)
+	}
+}
+
+func TestWriterHashFunc(t *testing.T) {
+	data := blockTestData()
+
+	var out bytes.Buffer
+	zw := NewWriterWithOptions(&out, Options{HashFunc: sha256.New, Checksum: true})
+	for chunk := range slices.Chunk(data, 1000) {
+		if _, err := zw.Write(chunk); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if sum := zw.Sum(); sum != nil {
+		t.Errorf("Expected no sum before Close, got %x", sum)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	want := sha256.Sum256(data)
+	if !bytes.Equal(zw.Sum(), want[:]) {
+		t.Errorf("Expected sum %x, got %x", want, zw.Sum())
+	}
+
+	header, decoded, err := readCompressed(&out)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !header.Checksummed {
+		t.Error("Expected the Writer to apply the other options")
+	}
+	if !bytes.Equal(data, decoded) {
+		t.Errorf("Decoded data doesn't match original: %s", describeDiff(data, decoded))
+	}
+
+	if sum := NewWriter(&out).Sum(); sum != nil {
+		t.Errorf("Expected no sum without a HashFunc, got %x", sum)
+	}
+}
+
+// readerFromRecorder counts how often the io.ReaderFrom fast path is used
+type readerFromRecorder struct {
+	bytes.Buffer
+	readFromCalls int
+}
+
+func (w *readerFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	w.readFromCalls++
+	return w.Buffer.ReadFrom(r)
+}
+
+func TestCompressStoredUsesReaderFrom(t *testing.T) {
+	data := []byte("stored data is copied straight through")
+
+	compressed := &readerFromRecorder{}
+	if err := Compress(bytes.NewReader(data), compressed, Options{Store: true}); err != nil {
+		t.Fatalf("Compress error: %v", err)
+	}
+	if compressed.readFromCalls != 1 {
+		t.Errorf("Expected ReadFrom to be used once while compressing, got %d calls", compressed.readFromCalls)
+	}
+
+	decompressed := &readerFromRecorder{}
+	if err := Decompress(bytes.NewReader(compressed.Bytes()), decompressed); err != nil {
+		t.Fatalf("Decompress error: %v", err)
+	}
+	if decompressed.readFromCalls != 1 {
+		t.Errorf("Expected ReadFrom to be used once while decompressing, got %d calls", decompressed.readFromCalls)
+	}
+	if !bytes.Equal(data, decompressed.Bytes()) {
+		t.Errorf("Decompressed data doesn't match original.\nExpected: %s\nGot: %s", data, decompressed.Bytes())
+	}
+}
+
+func TestCompressRejectsInvalidStoreOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"legacy", Options{Store: true, Legacy: true}},
+		{"checksum", Options{Store: true, Checksum: true}},
+		{"trailer", Options{Store: true, Trailer: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			if err := Compress(bytes.NewReader([]byte("stored data")), &compressed, tt.opts); err == nil {
+				t.Error("Expected an error for an invalid combination with Store")
+			}
+			if compressed.Len() != 0 {
+				t.Errorf("Expected nothing written, got %d bytes", compressed.Len())
+			}
+		})
+	}
+}
+
+func TestCompressDecompressStream(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"huffman", Options{}},
+		{"stored", Options{Store: true}},
+		{"stored and aligned", Options{Store: true, PadTo: 64}},
+	}
+
+	data := bytes.Repeat([]byte("streaming compress and decompress "), 30)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed, decompressed bytes.Buffer
+			if err := Compress(bytes.NewReader(data), &compressed, tt.opts); err != nil {
+				t.Fatalf("Compress error: %v", err)
+			}
+			if err := Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(data, decompressed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(data), decompressed.Len())
+			}
+		})
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	inputs := [][]byte{
+		[]byte("a"),
+		[]byte("ab"),
+		bytes.Repeat([]byte("z"), 1000),
+		bytes.Repeat([]byte("xy"), 4),
+		allBytes(),
+		blockTestData(),
+	}
+	for _, n := range []int{1, 7, 8, 9, 63, 64, 65, 1000, 4097} {
+		random := make([]byte, n)
+		rng.Read(random)
+		skewed := make([]byte, n)
+		for i := range skewed {
+			skewed[i] = byte('a' + int(rng.ExpFloat64()*3)%26)
+		}
+		inputs = append(inputs, random, skewed)
+	}
+
+	for _, data := range inputs {
+		size, err := EncodedSize(data)
+		if err != nil {
+			t.Fatalf("EncodedSize error for %d bytes: %v", len(data), err)
+		}
+		var compressed bytes.Buffer
+		if err := Compress(bytes.NewReader(data), &compressed, Options{}); err != nil {
+			t.Fatalf("Compress error: %v", err)
+		}
+		if size != int64(compressed.Len()) {
+			t.Errorf("EncodedSize of %d bytes is %d, Compress wrote %d", len(data), size, compressed.Len())
+		}
+	}
+
+	if _, err := EncodedSize(nil); err == nil {
+		t.Error("Expected an error for empty input")
+	}
+}
+
+func TestCompressPeek(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	// The repetitive stream uses a symbol after the sample that the sample
+	// never saw
+	repetitive := append(bytes.Repeat([]byte("aaaaaaaabbbbccd"), 5000), 'z')
+
+	tests := []struct {
+		name   string
+		data   []byte
+		stored bool
+	}{
+		{"random", random, true},
+		{"repetitive", repetitive, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			if err := CompressPeek(bytes.NewReader(tt.data), &compressed, 4096); err != nil {
+				t.Fatalf("CompressPeek error: %v", err)
+			}
+
+			header, err := ParseHeader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if header.Stored != tt.stored {
+				t.Errorf("Expected stored=%v, got %v", tt.stored, header.Stored)
+			}
+
+			var decompressed bytes.Buffer
+			if err := Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decompressed.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original.\nOriginal length: %d\nDecompressed length: %d", len(tt.data), decompressed.Len())
+			}
+		})
+	}
+}
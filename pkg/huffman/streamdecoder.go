@@ -0,0 +1,172 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StreamDecoder decodes a payload pushed to it in chunks of any size, for
+// callers such as network parsers that receive compressed bytes irregularly.
+// It keeps its position in the tree between calls, so a code may be split
+// across chunks.
+//
+// With a known originalSize, decoding stops once that many bytes have been
+// produced and any further input, including the padding, is ignored. With a
+// negative originalSize the size is derived from the payload: the last byte
+// is held back until Close, which strips paddingBits from it.
+type StreamDecoder struct {
+	root         *Node
+	originalSize int64
+	paddingBits  int
+
+	current  *Node
+	produced int64
+	held     byte // last byte seen, in derived mode
+	holding  bool
+	closed   bool
+}
+
+// NewStreamDecoder returns a StreamDecoder for a payload coded with the tree
+// at root.
+func NewStreamDecoder(root *Node, originalSize int64, paddingBits int) *StreamDecoder {
+	return &StreamDecoder{
+		root:         root,
+		originalSize: originalSize,
+		paddingBits:  paddingBits,
+		current:      root,
+	}
+}
+
+// Reset returns the decoder to its initial state so it can decode another
+// payload coded with the same tree and sizes.
+func (sd *StreamDecoder) Reset() {
+	*sd = StreamDecoder{
+		root:         sd.root,
+		originalSize: sd.originalSize,
+		paddingBits:  sd.paddingBits,
+		current:      sd.root,
+	}
+}
+
+// Done reports whether every byte of a payload of known size has been
+// produced.
+func (sd *StreamDecoder) Done() bool {
+	return sd.originalSize >= 0 && sd.produced == sd.originalSize
+}
+
+// Write consumes compressed bytes and returns the bytes they complete.
+func (sd *StreamDecoder) Write(p []byte) (emitted []byte, err error) {
+	if sd.closed {
+		return nil, errors.New("huffman: write to closed StreamDecoder")
+	}
+	if sd.root == nil {
+		return nil, fmt.Errorf("invalid Huffman tree")
+	}
+
+	// Special case: single character, whose codes take no bits
+	if sd.root.Left == nil && sd.root.Right == nil {
+		if sd.originalSize < 0 {
+			return nil, fmt.Errorf("cannot derive the size of a single-symbol stream")
+		}
+		return sd.fill(), nil
+	}
+
+	if sd.originalSize >= 0 {
+		for _, b := range p {
+			if sd.Done() {
+				break
+			}
+			if emitted, err = sd.decodeByte(emitted, b, 8); err != nil {
+				return emitted, err
+			}
+		}
+		return emitted, nil
+	}
+
+	for _, b := range p {
+		if sd.holding {
+			if emitted, err = sd.decodeByte(emitted, sd.held, 8); err != nil {
+				return emitted, err
+			}
+		}
+		sd.held, sd.holding = b, true
+	}
+	return emitted, nil
+}
+
+// Close finishes the payload and returns any bytes still to be produced: the
+// rest of a single-symbol stream, or the held-back last byte of a derived-size
+// stream. It fails if the payload ended early or inside a code.
+func (sd *StreamDecoder) Close() (emitted []byte, err error) {
+	if sd.closed {
+		return nil, nil
+	}
+	sd.closed = true
+
+	if sd.root == nil {
+		return nil, fmt.Errorf("invalid Huffman tree")
+	}
+
+	if sd.originalSize >= 0 {
+		if sd.root.Left == nil && sd.root.Right == nil {
+			emitted = sd.fill()
+		}
+		if !sd.Done() {
+			return emitted, fmt.Errorf("payload ended after %d of %d bytes", sd.produced, sd.originalSize)
+		}
+		return emitted, nil
+	}
+
+	if sd.root.Left == nil && sd.root.Right == nil {
+		return nil, fmt.Errorf("cannot derive the size of a single-symbol stream")
+	}
+	if sd.holding {
+		if emitted, err = sd.decodeByte(emitted, sd.held, 8-sd.paddingBits); err != nil {
+			return emitted, err
+		}
+		sd.holding = false
+	}
+	if sd.current != sd.root {
+		return emitted, fmt.Errorf("invalid bit sequence: payload ends inside a code")
+	}
+	return emitted, nil
+}
+
+// fill produces the remaining bytes of a single-symbol stream
+func (sd *StreamDecoder) fill() []byte {
+	out := make([]byte, sd.originalSize-sd.produced)
+	for i := range out {
+		out[i] = sd.root.Char
+	}
+	sd.produced = sd.originalSize
+	return out
+}
+
+// decodeByte walks the tree over the first nbits bits of b, appending each
+// completed symbol to out
+func (sd *StreamDecoder) decodeByte(out []byte, b byte, nbits int) ([]byte, error) {
+	for i := 0; i < nbits; i++ {
+		if b&(0x80>>i) == 0 {
+			if sd.current.Left == nil {
+				return out, fmt.Errorf("invalid bit sequence: no left child")
+			}
+			sd.current = sd.current.Left
+		} else {
+			if sd.current.Right == nil {
+				return out, fmt.Errorf("invalid bit sequence: no right child")
+			}
+			sd.current = sd.current.Right
+		}
+
+		// Reached leaf node
+		if sd.current.Left == nil && sd.current.Right == nil {
+			out = append(out, sd.current.Char)
+			sd.produced++
+			sd.current = sd.root
+			if sd.Done() {
+				break
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package huffman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStreamDecoderByteAtATime(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"text", []byte("this is an example of a huffman tree")},
+		{"single symbol", bytes.Repeat([]byte("q"), 40)},
+		{"block text", blockTestData()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := BuildHuffmanTree(BuildFrequencyTableFromData(tt.data))
+			codes := GenerateCodeTable(tree)
+			encoded := EncodeData(tt.data, codes)
+			totalBits := 0
+			for _, b := range tt.data {
+				totalBits += len(codes[b])
+			}
+			paddingBits := (8 - totalBits%8) % 8
+
+			want, err := DecodeData(encoded, tree, int64(len(tt.data)), paddingBits)
+			if err != nil {
+				t.Fatalf("DecodeData error: %v", err)
+			}
+
+			sizes := []int64{int64(len(tt.data))}
+			if tree.Left != nil {
+				sizes = append(sizes, -1)
+			}
+			for _, size := range sizes {
+				sd := NewStreamDecoder(tree, size, paddingBits)
+				// Decode twice to check that Reset starts over
+				for round := 0; round < 2; round++ {
+					var got []byte
+					for i := range encoded {
+						emitted, err := sd.Write(encoded[i : i+1])
+						if err != nil {
+							t.Fatalf("Write error at byte %d: %v", i, err)
+						}
+						got = append(got, emitted...)
+					}
+					emitted, err := sd.Close()
+					if err != nil {
+						t.Fatalf("Close error: %v", err)
+					}
+					got = append(got, emitted...)
+
+					if !bytes.Equal(want, got) {
+						t.Errorf("Size %d, round %d: output doesn't match DecodeData: %s", size, round, describeDiff(want, got))
+					}
+					sd.Reset()
+				}
+			}
+		})
+	}
+}
+
+func TestStreamDecoderTruncated(t *testing.T) {
+	data := []byte("truncated payloads are reported")
+	tree := BuildHuffmanTree(BuildFrequencyTableFromData(data))
+	encoded := EncodeData(data, GenerateCodeTable(tree))
+
+	sd := NewStreamDecoder(tree, int64(len(data)), 0)
+	if _, err := sd.Write(encoded[:len(encoded)/2]); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if _, err := sd.Close(); err == nil {
+		t.Error("Expected an error closing a truncated payload")
+	}
+}
@@ -0,0 +1,100 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressStrict(t *testing.T) {
+	data := blockTestData()
+	lines, err := CompressLines(data)
+	if err != nil {
+		t.Fatalf("CompressLines failed: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	// A one-leaf tree codes each byte as a bit the decoder never reads
+	single := bytes.Repeat([]byte("a"), 100)
+	singlePath := filepath.Join(tmpDir, "single.txt")
+	if err := os.WriteFile(singlePath, single, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	bytePath := filepath.Join(tmpDir, "byte.txt")
+	if err := os.WriteFile(bytePath, []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		compress func(outputPath string) error
+	}{
+		{"single stream", data, func(outputPath string) error { return CompressFile(inputPath, outputPath) }},
+		{"block archive", data, func(outputPath string) error {
+			return CompressParallel(inputPath, outputPath, ParallelOptions{BlockSize: 4096})
+		}},
+		{"line archive", data, func(outputPath string) error { return os.WriteFile(outputPath, lines, 0644) }},
+		{"single symbol", single, func(outputPath string) error { return CompressFile(singlePath, outputPath) }},
+		{"one byte", []byte("a"), func(outputPath string) error { return CompressFile(bytePath, outputPath) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.name+".huf")
+			outputPath := filepath.Join(tmpDir, tt.name+".out")
+			if err := tt.compress(compressedPath); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			strict := DecompressOptions{Strict: true}
+			if err := DecompressFileWithOptions(compressedPath, outputPath, strict); err != nil {
+				t.Fatalf("Strict decompression of a valid file failed: %v", err)
+			}
+
+			compressed, err := os.ReadFile(compressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			garbage := append(compressed, "appended garbage"...)
+			if err := os.WriteFile(compressedPath, garbage, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			newPath := filepath.Join(tmpDir, tt.name+".new")
+			err = DecompressFileWithOptions(compressedPath, newPath, strict)
+			if !errors.Is(err, ErrTrailingData) {
+				t.Errorf("Expected ErrTrailingData, got %v", err)
+			}
+			if _, statErr := os.Stat(newPath); !os.IsNotExist(statErr) {
+				t.Error("Expected the output of a failed decompression to be removed")
+			}
+
+			// A failure leaves the earlier output in place
+			err = DecompressFileWithOptions(compressedPath, outputPath, strict)
+			if !errors.Is(err, ErrTrailingData) {
+				t.Errorf("Expected ErrTrailingData, got %v", err)
+			}
+			if kept, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(tt.data, kept) {
+				t.Errorf("Expected the earlier output to be kept, got %v", err)
+			}
+
+			if err := DecompressFile(compressedPath, outputPath); err != nil {
+				t.Fatalf("Non-strict decompression failed: %v", err)
+			}
+			decompressed, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tt.data, decompressed) {
+				t.Errorf("Non-strict output doesn't match original: %s", describeDiff(tt.data, decompressed))
+			}
+		})
+	}
+}
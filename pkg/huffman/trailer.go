@@ -0,0 +1,69 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// infoTrailerSize is the length of the info trailer:
+// [Magic:1][Version:1][OriginalSize:8][Checksum:4]
+const infoTrailerSize = 14
+
+// TrailerInfo is the metadata in an info trailer, written with
+// Options.Trailer
+type TrailerInfo struct {
+	// Version is the format version of the file
+	Version int
+	// OriginalSize is the size of the decompressed data
+	OriginalSize int64
+	// Checksum is the CRC-32 (IEEE) of the decompressed data
+	Checksum uint32
+}
+
+// appendInfoTrailer appends the info trailer for info to buf
+func appendInfoTrailer(buf []byte, info TrailerInfo) []byte {
+	buf = append(buf, magicByte, versionFlag|byte(info.Version))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(info.OriginalSize))
+	return binary.BigEndian.AppendUint32(buf, info.Checksum)
+}
+
+// parseInfoTrailer reads the info trailer at the end of data
+func parseInfoTrailer(data []byte) (TrailerInfo, error) {
+	if len(data) < infoTrailerSize {
+		return TrailerInfo{}, fmt.Errorf("missing info trailer")
+	}
+	trailer := data[len(data)-infoTrailerSize:]
+	if trailer[0] != magicByte || trailer[1]&versionFlag == 0 {
+		return TrailerInfo{}, fmt.Errorf("invalid info trailer")
+	}
+	if version := trailer[1] &^ versionFlag; version != formatVersion {
+		return TrailerInfo{}, fmt.Errorf("unsupported format version %d in info trailer", version)
+	}
+
+	originalSize := binary.BigEndian.Uint64(trailer[2:])
+	if originalSize > math.MaxInt64 {
+		return TrailerInfo{}, fmt.Errorf("invalid original size %d in info trailer", originalSize)
+	}
+	return TrailerInfo{
+		Version:      formatVersion,
+		OriginalSize: int64(originalSize),
+		Checksum:     binary.BigEndian.Uint32(trailer[10:]),
+	}, nil
+}
+
+// ReadTrailer reads the info trailer from the end of a file written with
+// Options.Trailer, without reading the header or payload. Tools can use it to
+// learn the size and checksum of a file whose header was written before they
+// were known.
+func ReadTrailer(r io.ReadSeeker) (TrailerInfo, error) {
+	if _, err := r.Seek(-infoTrailerSize, io.SeekEnd); err != nil {
+		return TrailerInfo{}, fmt.Errorf("failed to seek to info trailer: %w", err)
+	}
+	trailer := make([]byte, infoTrailerSize)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return TrailerInfo{}, fmt.Errorf("failed to read info trailer: %w", err)
+	}
+	return parseInfoTrailer(trailer)
+}
@@ -0,0 +1,62 @@
+package huffman
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadTrailer(t *testing.T) {
+	data := bytes.Repeat([]byte("metadata can be read from the end of the file "), 200)
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	decompressedPath := filepath.Join(tmpDir, "decompressed.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CompressFileWithOptions(inputPath, compressedPath, Options{Trailer: true}); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	file, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	info, err := ReadTrailer(file)
+	if err != nil {
+		t.Fatalf("ReadTrailer error: %v", err)
+	}
+	want := TrailerInfo{Version: formatVersion, OriginalSize: int64(len(data)), Checksum: crc32.ChecksumIEEE(data)}
+	if info != want {
+		t.Errorf("Expected trailer %+v, got %+v", want, info)
+	}
+
+	if err := DecompressFile(compressedPath, decompressedPath); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+
+	// A file without a trailer is rejected
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+	plain, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTrailer(bytes.NewReader(plain)); err == nil {
+		t.Error("Expected an error reading the trailer of a file without one")
+	}
+}
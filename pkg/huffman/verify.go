@@ -0,0 +1,149 @@
+package huffman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// ErrHashMismatch is returned when decompressed data doesn't have the
+// expected digest
+var ErrHashMismatch = errors.New("huffman: decompressed data does not match the expected hash")
+
+// DecompressAndVerify decompresses a file like DecompressFile and checks the
+// SHA-256 digest of the output against expectedHexSHA256, such as a checksum
+// published alongside an archive. On a mismatch it returns ErrHashMismatch and
+// leaves no output, or the file that was already at outputPath.
+func DecompressAndVerify(inputPath, outputPath, expectedHexSHA256 string) error {
+	expected, err := hex.DecodeString(strings.TrimSpace(expectedHexSHA256))
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 digest %q", expectedHexSHA256)
+	}
+
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	output, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	err = Decompress(input, io.MultiWriter(output, hash))
+	if err == nil && !bytes.Equal(hash.Sum(nil), expected) {
+		err = fmt.Errorf("%s: %w", outputPath, ErrHashMismatch)
+	}
+	return output.finish(err, nil)
+}
+
+// ErrModelDrift is returned when decompressed data's byte distribution strays
+// too far from an expected model
+var ErrModelDrift = errors.New("huffman: decompressed data does not match the expected model")
+
+// DecompressCheckModel decompresses a file like DecompressFile and compares
+// the byte distribution of the output with expected, such as a model built
+// from known-good data, to flag unexpected content. The distance is the total
+// variation distance between the two distributions: half the sum of the
+// differences in each byte's share, from 0 for the same distribution to 1 for
+// ones with no byte in common. Beyond tolerance it returns ErrModelDrift, but
+// unlike DecompressAndVerify it keeps the output, which is still the correct
+// decompression of the input.
+func DecompressCheckModel(inputPath, outputPath string, expected FrequencyTable, tolerance float64) error {
+	var expectedTotal int
+	for _, count := range expected {
+		if count < 0 {
+			return fmt.Errorf("invalid expected model: negative count")
+		}
+		expectedTotal += count
+	}
+	if expectedTotal == 0 {
+		return fmt.Errorf("invalid expected model: no counts")
+	}
+	if tolerance < 0 || tolerance > 1 {
+		return fmt.Errorf("invalid tolerance %v", tolerance)
+	}
+
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+	if err := checkNotSameFile(inputPath, outputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	output, err := createOutput(outputPath)
+	if err != nil {
+		return err
+	}
+
+	var counts histogramWriter
+	err = Decompress(input, io.MultiWriter(output, &counts))
+	if err := output.finish(err, nil); err != nil {
+		return err
+	}
+
+	if distance := modelDistance(&counts.counts, expected, expectedTotal); distance > tolerance {
+		return fmt.Errorf("%s: distance %.4f exceeds tolerance %.4f: %w", outputPath, distance, tolerance, ErrModelDrift)
+	}
+	return nil
+}
+
+// modelDistance returns the total variation distance between the byte
+// distribution of counts and expected, whose counts sum to expectedTotal
+func modelDistance(counts *byteCounts, expected FrequencyTable, expectedTotal int) float64 {
+	var total int
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 1
+	}
+
+	var sum float64
+	for i, count := range counts {
+		sum += math.Abs(float64(count)/float64(total) - float64(expected[byte(i)])/float64(expectedTotal))
+	}
+	return sum / 2
+}
+
+// histogramWriter counts the byte values written to it
+type histogramWriter struct {
+	counts byteCounts
+}
+
+func (w *histogramWriter) Write(p []byte) (int, error) {
+	w.counts.add(p)
+	return len(p), nil
+}
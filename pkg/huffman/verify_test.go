@@ -0,0 +1,116 @@
+package huffman
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressAndVerify(t *testing.T) {
+	data := []byte("archives are verified against a published checksum")
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "compressed.huf")
+	outputPath := filepath.Join(tmpDir, "output.txt")
+
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("Compression failed: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	if err := DecompressAndVerify(compressedPath, outputPath, hex.EncodeToString(sum[:])); err != nil {
+		t.Fatalf("DecompressAndVerify with the correct hash failed: %v", err)
+	}
+	decompressed, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decompressed) != string(data) {
+		t.Errorf("Decompressed data doesn't match original: %s", describeDiff(data, decompressed))
+	}
+
+	wrong := sha256.Sum256([]byte("something else"))
+	newPath := filepath.Join(tmpDir, "new.txt")
+	err = DecompressAndVerify(compressedPath, newPath, hex.EncodeToString(wrong[:]))
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the mismatched output to be removed, got %v", err)
+	}
+
+	// The file already at the output path is left as it was
+	err = DecompressAndVerify(compressedPath, outputPath, hex.EncodeToString(wrong[:]))
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+	if kept, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(data, kept) {
+		t.Errorf("Expected the earlier output to be kept, got %v", err)
+	}
+
+	if err := DecompressAndVerify(compressedPath, outputPath, "not hex"); err == nil {
+		t.Error("Expected an error for a malformed hash")
+	}
+}
+
+func TestDecompressCheckModel(t *testing.T) {
+	expected := BuildFrequencyTableFromData(blockTestData())
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name  string
+		data  []byte
+		drift bool
+	}{
+		{"same content", blockTestData(), false},
+		{"similar content", []byte("line q of the block archive test\nline r of the block archive test\n"), false},
+		{"different content", bytes.Repeat([]byte{0x00, 0xFF, 0x7F}, 1000), true},
+		{"mostly digits", []byte("line 0123456789 0123456789 0123456789 0123456789 of the test\n"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputPath := filepath.Join(tmpDir, "input.txt")
+			compressedPath := filepath.Join(tmpDir, "compressed.huf")
+			outputPath := filepath.Join(tmpDir, "output.txt")
+			if err := os.WriteFile(inputPath, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := CompressFile(inputPath, compressedPath); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			err := DecompressCheckModel(compressedPath, outputPath, expected, 0.2)
+			if tt.drift && !errors.Is(err, ErrModelDrift) {
+				t.Errorf("Expected ErrModelDrift, got %v", err)
+			}
+			if !tt.drift && err != nil {
+				t.Errorf("Expected no drift, got %v", err)
+			}
+
+			// The output is written either way
+			decompressed, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tt.data, decompressed) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decompressed))
+			}
+		})
+	}
+
+	inputPath := filepath.Join(tmpDir, "compressed.huf")
+	if err := DecompressCheckModel(inputPath, filepath.Join(tmpDir, "out"), expected, 1.5); err == nil {
+		t.Error("Expected an error for a tolerance above 1")
+	}
+	if err := DecompressCheckModel(inputPath, filepath.Join(tmpDir, "out"), FrequencyTable{}, 0.1); err == nil {
+		t.Error("Expected an error for an empty model")
+	}
+}
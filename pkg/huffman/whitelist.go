@@ -0,0 +1,86 @@
+package huffman
+
+import "fmt"
+
+// CompressWhitelist compresses data for a protocol that expects only the bytes
+// in allowed, such as the base64 alphabet. The model covers just the allowed
+// symbols that occur in data, plus an escape symbol when data has other bytes;
+// each of those is coded as the escape code followed by its 8 literal bits,
+// as with BuildFrequencyTableTopK. The escape is the lowest byte value outside
+// allowed. The result decodes with Decompress. allowed must be non-empty and
+// hold each byte at most once.
+func CompressWhitelist(data []byte, allowed []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty input")
+	}
+	freq, escape, err := whitelistModel(data, allowed)
+	if err != nil {
+		return nil, err
+	}
+	if len(freq) == 1 {
+		freq = addUnusedSymbol(freq)
+	}
+
+	codes, tree := BuildCodes(freq)
+	if tree == nil {
+		return nil, fmt.Errorf("failed to build huffman tree")
+	}
+
+	var encoded []byte
+	var paddingBits int
+	if escape >= 0 {
+		encoded, paddingBits = encodeEscaped(data, codes, escape, nil)
+	} else {
+		encoded = EncodeData(data, codes)
+		paddingBits = int((8 - encodedBits(data, codes, -1)%8) % 8)
+	}
+
+	header := newHeader(freq, tree, int64(len(data)), paddingBits, TableAuto)
+	header.Escaped, header.Escape = escape >= 0, byte(escape)
+	out, err := appendHeader(nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	return append(out, encoded...), nil
+}
+
+// whitelistModel counts the allowed bytes of data, folding every other byte
+// into an escape symbol. It returns the escape, or -1 when data holds only
+// allowed bytes.
+func whitelistModel(data []byte, allowed []byte) (FrequencyTable, int, error) {
+	if len(allowed) == 0 {
+		return nil, -1, fmt.Errorf("empty whitelist")
+	}
+	var isAllowed [256]bool
+	for _, b := range allowed {
+		if isAllowed[b] {
+			return nil, -1, fmt.Errorf("whitelist has byte 0x%02X more than once", b)
+		}
+		isAllowed[b] = true
+	}
+
+	var counts byteCounts
+	counts.add(data)
+
+	freq := make(FrequencyTable)
+	escape, others := -1, 0
+	for i, count := range counts {
+		if !isAllowed[i] {
+			if escape < 0 {
+				escape = i
+			}
+			others += count
+			continue
+		}
+		if count > 0 {
+			freq[byte(i)] = count
+		}
+	}
+	if others == 0 {
+		return freq, -1, nil
+	}
+
+	freq[byte(escape)] = others
+	return freq, escape, nil
+}
@@ -0,0 +1,68 @@
+package huffman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressWhitelist(t *testing.T) {
+	base64 := []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		allowed []byte
+		escaped bool
+	}{
+		{"allowed only", []byte("SGVsbG8gd29ybGQ="), base64, false},
+		{"mixed", []byte("SGVsbG8g\nd29y!bGQ=\x00\xff-"), base64, true},
+		{"disallowed only", []byte("!!!***"), base64, true},
+		{"escape byte in data", []byte("\x00\x00abc"), []byte("abc"), true},
+		{"every byte allowed", []byte("any bytes\x00\xff"), allBytes(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := CompressWhitelist(tt.data, tt.allowed)
+			if err != nil {
+				t.Fatalf("CompressWhitelist error: %v", err)
+			}
+			header, err := ParseHeader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("ParseHeader error: %v", err)
+			}
+			if header.Escaped != tt.escaped {
+				t.Errorf("Expected escaped %v, got %v", tt.escaped, header.Escaped)
+			}
+
+			var decoded bytes.Buffer
+			if err := Decompress(bytes.NewReader(compressed), &decoded); err != nil {
+				t.Fatalf("Decompress error: %v", err)
+			}
+			if !bytes.Equal(tt.data, decoded.Bytes()) {
+				t.Errorf("Decompressed data doesn't match original: %s", describeDiff(tt.data, decoded.Bytes()))
+			}
+		})
+	}
+}
+
+func TestCompressWhitelistInvalid(t *testing.T) {
+	if _, err := CompressWhitelist([]byte("abc"), nil); err == nil {
+		t.Error("Expected an error for an empty whitelist")
+	}
+	if _, err := CompressWhitelist([]byte("abc"), []byte("abca")); err == nil {
+		t.Error("Expected an error for a duplicated whitelist byte")
+	}
+	if _, err := CompressWhitelist(nil, []byte("abc")); err == nil {
+		t.Error("Expected an error for empty input")
+	}
+}
+
+// allBytes returns every byte value once
+func allBytes() []byte {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	return all
+}
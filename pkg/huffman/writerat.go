@@ -0,0 +1,49 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// DecompressToWriterAt decompresses a file into w starting at offset, for
+// placing the content in a preallocated region of a larger file such as an
+// *os.File being patched in place. Bytes of w outside the decoded region are
+// left alone. The decoded size is checked against the header, and a WriteAt
+// that writes fewer bytes than it was given fails with io.ErrShortWrite.
+func DecompressToWriterAt(inputPath string, w io.WriterAt, offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid offset %d", offset)
+	}
+	if err := checkNotDirectory(inputPath); err != nil {
+		return err
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer func(input *os.File) {
+		err := input.Close()
+		if err != nil {
+			log.Printf("failed to close input file: %v", err)
+		}
+	}(input)
+
+	return decompress(input, exactWriter{io.NewOffsetWriter(w, offset)}, DecompressOptions{})
+}
+
+// exactWriter reports a write of fewer bytes than given as io.ErrShortWrite,
+// for writers that don't return an error themselves
+type exactWriter struct {
+	w io.Writer
+}
+
+func (e exactWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
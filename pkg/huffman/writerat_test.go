@@ -0,0 +1,96 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressToWriterAt(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	single := filepath.Join(tmpDir, "single.huf")
+	if err := CompressFile(inputPath, single); err != nil {
+		t.Fatalf("CompressFile error: %v", err)
+	}
+	stored := filepath.Join(tmpDir, "stored.huf")
+	if err := CompressFileWithOptions(inputPath, stored, Options{Store: true}); err != nil {
+		t.Fatalf("CompressFileWithOptions error: %v", err)
+	}
+	archive := writeBlockArchive(t, data, ParallelOptions{BlockSize: 1000})
+
+	const offset = 4096
+	for name, path := range map[string]string{"single": single, "stored": stored, "archive": archive} {
+		t.Run(name, func(t *testing.T) {
+			// Preallocate a file with room around the decoded region
+			region := bytes.Repeat([]byte{0xEE}, offset+len(data)+4096)
+			targetPath := filepath.Join(t.TempDir(), "target.bin")
+			if err := os.WriteFile(targetPath, region, 0644); err != nil {
+				t.Fatal(err)
+			}
+			target, err := os.OpenFile(targetPath, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := DecompressToWriterAt(path, target, offset); err != nil {
+				t.Fatalf("DecompressToWriterAt error: %v", err)
+			}
+			if err := target.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(targetPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(region) {
+				t.Fatalf("Expected the file to stay %d bytes, got %d", len(region), len(got))
+			}
+			if !bytes.Equal(region[:offset], got[:offset]) {
+				t.Error("Bytes before the offset were changed")
+			}
+			if decoded := got[offset : offset+len(data)]; !bytes.Equal(data, decoded) {
+				t.Errorf("Decoded region doesn't match original: %s", describeDiff(data, decoded))
+			}
+			if !bytes.Equal(region[offset+len(data):], got[offset+len(data):]) {
+				t.Error("Bytes after the decoded region were changed")
+			}
+		})
+	}
+}
+
+// shortWriterAt writes at most limit bytes per call without an error
+type shortWriterAt struct {
+	limit int
+}
+
+func (s shortWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return min(len(p), s.limit), nil
+}
+
+func TestDecompressToWriterAtShortWrite(t *testing.T) {
+	data := blockTestData()
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.txt")
+	compressedPath := filepath.Join(tmpDir, "input.huf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CompressFile(inputPath, compressedPath); err != nil {
+		t.Fatalf("CompressFile error: %v", err)
+	}
+
+	if err := DecompressToWriterAt(compressedPath, shortWriterAt{limit: 10}, 0); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Expected io.ErrShortWrite, got %v", err)
+	}
+	if err := DecompressToWriterAt(compressedPath, shortWriterAt{limit: 10}, -1); err == nil {
+		t.Error("Expected an error for a negative offset")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/letsmakecakes/huffman/internal/bytediff"
 	"github.com/letsmakecakes/huffman/pkg/huffman"
 )
 
@@ -31,7 +32,7 @@ func testRoundTrip(t *testing.T, data []byte, errorMsg string) {
 
 	decompressed, _ := os.ReadFile(decompressedPath)
 	if !bytes.Equal(data, decompressed) {
-		t.Error(errorMsg)
+		t.Errorf("%s: %s", errorMsg, bytediff.Describe(data, decompressed))
 	}
 }
 
@@ -77,7 +78,7 @@ func TestLargeFileCompression(t *testing.T) {
 	}
 
 	if !bytes.Equal(testData, decompressed) {
-		t.Error("Decompressed data doesn't match original")
+		t.Errorf("Decompressed data doesn't match original: %s", bytediff.Describe(testData, decompressed))
 	}
 }
 
@@ -138,7 +139,7 @@ func TestVariousFileTypes(t *testing.T) {
 			}
 
 			if !bytes.Equal(tt.data, decompressed) {
-				t.Errorf("Data mismatch for %s", tt.name)
+				t.Errorf("Data mismatch for %s: %s", tt.name, bytediff.Describe(tt.data, decompressed))
 			}
 		})
 	}
@@ -154,6 +155,73 @@ func TestEdgeCases(t *testing.T) {
 	})
 }
 
+func TestAllByteValues(t *testing.T) {
+	// Every byte value, each with its own count from 1 to 256
+	var data []byte
+	for i := 0; i < 256; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, 1+(i*37)%256)...)
+	}
+	tmpDir := t.TempDir()
+	inputPath := filepath.Join(tmpDir, "input.bin")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts huffman.Options
+	}{
+		{"auto", huffman.Options{}},
+		{"frequencies", huffman.Options{Table: huffman.TableFrequencies}},
+		{"tree", huffman.Options{Table: huffman.TableTree}},
+		{"ranges", huffman.Options{Table: huffman.TableRanges}},
+		{"delta", huffman.Options{DeltaBase: huffman.EnglishTextModel}},
+		{"coded", huffman.Options{Table: huffman.TableCoded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressedPath := filepath.Join(tmpDir, tt.name+".huf")
+			decompressedPath := filepath.Join(tmpDir, tt.name+".bin")
+			if err := huffman.CompressFileWithOptions(inputPath, compressedPath, tt.opts); err != nil {
+				t.Fatalf("Compression failed: %v", err)
+			}
+
+			codes, err := huffman.CodesFromFile(compressedPath)
+			if err != nil {
+				t.Fatalf("CodesFromFile error: %v", err)
+			}
+			if len(codes) != 256 {
+				t.Errorf("Expected the header to record 256 symbols, got %d", len(codes))
+			}
+
+			if err := huffman.DecompressFile(compressedPath, decompressedPath); err != nil {
+				t.Fatalf("Decompression failed: %v", err)
+			}
+			decompressed, err := os.ReadFile(decompressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, decompressed) {
+				t.Errorf("Data mismatch: %s", bytediff.Describe(data, decompressed))
+			}
+		})
+	}
+
+	// A nibble table holds at most 16 symbols, so a full alphabet is
+	// refused rather than truncated
+	nibblesPath := filepath.Join(tmpDir, "nibbles.huf")
+	if err := huffman.CompressFileWithOptions(inputPath, nibblesPath, huffman.Options{Table: huffman.TableNibbles}); err == nil {
+		t.Error("Expected the nibble table to refuse 256 symbols")
+	}
+
+	// The legacy table size is a single byte, so it refuses a full alphabet
+	// too
+	legacyPath := filepath.Join(tmpDir, "legacy.huf")
+	if err := huffman.CompressFileWithOptions(inputPath, legacyPath, huffman.Options{Legacy: true}); err == nil {
+		t.Error("Expected the legacy format to refuse 256 symbols")
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	t.Run("non-existent input file", func(t *testing.T) {
 		err := huffman.CompressFile("/nonexistent/file.txt", "/tmp/output.huf")
@@ -223,3 +291,63 @@ func TestCompressionRatio(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressFileWithCodes(t *testing.T) {
+	tmpDir := t.TempDir()
+	trainingPath := filepath.Join(tmpDir, "a.txt")
+	inputPath := filepath.Join(tmpDir, "b.txt")
+	compressedPath := filepath.Join(tmpDir, "b.huf")
+	decompressedPath := filepath.Join(tmpDir, "b.dec")
+
+	training := bytes.Repeat([]byte("train the codes once on a sample of the data, then reuse them. "), 50)
+	input := []byte("then reuse the same codes on the rest of the data.")
+	if err := os.WriteFile(trainingPath, training, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Generate codes from file A
+	freq, err := huffman.BuildFrequencyTable(trainingPath)
+	if err != nil {
+		t.Fatalf("BuildFrequencyTable error: %v", err)
+	}
+	codes, tree := huffman.BuildCodes(freq)
+
+	// Compress file B with them and decompress with the same codes
+	if err := huffman.CompressFileWithCodes(inputPath, compressedPath, codes, tree); err != nil {
+		t.Fatalf("CompressFileWithCodes error: %v", err)
+	}
+	if err := huffman.DecompressFileWithCodes(compressedPath, decompressedPath, tree); err != nil {
+		t.Fatalf("DecompressFileWithCodes error: %v", err)
+	}
+	decompressed, err := os.ReadFile(decompressedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(input, decompressed) {
+		t.Errorf("Decompressed data doesn't match original: %s", bytediff.Describe(input, decompressed))
+	}
+
+	// The file has no model of its own
+	if err := huffman.DecompressFile(compressedPath, decompressedPath); err == nil {
+		t.Error("Expected DecompressFile to reject a file compressed with external codes")
+	}
+
+	// Different codes are detected rather than decoded into garbage
+	otherCodes, otherTree := huffman.BuildCodes(huffman.BuildFrequencyTableFromData(input))
+	if huffman.CodesID(otherCodes) != huffman.CodesID(codes) {
+		if err := huffman.DecompressFileWithCodes(compressedPath, decompressedPath, otherTree); err == nil {
+			t.Error("Expected an error decompressing with different codes")
+		}
+	}
+
+	// Every input byte needs a code
+	if err := os.WriteFile(inputPath, []byte("Z is not in the training data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := huffman.CompressFileWithCodes(inputPath, compressedPath, codes, tree); err == nil {
+		t.Error("Expected an error compressing a byte without a code")
+	}
+}